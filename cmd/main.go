@@ -1,26 +1,48 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/vpoliakov01/2v2ChessAI/engine/ai"
 	"github.com/vpoliakov01/2v2ChessAI/engine/game"
 	"github.com/vpoliakov01/2v2ChessAI/engine/play"
+	"github.com/vpoliakov01/2v2ChessAI/ui"
 )
 
 type flags struct {
 	Depth        int
+	MultiPV      int
 	Moves        int
 	HumanPlayers string // Comma separated list of players.
 	Evaluation   bool
 	Load         string
 	ReactUI      bool
 	Server       bool
+	EngineGames  int
+	TimeControl  string
+	UCI          bool
+	Host         string
+	Port         int
+	TLSCert      string
+	TLSKey       string
+	GamesFile    string
+	LogLevel     string
+	LogFormat    string
+	Algorithm    string
+	Pruning      string
+	Concurrency  int
 }
 
 var flg flags
@@ -28,14 +50,33 @@ var flg flags
 func main() {
 	// Parse command line flags
 	flag.IntVar(&flg.Depth, "depth", 12, "depth of the engine")
+	flag.IntVar(&flg.MultiPV, "multipv", 1, "the number of best lines to print for engine moves")
 	flag.IntVar(&flg.Moves, "moves", 0, "the number of moves to play (0 for unlimited)")
 	flag.StringVar(&flg.HumanPlayers, "humans", "0 2", "space separated list of players (0 1 2 3)")
 	flag.BoolVar(&flg.Evaluation, "eval", true, "print evalution after every move")
 	flag.StringVar(&flg.Load, "load", "", "load pgn notation (no sidelines) to setup the board")
-	flag.BoolVar(&flg.ReactUI, "ui", false, "start the React UI")
+	flag.BoolVar(&flg.ReactUI, "ui", false, "start the React UI (served by the server if the binary embeds it)")
 	flag.BoolVar(&flg.Server, "server", false, "start the server for the UI")
+	flag.IntVar(&flg.EngineGames, "engine-games", 0, "the number of engine vs engine games for the server to host for spectators")
+	flag.StringVar(&flg.TimeControl, "time-control", "", "time control of the games in seconds, e.g. 300+2 (base+increment) or 600d5 (base, delay)")
+	flag.BoolVar(&flg.UCI, "uci", false, "talk the UCI-like text protocol over stdin/stdout")
+	flag.StringVar(&flg.Host, "host", "", "host for the server to listen on (all interfaces if empty)")
+	flag.IntVar(&flg.Port, "port", 8080, "port for the server to listen on")
+	flag.StringVar(&flg.TLSCert, "tls-cert", "", "TLS certificate file for the server to serve HTTPS (requires -tls-key)")
+	flag.StringVar(&flg.TLSKey, "tls-key", "", "TLS key file for the server to serve HTTPS (requires -tls-cert)")
+	flag.StringVar(&flg.GamesFile, "games-file", "", "file to keep the server's stored games in, saved on shutdown")
+	flag.StringVar(&flg.LogLevel, "log-level", "info", "minimum level of the logs (debug, info, warn, error)")
+	flag.StringVar(&flg.LogFormat, "log-format", "text", "format of the logs written to stderr (text, json)")
+	flag.StringVar(&flg.Algorithm, "algorithm", string(ai.AlgorithmNegamax), fmt.Sprintf("search algorithm of the engine %v", ai.Algorithms))
+	flag.StringVar(&flg.Pruning, "pruning", string(ai.PruningSelective), fmt.Sprintf("pruning of the negamax engine %v", ai.Prunings))
+	flag.IntVar(&flg.Concurrency, "engine-concurrency", play.DefaultEngineConcurrency, "the number of engine searches the server runs at once, sharing the CPUs")
 	flag.Parse()
 
+	if err := setupLogging(flg.LogLevel, flg.LogFormat); err != nil {
+		log.Fatal(err)
+	}
+	slog.Info("Starting", "cpus", runtime.NumCPU(), "gomaxprocs", runtime.GOMAXPROCS(0))
+
 	humanPlayersStr := strings.Fields(flg.HumanPlayers)
 	humanPlayers := make([]game.Player, len(humanPlayersStr))
 	for i, playerStr := range humanPlayersStr {
@@ -46,31 +87,90 @@ func main() {
 		humanPlayers[i] = game.Player(player)
 	}
 
+	if _, err := ai.ParseAlgorithm(flg.Algorithm); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := ai.ParsePruning(flg.Pruning); err != nil {
+		log.Fatal(err)
+	}
+
 	cfg := play.Config{
 		Depth:        flg.Depth,
 		Spread:       ai.DefaultSpread,
 		SpreadDrop:   ai.DefaultSpreadDrop,
+		MultiPV:      flg.MultiPV,
 		MoveLimit:    flg.Moves,
 		HumanPlayers: humanPlayers,
 		Evaluation:   flg.Evaluation,
 		Load:         flg.Load,
+		TimeControl:  flg.TimeControl,
+		Algorithm:    flg.Algorithm,
+		Pruning:      flg.Pruning,
 	}
 
-	if flg.Server {
+	if flg.UCI {
+		play.RunUCI(&cfg, os.Stdin, os.Stdout)
+		return
+	}
+
+	if (flg.TLSCert == "") != (flg.TLSKey == "") {
+		log.Fatal("-tls-cert and -tls-key must be given together")
+	}
+
+	embeddedUI := flg.ReactUI && ui.Build != nil // Built with the embedui tag: no Node needed.
+	if flg.Server || embeddedUI {
+		options := []func(*play.Server){
+			play.WithAddress(net.JoinHostPort(flg.Host, strconv.Itoa(flg.Port))),
+			play.WithEngineConcurrency(flg.Concurrency),
+		}
+		if flg.TLSCert != "" {
+			options = append(options, play.WithTLS(flg.TLSCert, flg.TLSKey))
+		}
+		if flg.GamesFile != "" {
+			options = append(options, play.WithGamesFile(flg.GamesFile))
+		}
+		if ui.Build != nil {
+			options = append(options, play.WithUI(ui.Build))
+		}
+		server := play.NewServer(&cfg, options...)
+		for range flg.EngineGames {
+			room, err := server.Lobby().StartEngineGame("")
+			if err != nil {
+				log.Fatalf("Failed to start an engine game: %v", err)
+			}
+			slog.Info("Started engine game", "room", room.ID)
+		}
+
+		// Serve until interrupted, then stop the engines, save the games and close the
+		// websockets before exiting.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 		go func() {
-			play.NewServer(&cfg).Run()
+			defer stop()
+			if err := server.Serve(ctx); err != nil {
+				log.Fatalf("Server error: %v", err)
+			}
+			os.Exit(0)
 		}()
 	}
 
-	if flg.ReactUI {
+	if embeddedUI {
+		scheme := "http"
+		if flg.TLSCert != "" {
+			scheme = "https"
+		}
+		if err := play.OpenBrowser(fmt.Sprintf("%v://localhost:%v", scheme, flg.Port)); err != nil {
+			slog.Warn("Failed to open browser", "error", err)
+		}
+		select {} // Serve until stopped.
+	} else if flg.ReactUI {
 		ex, err := os.Executable()
 		if err != nil {
-			log.Printf("Failed to get executable path: %v", err)
+			slog.Error("Failed to get executable path", "error", err)
 		} else {
 			projectRoot := filepath.Dir(filepath.Dir(ex))
 			go func() {
 				if err := play.StartReactApp(projectRoot); err != nil {
-					log.Printf("Failed to start React app: %v", err)
+					slog.Error("Failed to start React app", "error", err)
 				}
 			}()
 		}
@@ -78,3 +178,22 @@ func main() {
 		play.RunCLI(&cfg)
 	}
 }
+
+// setupLogging makes the default logger write to stderr at the level and in the format.
+func setupLogging(level, format string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch format {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
+	default:
+		return fmt.Errorf("invalid log format %q", format)
+	}
+	return nil
+}
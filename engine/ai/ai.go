@@ -1,28 +1,77 @@
 package ai
 
 import (
+	"context"
+	"log/slog"
 	"math"
-	"sync/atomic"
+	"sync"
+	"time"
 
 	"github.com/vpoliakov01/2v2ChessAI/engine/game"
 )
 
 // AI is the ai engine used for evaluating the position and picking the best move.
+// The configuration is shared, while the state of every search is kept separately,
+// so several searches can run on separate games at once.
 type AI struct {
 	Depth      int
 	Spread     int
 	SpreadDrop int
 
-	EvalsCount int // Populated after GetBestMove returns.
+	EvalsCount int // Populated after GetBestMove returns. GetBestMoveCtx returns it as Result.Nodes.
 	EvalLimit  int
 
-	buffers []buffer // One buffer per CPU.
+	bufferPool sync.Pool // Reusable per-search buffers ([]buffer, one buffer per CPU).
 
-	stopFlag    atomic.Bool
-	sharedAlpha atomic.Uint64
+	searchesMutex sync.Mutex
+	searches      map[*search]context.CancelFunc // Searches in flight, cancelled by Stop.
 
 	enableDebug bool
 	BestMoves   [][]BestmoveDataAvgAcc
+
+	progressInterval time.Duration    // Set by WithProgress.
+	progressReport   func(SearchInfo) // Set by WithProgress.
+
+	metrics    Metrics      // Set by WithMetrics.
+	algorithm  Algorithm    // Set by WithAlgorithm.
+	threads    int          // Set by WithThreads.
+	hashSize   int          // Set by WithHashSize.
+	pvs        bool         // Set by WithPVS.
+	ordering   MoveOrdering // Set by WithMoveOrdering.
+	pruning    Pruning      // Set by WithPruning.
+	quiescence int          // Set by WithQuiescence.
+	hanging    float64      // Set by WithHangingPieces.
+
+	ttOnce sync.Once
+	tt     *transpositionTable // Shared by the searches; see getTT.
+}
+
+// Limits bounds a single search. Zero values fall back to the AI's configuration.
+type Limits struct {
+	Depth    int           // Maximum depth to search.
+	MoveTime time.Duration // Maximum time to search (the context's deadline is honoured as well).
+	Nodes    int           // Maximum number of evaluations.
+	Infinite bool          // Deepen up to MaxDepth until the context is done.
+	MultiPV  int           // Number of best root moves to return with exact scores (at most the searched ones).
+	Clock    *Clock        // Manages the time by the clock of the player to move (see Clock.Budget).
+
+	OnIteration func(SearchInfo) // Called after every completed depth.
+}
+
+// Line is a root move with its predicted continuation.
+type Line struct {
+	Continuation []game.Move // The first element is the root move itself.
+	Score        float64
+}
+
+// Result is the outcome of a search.
+type Result struct {
+	Continuation []game.Move // The first element is the best move itself.
+	Score        float64
+	Lines        []Line // The best Limits.MultiPV lines, best first. Lines[0] is the best move's.
+	Depth        int    // The deepest completed depth.
+	Nodes        int
+	Elapsed      time.Duration
 }
 
 // New creates a new AI.
@@ -36,10 +85,21 @@ func New(depth, spread, spreadDrop, evalLimit int, options ...func(*AI)) *AI {
 		Spread:     spread,
 		SpreadDrop: spreadDrop,
 		EvalLimit:  evalLimit,
+		hashSize:   DefaultHashSize,
+		pvs:        true,
 	}
 	for _, option := range options {
 		option(ai)
 	}
+	if ai.pruning == "" {
+		ai.pruning = PruningSelective
+	}
+	if ai.ordering == "" {
+		ai.ordering = OrderingHeuristics
+		if ai.pruning == PruningSpread {
+			ai.ordering = OrderingEvaluation
+		}
+	}
 
 	if ai.enableDebug {
 		ai.InitDebug()
@@ -50,69 +110,230 @@ func New(depth, spread, spreadDrop, evalLimit int, options ...func(*AI)) *AI {
 
 // GetBestMove returns the predicted continuation up to the search depth.
 // The first element of the continuation is the best move itself.
+// It sets EvalsCount, so unlike GetBestMoveCtx it must not be called concurrently.
 func (ai *AI) GetBestMove(g *game.Game) (continuation []game.Move, score float64, err error) {
-	ai.stopFlag.Store(false)
-	ai.EvalsCount = 0
+	result, err := ai.GetBestMoveCtx(context.Background(), g, Limits{})
+	ai.EvalsCount = result.Nodes
+	return result.Continuation, result.Score, err
+}
 
+// GetBestMoveCtx searches until the limits are reached or ctx is done, and returns the result
+// of the deepest completed depth. Searches bounded by time, nodes or reporting every depth use
+// iterative deepening; the others go straight to the maximum depth, as shallower depths
+// would not speed it up.
+func (ai *AI) GetBestMoveCtx(ctx context.Context, g *game.Game, limits Limits) (Result, error) {
 	if g.HasEnded() {
-		return nil, float64(g.Winner), ErrGameEnded
+		return Result{Score: float64(g.Winner)}, ErrGameEnded
 	}
 
-	ai.initBuffers()
+	maxDepth := limits.Depth
+	if maxDepth == 0 {
+		maxDepth = ai.Depth
+		if limits.Infinite {
+			maxDepth = MaxDepth
+		}
+	}
+	maxDepth = min(maxDepth, MaxDepth)
+
+	startTime := time.Now()
+	result := Result{}
+
+	var tm *timeManager
+	multiPV := max(limits.MultiPV, 1)
+	moveTime := limits.MoveTime
+	if limits.Clock != nil {
+		budget := limits.Clock.Budget()
+		tm = newTimeManager(budget, startTime)
+		moveTime = budget.Hard
+		if moveTime > 0 && limits.MoveTime > 0 {
+			moveTime = min(moveTime, limits.MoveTime)
+		}
+	}
 
-	buffer := &ai.buffers[0]
-	forcedMateScore := 1002 - float64(ai.Depth)
-	alpha := -forcedMateScore
-	beta := forcedMateScore
-	ai.sharedAlpha.Store(math.Float64bits(alpha))
+	if moveTime > 0 { // Sets the deadline.
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, moveTime)
+		defer cancel()
+	}
 
-	moveEvals := ai.getMoveEvals(g, buffer, 1)
-	if len(moveEvals) == 0 {
-		ai.sumEvalsCounts()
-		return nil, 0, ErrNoMoves
+	s := ai.startSearch(ctx, g, maxDepth, multiPV)
+	defer ai.finishSearch(s)
+
+	ttProbes, ttHits := 0, 0
+	if ai.metrics != nil {
+		ai.metrics.SearchStarted()
+		defer func() {
+			ai.metrics.SearchFinished(SearchStats{
+				Depth:    result.Depth,
+				Nodes:    result.Nodes,
+				Elapsed:  result.Elapsed,
+				TTProbes: ttProbes,
+				TTHits:   ttHits,
+			})
+		}()
 	}
 
-	// YBW: search the highest-scored move to establish alpha
-	bestScore, bestContinuation := ai.searchRootMove(g, buffer, 0, moveEvals[0], alpha, beta)
-	alpha = math.Max(alpha, bestScore)
+	startDepth := maxDepth
+	if _, hasDeadline := ctx.Deadline(); hasDeadline || limits.Infinite || limits.Nodes > 0 || limits.OnIteration != nil {
+		startDepth = 1
+	}
 
-	// Parallel search of the remaining moves with tightened alpha
-	if alpha < beta && !ai.stopFlag.Load() && len(moveEvals) > 1 {
-		bestScore, bestContinuation = ai.searchRootMovesParallel(g, moveEvals[1:], beta, bestScore, bestContinuation)
+	for depth := startDepth; depth <= maxDepth; depth++ {
+		s.depth = depth
+		s.evalLimit = ai.EvalLimit
+		if limits.Nodes > 0 {
+			s.evalLimit = max(limits.Nodes-result.Nodes, 1)
+		}
+		s.progress.startIteration(depth)
+
+		lines, err := s.searchRoot(g, result)
+		nodes := s.sumEvalsCounts()
+		result.Nodes += nodes
+		probes, hits := s.sumTTStats()
+		ttProbes += probes
+		ttHits += hits
+
+		if err != nil {
+			result.Elapsed = time.Since(startTime)
+			s.progress.finish(result)
+			return result, err
+		}
+
+		outOfNodes := s.isOutOfEvals() || limits.Nodes > 0 && result.Nodes >= limits.Nodes
+		complete := !s.stopFlag.Load() && !outOfNodes
+		if !complete && result.Continuation != nil { // Keep the last completed depth.
+			break
+		}
+
+		result.Continuation = lines[0].Continuation
+		result.Score = lines[0].Score
+		result.Lines = lines[:min(len(lines), multiPV)]
+		result.Depth = depth
+		result.Elapsed = time.Since(startTime)
+
+		if ai.metrics != nil {
+			ai.metrics.DepthCompleted(depth, result.Elapsed)
+		}
+		if limits.OnIteration != nil {
+			limits.OnIteration(newSearchInfo(g, result, false))
+		}
+
+		if !complete {
+			break
+		}
+		if tm != nil && depth < maxDepth && tm.afterIteration(result, lines) {
+			break
+		}
 	}
 
-	ai.sumEvalsCounts()
-	return bestContinuation, bestScore, nil
+	result.Elapsed = time.Since(startTime)
+	s.progress.finish(result)
+	slog.Debug("Search finished", "moveNumber", g.MoveNumber, "player", g.ActivePlayer, "depth", result.Depth,
+		"score", result.Score, "nodes", result.Nodes, "elapsed", result.Elapsed)
+
+	return result, nil
 }
 
 // Negamax (minimax + negation) recursively finds the position
 // reached by each side picking their best move.
 // Alpha and beta params are used for alpha-beta pruning (skipping evalution
 // of branches that are guaranteed not to be picked by any of players).
-func (ai *AI) Negamax(g *game.Game, buffer *buffer, cpu, depth int, eval, alpha, beta float64) (score float64) {
+func (s *search) Negamax(g *game.Game, buffer *buffer, cpu, depth int, eval, alpha, beta float64) (score float64) {
+	ai := s.ai
 	buffer.continuation[depth] = buffer.continuation[depth][:0] // Reset the buffer.
 
+	// With OrderingHeuristics the moves are not evaluated, so the leaves are instead of eval.
+	heuristic := ai.ordering == OrderingHeuristics
+
 	// Check base cases.
 	if g.HasEnded() {
 		return float64(-1001 + depth)
 	}
-	if depth > ai.Depth {
+	if depth > buffer.depth {
+		if heuristic {
+			eval = ai.EvaluateCurrent(g, buffer)
+		}
+		if ai.quiescence > 0 {
+			return s.quiescence(g, buffer, depth, eval, alpha, beta)
+		}
 		return eval
 	}
 
-	moveEvals := ai.getMoveEvals(g, buffer, depth)
+	// Look the position up in the transposition table. The children of the root moves are
+	// left out, as their windows are tightened by the shared alpha.
+	alphaOrig := alpha
+	draft := buffer.depth - depth + 1
+	useTT := s.tt != nil && depth > 2
+	var hash uint64
+	var ttMove game.Move
+	hasTTMove := false
+	if useTT {
+		hash = g.Hash()
+		buffer.ttProbes++
+		if ttScore, data, ok := s.tt.probe(hash, depth); ok {
+			buffer.ttHits++
+			ttMove, hasTTMove = data.move, data.hasMove
+			if data.draft >= draft && (data.bound == boundExact ||
+				data.bound == boundLower && ttScore >= beta ||
+				data.bound == boundUpper && ttScore <= alpha) {
+				if hasTTMove {
+					buffer.continuation[depth] = append(buffer.continuation[depth], ttMove)
+				}
+				return ttScore
+			}
+		}
+	}
+
+	// PruningSelective spares the nodes off the principal variation (searched with null windows).
+	selective := ai.pruning == PruningSelective
+	staticEval := eval
+	futile := false
+	if selective && depth > 2 && beta-alpha <= 2*nullWindow {
+		if heuristic {
+			staticEval = ai.EvaluateCurrent(g, buffer)
+		}
+		if score, ok := s.nullMove(g, buffer, cpu, depth, draft, staticEval, beta); ok {
+			return score
+		}
+		futile = draft <= futilityDraft && staticEval+futilityMargin*float64(draft) <= alpha
+	}
+
+	var moveEvals []moveScore
+	if heuristic {
+		moveEvals = s.getOrderedMoves(g, buffer, depth)
+	} else {
+		moveEvals = s.getMoveEvals(g, buffer, depth)
+	}
 
 	// Filter promising moves to actually search.
-	moveIndexesToSearch := ai.GetMoveIndexesToSearch(g, moveEvals, depth, buffer.moveIndexesToSearch[depth][:0])
+	moveIndexesToSearch := buffer.moveIndexesToSearch[depth][:0]
+	if selective {
+		for i := range moveEvals {
+			moveIndexesToSearch = append(moveIndexesToSearch, i)
+		}
+	} else {
+		moveIndexesToSearch = ai.GetMoveIndexesToSearch(g, moveEvals, depth, moveIndexesToSearch)
+	}
 	buffer.moveIndexesToSearch[depth] = moveIndexesToSearch
 
+	// Search the best move of an earlier search of the position first.
+	if hasTTMove {
+		for k, i := range moveIndexesToSearch {
+			if moveEvals[i].move == ttMove {
+				copy(moveIndexesToSearch[1:k+1], moveIndexesToSearch[:k])
+				moveIndexesToSearch[0] = i
+				break
+			}
+		}
+	}
+
 	bestMoveIndex := moveIndexesToSearch[0]
 	bestScore := -math.MaxFloat64
 
-	for _, i := range moveIndexesToSearch {
+	for n, i := range moveIndexesToSearch {
 		// If other workers updated alpha, tighten.
 		if depth == 2 {
-			newBeta := -ai.loadSharedAlpha()
+			newBeta := -s.loadSharedAlpha()
 			beta = math.Min(beta, newBeta)
 			if alpha >= beta {
 				return alpha
@@ -121,9 +342,40 @@ func (ai *AI) Negamax(g *game.Game, buffer *buffer, cpu, depth int, eval, alpha,
 
 		move := moveEvals[i].move
 		childEval := -moveEvals[i].score
+		quiet := g.Board.IsEmpty(move.To)
 
+		if futile && n > 0 && quiet { // It can't reach alpha.
+			bestScore = math.Max(bestScore, staticEval+futilityMargin*float64(draft))
+			continue
+		}
+		reduction := 0
+		if selective && quiet {
+			reduction = lmrReduction(draft, n)
+		}
+
+		buffer.played[depth] = move
 		capturedPiece := g.Play(move)
-		opponentScore := ai.Negamax(g, buffer, cpu, depth+1, childEval, -beta, -alpha)
+		var opponentScore float64
+		if n == 0 || !ai.pvs && reduction == 0 {
+			opponentScore = s.Negamax(g, buffer, cpu, depth+1, childEval, -beta, -alpha)
+		} else {
+			// PVS: the first move is expected to be the best one, which a null window proves faster
+			// for the others. The ones that turn out better are searched again with the full window,
+			// and the reduced ones at full depth first.
+			window := beta
+			if ai.pvs {
+				window = alpha + nullWindow
+			}
+			buffer.depth -= reduction
+			opponentScore = s.Negamax(g, buffer, cpu, depth+1, childEval, -window, -alpha)
+			buffer.depth += reduction
+			if reduction > 0 && -opponentScore > alpha {
+				opponentScore = s.Negamax(g, buffer, cpu, depth+1, childEval, -window, -alpha)
+			}
+			if score := -opponentScore; window < beta && score > alpha && score < beta {
+				opponentScore = s.Negamax(g, buffer, cpu, depth+1, childEval, -beta, -alpha)
+			}
+		}
 		g.UnplayMove(move, capturedPiece)
 
 		score := -opponentScore
@@ -142,17 +394,31 @@ func (ai *AI) Negamax(g *game.Game, buffer *buffer, cpu, depth int, eval, alpha,
 			alpha = bestScore
 		}
 
-		if alpha >= beta || buffer.evalsCount >= ai.EvalLimit || ai.stopFlag.Load() {
+		if alpha >= beta && heuristic && quiet {
+			s.recordCutoff(g, buffer, depth, draft, moveEvals, moveIndexesToSearch[:n+1], i)
+		}
+		if alpha >= beta || buffer.evalsCount >= s.evalLimit || s.stopped(buffer) {
 			break
 		}
 	}
 
-	if ai.enableDebug {
+	// Results cut short by the limits are not stored.
+	if useTT && buffer.evalsCount < s.evalLimit && !s.stopped(buffer) {
+		bound := boundExact
+		if bestScore <= alphaOrig {
+			bound = boundUpper
+		} else if bestScore >= beta {
+			bound = boundLower
+		}
+		s.tt.store(hash, depth, bestScore, ttData{draft: draft, bound: bound, move: moveEvals[bestMoveIndex].move, hasMove: true})
+	}
+
+	if ai.enableDebug && buffer.helping == nil {
 		ai.recordBestMove(BestMoveData{
 			Depth:      depth,
 			MoveIndex:  bestMoveIndex,
 			TotalMoves: len(moveEvals),
-			ScoreDelta: moveEvals[bestMoveIndex].score - moveEvals[0].score,
+			ScoreDelta: moveEvals[bestMoveIndex].score - moveEvals[moveIndexesToSearch[0]].score, // Both searched.
 		}, cpu)
 	}
 
@@ -163,24 +429,38 @@ func (ai *AI) Negamax(g *game.Game, buffer *buffer, cpu, depth int, eval, alpha,
 // Increments the worker's per-buffer eval count to avoid the shared-counter cache-line contention under parallel search.
 func (ai *AI) EvaluateCurrent(g *game.Game, buffer *buffer) float64 {
 	buffer.evalsCount++
-	playerStrengths := [4]float64{}
+	if buffer.evalsCount&progressNodesMask == 0 {
+		buffer.progress.addNodes(progressNodesBatch)
+	}
 
 	if g.HasEnded() {
 		return float64(g.ActivePlayer.Team()*g.Winner) * 1000
 	}
 
+	playerStrengths := playerStrengths(g)
+	redYellowStrength := playerStrengths[0] + playerStrengths[2] - math.Abs(playerStrengths[0]-playerStrengths[2])/3
+	blueGreenStrength := playerStrengths[1] + playerStrengths[3] - math.Abs(playerStrengths[1]-playerStrengths[3])/3
+
+	score := float64(g.ActivePlayer.Team()) * (redYellowStrength - blueGreenStrength)
+	if ai.hanging > 0 {
+		score += ai.hanging * g.Board.HangingValue(g.ActivePlayer)
+	}
+	return score
+}
+
+// playerStrengths returns the strength of every player's pieces.
+func playerStrengths(g *game.Game) [4]float64 {
+	strengths := [4]float64{}
+
 	// For each piece, run piece strength evaluation.
 	for player := range g.Board.PieceSquares {
 		for square := range g.Board.PieceSquares[player] {
 			piece := g.Board.GetPiece(square)
-			playerStrengths[player] += piece.GetStrength(g.Board, square, player)
+			strengths[player] += piece.GetStrength(g.Board, square, player)
 		}
 	}
 
-	redYellowStrength := playerStrengths[0] + playerStrengths[2] - math.Abs(playerStrengths[0]-playerStrengths[2])/3
-	blueGreenStrength := playerStrengths[1] + playerStrengths[3] - math.Abs(playerStrengths[1]-playerStrengths[3])/3
-
-	return float64(g.ActivePlayer.Team()) * (redYellowStrength - blueGreenStrength)
+	return strengths
 }
 
 // GetMoveIndexesToSearch appends the indexes of moves worth searching to dst and returns the extended slice.
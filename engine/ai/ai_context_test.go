@@ -0,0 +1,104 @@
+package ai_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/vpoliakov01/2v2ChessAI/engine/ai"
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+func (s *TestSuite) TestGetBestMoveCtxDeadline() {
+	r := s.Require()
+	engine := New(DefaultDepth, DefaultSpread, DefaultSpreadDrop, 0)
+	g := s.GetGame("Wild midgame")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	startTime := time.Now()
+	result, err := engine.GetBestMoveCtx(ctx, g.Game, Limits{Infinite: true})
+	r.NoError(err)
+
+	r.Less(time.Since(startTime), time.Second, "the search should stop soon after the deadline")
+	r.GreaterOrEqual(result.Depth, 1)
+	r.Less(result.Depth, MaxDepth)
+	r.NotEmpty(result.Continuation)
+	r.NoError(g.ValidateMove(&result.Continuation[0]))
+}
+
+func (s *TestSuite) TestGetBestMoveCtxLimits() {
+	r := s.Require()
+	engine := New(DefaultDepth, DefaultSpread, DefaultSpreadDrop, 0)
+	g := s.GetGame("Free queen (a7-b6)")
+
+	depths := []int{}
+	result, err := engine.GetBestMoveCtx(context.Background(), g.Game, Limits{
+		Depth:       4,
+		OnIteration: func(info SearchInfo) { depths = append(depths, info.Depth) },
+	})
+	r.NoError(err)
+	r.Equal([]int{1, 2, 3, 4}, depths)
+	r.Equal(4, result.Depth)
+	r.Equal(g.bestMove.String(), result.Continuation[0].String())
+
+	result, err = engine.GetBestMoveCtx(context.Background(), g.Game, Limits{Depth: MaxDepth, Nodes: 5000})
+	r.NoError(err)
+	r.Less(result.Depth, MaxDepth)
+	r.NotEmpty(result.Continuation)
+}
+
+func (s *TestSuite) TestStopOnlyAffectsSearchesInFlight() {
+	r := s.Require()
+	engine := New(6, DefaultSpread, DefaultSpreadDrop, 0)
+	g := s.GetGame("Free queen (a7-b6)")
+
+	engine.Stop() // Must not leak into the next search.
+	result, err := engine.GetBestMoveCtx(context.Background(), g.Game, Limits{})
+	r.NoError(err)
+	r.Equal(6, result.Depth)
+
+	done := make(chan Result)
+	go func() {
+		result, _ := engine.GetBestMoveCtx(context.Background(), g.Game.Copy(), Limits{Infinite: true})
+		done <- result
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	engine.Stop()
+
+	select {
+	case result := <-done:
+		r.NotEmpty(result.Continuation)
+	case <-time.After(5 * time.Second):
+		r.Fail("Stop did not stop the search in flight")
+	}
+}
+
+func (s *TestSuite) TestConcurrentSearches() {
+	r := s.Require()
+	engine := New(6, DefaultSpread, DefaultSpreadDrop, 0)
+
+	results := make([]Result, len(s.solvedGames))
+	var wg sync.WaitGroup
+	for i, gt := range s.solvedGames {
+		wg.Add(1)
+		go func(i int, g *game.Game) {
+			defer wg.Done()
+			results[i], _ = engine.GetBestMoveCtx(context.Background(), g, Limits{})
+		}(i, gt.Copy().Game)
+	}
+	wg.Wait()
+
+	for i, gt := range s.solvedGames {
+		r.Equal(6, results[i].Depth, gt.name)
+		if gt.name == "Mate in 7 (g1-m7)" || gt.name == "3 queens, mate in 6 (j4-m7)" {
+			continue // Too deep for depth 6.
+		}
+		r.Equal(gt.bestMove.String(), results[i].Continuation[0].String(), gt.name)
+		if gt.score != nil {
+			r.Equal(*gt.score, results[i].Score, gt.name)
+		}
+	}
+}
@@ -29,6 +29,10 @@ func (ai *AI) InitDebug() {
 
 // recordBestMove updates per-depth move-ordering analytics.
 func (ai *AI) recordBestMove(data BestMoveData, cpu int) {
+	if data.Depth >= len(ai.BestMoves[cpu]) { // Searched deeper than ai.Depth via Limits.
+		return
+	}
+
 	acc := &ai.BestMoves[cpu][data.Depth]
 	acc.Count++
 	acc.IndexSum += data.MoveIndex
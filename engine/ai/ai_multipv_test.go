@@ -0,0 +1,41 @@
+package ai_test
+
+import (
+	"context"
+
+	. "github.com/vpoliakov01/2v2ChessAI/engine/ai"
+)
+
+func (s *TestSuite) TestMultiPV() {
+	r := s.Require()
+	engine := New(4, DefaultSpread, DefaultSpreadDrop, 0)
+	g := s.GetGame("Free queen (a7-b6)")
+
+	var lastInfo SearchInfo
+	result, err := engine.GetBestMoveCtx(context.Background(), g.Game, Limits{
+		MultiPV:     3,
+		OnIteration: func(info SearchInfo) { lastInfo = info },
+	})
+	r.NoError(err)
+	r.Len(result.Lines, 3)
+	r.Equal(result.Lines, lastInfo.Lines)
+
+	r.Equal(g.bestMove.String(), result.Lines[0].Continuation[0].String())
+	r.Equal(result.Continuation, result.Lines[0].Continuation)
+	r.Equal(result.Score, result.Lines[0].Score)
+
+	rootMoves := map[string]bool{}
+	for i, line := range result.Lines {
+		r.NoError(g.ValidateMove(&line.Continuation[0]))
+		rootMoves[line.Continuation[0].String()] = true
+
+		if i > 0 {
+			r.LessOrEqual(line.Score, result.Lines[i-1].Score, "lines must be sorted by score")
+		}
+	}
+	r.Len(rootMoves, 3, "lines must start with different moves")
+
+	result, err = engine.GetBestMoveCtx(context.Background(), g.Game, Limits{})
+	r.NoError(err)
+	r.Len(result.Lines, 1)
+}
@@ -10,31 +10,34 @@ import (
 	. "github.com/vpoliakov01/2v2ChessAI/engine/ai"
 )
 
+// TestMultithreading reports the time, the speedup and the nodes of a search by the number of threads.
 func (s *TestSuite) TestMultithreading() {
+	r := s.Require()
 	maxCPUs := runtime.NumCPU()
-	moves := 1
-	engine := New(12, DefaultSpread, DefaultSpreadDrop, 0)
 
 	fmt.Printf("Testing with %v CPUs\n", maxCPUs)
-	for i := 0; true; i++ {
-		cpus := int(math.Min(math.Pow(2, float64(i)), float64(maxCPUs)))
-		runtime.GOMAXPROCS(cpus)
-		startTime := time.Now()
+	fmt.Printf("%7v %10v %8v %12v %8v\n", "threads", "time", "speedup", "nodes", "tt hits")
 
+	var baseline time.Duration
+	for threads := 1; ; threads = min(threads*2, maxCPUs) {
+		stats := NewStats()
+		engine := New(12, DefaultSpread, DefaultSpreadDrop, 0, WithThreads(threads), WithMetrics(stats))
 		g := s.GetGame("Free queen (a7-b6)")
 
-		for i := 0; i < moves; i++ {
-			continuation, _, err := engine.GetBestMove(g.Game)
-			if err != nil {
-				fmt.Println(err)
-				break
-			}
-			g.Play(continuation[0])
-		}
+		startTime := time.Now()
+		continuation, _, err := engine.GetBestMove(g.Game)
+		elapsed := time.Since(startTime)
+		r.NoError(err)
+		r.Equal(g.bestMove.String(), continuation[0].String(), "%v threads", threads)
 
-		fmt.Printf("%2d CPU: %v\n", cpus, time.Since(startTime))
+		if threads == 1 {
+			baseline = elapsed
+		}
+		snapshot := stats.Snapshot()
+		fmt.Printf("%7v %10v %7.2fx %12v %7.1f%%\n", threads, elapsed.Round(time.Millisecond),
+			float64(baseline)/float64(elapsed), snapshot.Nodes, 100*snapshot.TTHitRate())
 
-		if cpus >= maxCPUs {
+		if threads >= maxCPUs {
 			break
 		}
 	}
@@ -0,0 +1,46 @@
+package ai_test
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/vpoliakov01/2v2ChessAI/engine/ai"
+)
+
+func (s *TestSuite) TestProgress() {
+	r := s.Require()
+
+	var mu sync.Mutex
+	infos := []SearchInfo{}
+	engine := New(8, DefaultSpread, DefaultSpreadDrop, 0, WithProgress(time.Millisecond, func(info SearchInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		infos = append(infos, info)
+	}))
+
+	g := s.GetGame("Free queen (a7-b6)")
+	continuation, score, err := engine.GetBestMove(g.Game)
+	r.NoError(err)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	r.NotEmpty(infos)
+	for i, info := range infos {
+		r.LessOrEqual(info.Depth, 8)
+		r.Equal(g.MoveNumber, info.MoveNumber)
+		r.Equal(g.ActivePlayer, info.Player)
+		r.Equal(i == len(infos)-1, info.Final, "only the last report is final")
+		if i > 0 {
+			r.GreaterOrEqual(info.Depth, infos[i-1].Depth)
+			r.GreaterOrEqual(info.Nodes, infos[i-1].Nodes)
+			r.GreaterOrEqual(info.Elapsed, infos[i-1].Elapsed)
+		}
+	}
+
+	final := infos[len(infos)-1]
+	r.Equal(continuation, final.Continuation)
+	r.Equal(score, final.Score)
+	r.Equal(8, final.Depth)
+	r.Equal(engine.EvalsCount, final.Nodes)
+}
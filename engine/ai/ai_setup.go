@@ -2,8 +2,6 @@ package ai
 
 import (
 	"errors"
-	"fmt"
-	"math"
 	"runtime"
 
 	"github.com/vpoliakov01/2v2ChessAI/engine/game"
@@ -11,6 +9,7 @@ import (
 
 var (
 	MaxEvalLimit = int(1e12)
+	MaxDepth     = 64
 	ErrGameEnded = errors.New("the game has ended")
 	ErrNoMoves   = errors.New("no move can be made in this position")
 	cpus         = runtime.NumCPU()
@@ -26,10 +25,6 @@ type moveScore struct {
 	score float64
 }
 
-func init() {
-	fmt.Printf("Running on %v CPUs (GOMAXPROCS=%v)\n", cpus, runtime.GOMAXPROCS(0))
-}
-
 // WithEnableDebug enables debug analytics.
 func WithEnableDebug(enableDebug bool) func(*AI) {
 	return func(ai *AI) {
@@ -37,34 +32,28 @@ func WithEnableDebug(enableDebug bool) func(*AI) {
 	}
 }
 
-// Stop stops the engine.
-func (ai *AI) Stop() {
-	ai.stopFlag.Store(true)
-}
-
-// loadSharedAlpha returns the current shared root-level alpha as float64.
-func (ai *AI) loadSharedAlpha() float64 {
-	return math.Float64frombits(ai.sharedAlpha.Load())
+// WithThreads makes the engine search on at most the given number of threads
+// (all CPUs if 0, or if more).
+func WithThreads(threads int) func(*AI) {
+	return func(ai *AI) {
+		ai.threads = threads
+	}
 }
 
-// raiseSharedAlpha atomically lifts the shared alpha to candidate if candidate is greater.
-func (ai *AI) raiseSharedAlpha(candidate float64) {
-	for { // Retry until success in case it's overwritten by another worker.
-		current := ai.sharedAlpha.Load()
-		if candidate <= math.Float64frombits(current) {
-			return
-		}
-		if ai.sharedAlpha.CompareAndSwap(current, math.Float64bits(candidate)) {
-			return
-		}
+// workers returns the number of threads a search runs on.
+func (ai *AI) workers() int {
+	if ai.threads > 0 {
+		return min(ai.threads, cpus)
 	}
+	return cpus
 }
 
-// sumEvalsCounts aggregates per-worker eval counts into ai.EvalsCount for external telemetry.
-func (ai *AI) sumEvalsCounts() {
-	total := 0
-	for i := range ai.buffers {
-		total += ai.buffers[i].evalsCount
+// Stop stops all the searches in flight. Searches started afterwards are not affected.
+func (ai *AI) Stop() {
+	ai.searchesMutex.Lock()
+	defer ai.searchesMutex.Unlock()
+
+	for _, cancel := range ai.searches {
+		cancel()
 	}
-	ai.EvalsCount = total
 }
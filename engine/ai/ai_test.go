@@ -1,6 +1,7 @@
 package ai_test
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -22,12 +23,14 @@ type GameTest struct {
 	name     string
 	bestMove *game.Move
 	score    *float64
+	mate     int // The plies to the capture of a king, if the best move forces one.
 }
 
 type test struct {
 	name     string
 	bestMove string
 	score    float64
+	mate     int
 	pgn      string
 }
 
@@ -37,12 +40,14 @@ func Test(t *testing.T) {
 
 func (s *TestSuite) SetupTest() {
 	s.engine = New(DefaultDepth, DefaultSpread, DefaultSpreadDrop, 0, WithEnableDebug(true))
+	s.solvedGames, s.openGames = nil, nil // The suite is reused by the tests.
 
 	games := []test{
 		{
 			name:     "Mate in 1 (g1-a7)",
 			bestMove: "g1-a7",
 			score:    999,
+			mate:     1,
 			pgn: `
 1. f2-f3 b6-c6 g13-g12 m8-l8`,
 		},
@@ -50,6 +55,7 @@ func (s *TestSuite) SetupTest() {
 			name:     "Mate in 1 (m9-n8)",
 			bestMove: "m9-n8",
 			score:    999,
+			mate:     1,
 			pgn: `
 1. h2-h3 b8-c8 i13-i12 m8-l8
 2. g1-m7 a9-i1 h14-m9 n7-m7
@@ -65,12 +71,14 @@ func (s *TestSuite) SetupTest() {
 		{
 			name:     "Mate in 7 (g1-m7)",
 			bestMove: "g1-m7",
+			mate:     7,
 			pgn: `
 1. h2-h3 b8-c8 i13-i12 m8-l8`,
 		},
 		{
 			name:     "3 queens, mate in 6 (j4-m7)",
 			bestMove: "j4-m7",
+			mate:     7,
 			pgn: `
 1. h2-h3 b9-c9 i13-i12 m8-l8
 2. g1-j4 a8-d11 e13-e12 m5-l5
@@ -115,7 +123,7 @@ func (s *TestSuite) SetupTest() {
 		g, err := game.LoadPGN(tg.pgn)
 		s.Require().NoError(err)
 
-		gt := &GameTest{Game: g.Game, name: tg.name}
+		gt := &GameTest{Game: g.Game, name: tg.name, mate: tg.mate}
 		if tg.score != 0 {
 			gt.score = &tg.score
 		}
@@ -136,6 +144,7 @@ func (gt *GameTest) Copy() *GameTest {
 		name:     gt.name,
 		bestMove: gt.bestMove,
 		score:    gt.score,
+		mate:     gt.mate,
 	}
 }
 
@@ -148,6 +157,22 @@ func (s *TestSuite) GetGame(name string) *GameTest {
 	return nil
 }
 
+// requireSolved checks that the engine finds the best moves of the solved positions, with the
+// scores of their mates, by iterative deepening.
+func (s *TestSuite) requireSolved(engine *AI, name string) {
+	r := s.Require()
+	limits := Limits{OnIteration: func(SearchInfo) {}}
+
+	for _, gt := range s.solvedGames {
+		result, err := engine.GetBestMoveCtx(context.Background(), gt.Game.Copy(), limits)
+		r.NoError(err)
+		r.Equal(gt.bestMove.String(), result.Continuation[0].String(), "%v: %v", name, gt.name)
+		if gt.mate != 0 {
+			r.Equal(1000-float64(gt.mate), result.Score, "%v: %v", name, gt.name) // Capturing a king scores 1000.
+		}
+	}
+}
+
 func (gt *GameTest) Print(score float64, continuation []game.Move) {
 	fmt.Println(gt.name)
 	fmt.Printf("Continuation: %v %.2f\n", continuation, score)
@@ -0,0 +1,59 @@
+package ai_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/vpoliakov01/2v2ChessAI/engine/ai"
+)
+
+func (s *TestSuite) TestClockBudget() {
+	r := s.Require()
+
+	budget := Clock{Remaining: 40 * time.Second}.Budget()
+	r.InDelta(time.Second, budget.Soft, float64(10*time.Millisecond))
+	r.Equal(4*budget.Soft, budget.Hard)
+
+	withIncrement := Clock{Remaining: 40 * time.Second, Increment: 2 * time.Second}.Budget()
+	r.Greater(withIncrement.Soft, budget.Soft)
+
+	later := Clock{Remaining: 40 * time.Second, MovesPlayed: 60}.Budget()
+	r.Greater(later.Soft, budget.Soft, "fewer moves are left to budget for")
+
+	short := Clock{Remaining: 300 * time.Millisecond, Increment: time.Second}.Budget()
+	r.Less(short.Hard, 300*time.Millisecond, "a move must not flag even with an increment")
+	r.LessOrEqual(short.Soft, short.Hard)
+}
+
+func (s *TestSuite) TestGetBestMoveCtxClock() {
+	r := s.Require()
+	engine := New(MaxDepth, DefaultSpread, DefaultSpreadDrop, 0)
+	g := s.GetGame("Wild midgame")
+
+	clock := Clock{Remaining: 4 * time.Second}
+	startTime := time.Now()
+	result, err := engine.GetBestMoveCtx(context.Background(), g.Game, Limits{Clock: &clock})
+	r.NoError(err)
+
+	r.Less(time.Since(startTime), clock.Budget().Hard+200*time.Millisecond, "the hard limit must hold")
+	r.Len(result.Lines, 1, "the lines the time manager needs are not returned")
+	r.NoError(g.ValidateMove(&result.Continuation[0]))
+}
+
+// TestSearchRootSecondLine checks that the root search gives the time manager the second line
+// without scoring it exactly, so that a clocked search still uses aspiration windows.
+func (s *TestSuite) TestSearchRootSecondLine() {
+	r := s.Require()
+	engine := New(4, DefaultSpread, DefaultSpreadDrop, 0)
+	g := s.GetGame("Wild midgame")
+
+	previous, err := engine.GetBestMoveCtx(context.Background(), g.Game.Copy(), Limits{Depth: 3})
+	r.NoError(err)
+
+	lines, aspirated, err := engine.SearchRoot(g.Game.Copy(), 4, 1, previous)
+	r.NoError(err)
+	r.True(aspirated)
+	r.Len(lines, 2)
+	r.LessOrEqual(lines[1].Score, lines[0].Score)
+	r.NotEqual(lines[0].Continuation[0], lines[1].Continuation[0])
+}
@@ -0,0 +1,341 @@
+package ai
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+// Algorithm is the model of the four players' play that the search assumes.
+type Algorithm string
+
+const (
+	// AlgorithmNegamax assumes that every player maximizes its team's score, so the score
+	// is negated every ply. The default.
+	AlgorithmNegamax Algorithm = "negamax"
+	// AlgorithmParanoid assumes that the other three players, the partner included,
+	// minimize the root team's score.
+	AlgorithmParanoid Algorithm = "paranoid"
+	// AlgorithmMaxN assumes that every player maximizes its own score of a per-player
+	// score vector, regardless of the teams. It cannot prune.
+	AlgorithmMaxN Algorithm = "maxn"
+	// AlgorithmBRS is Best-Reply Search: after every move of the root player, only the
+	// strongest reply of either opponent is played, while the other players pass.
+	AlgorithmBRS Algorithm = "brs"
+)
+
+// Algorithms are the available algorithms.
+var Algorithms = []Algorithm{AlgorithmNegamax, AlgorithmParanoid, AlgorithmMaxN, AlgorithmBRS}
+
+// ParseAlgorithm parses the name of an algorithm. The empty name is AlgorithmNegamax.
+func ParseAlgorithm(name string) (Algorithm, error) {
+	if name == "" {
+		return AlgorithmNegamax, nil
+	}
+	if !slices.Contains(Algorithms, Algorithm(name)) {
+		return "", fmt.Errorf("unknown algorithm %q (expected one of %v)", name, Algorithms)
+	}
+	return Algorithm(name), nil
+}
+
+// WithAlgorithm makes the engine search with the algorithm.
+func WithAlgorithm(algorithm Algorithm) func(*AI) {
+	return func(ai *AI) {
+		ai.algorithm = algorithm
+	}
+}
+
+// endScore returns the score of an ended game for the side to move, which is the root
+// team's side if rootSide. Faster wins score higher.
+func (s *search) endScore(g *game.Game, depth int, rootSide bool) float64 {
+	if g.Winner == 0 {
+		return 0
+	}
+	if (g.Winner == s.root.Team()) == rootSide {
+		return float64(1001 - depth)
+	}
+	return float64(-1001 + depth)
+}
+
+// isRootSide returns whether the player is on the root player's side in the paranoid model.
+func (s *search) isRootSide(player game.Player) bool {
+	return player == s.root
+}
+
+// paranoid is Negamax for AlgorithmParanoid: the root player against the coalition of the
+// other three. Scores are the root team's score from the point of view of the side to move,
+// so they are only negated when the side to move changes.
+func (s *search) paranoid(g *game.Game, buffer *buffer, cpu, depth int, eval, alpha, beta float64) float64 {
+	buffer.continuation[depth] = buffer.continuation[depth][:0]
+
+	mover := g.ActivePlayer
+	rootSide := s.isRootSide(mover)
+	if g.HasEnded() {
+		return s.endScore(g, depth, rootSide)
+	}
+	if depth > buffer.depth {
+		return eval
+	}
+
+	// The moves are scored for the mover's team; the partner of the root player minimizes it.
+	moveEvals := s.getMoveEvals(g, buffer, depth)
+	if !rootSide && mover.IsTeamMate(s.root) {
+		for i := range moveEvals {
+			moveEvals[i].score = -moveEvals[i].score
+		}
+		slices.Reverse(moveEvals)
+	}
+
+	moveIndexesToSearch := s.ai.GetMoveIndexesToSearch(g, moveEvals, depth, buffer.moveIndexesToSearch[depth][:0])
+	buffer.moveIndexesToSearch[depth] = moveIndexesToSearch
+	if len(moveIndexesToSearch) == 0 {
+		return eval
+	}
+
+	nextRootSide := s.isRootSide((mover + 1) % 4)
+	bestScore := -math.MaxFloat64
+
+	for _, i := range moveIndexesToSearch {
+		if depth == 2 { // See Negamax.
+			beta = math.Min(beta, -s.loadSharedAlpha())
+			if alpha >= beta {
+				return alpha
+			}
+		}
+
+		move := moveEvals[i].move
+		childEval := moveEvals[i].score
+
+		var score float64
+		capturedPiece := g.Play(move)
+		if nextRootSide == rootSide {
+			score = s.paranoid(g, buffer, cpu, depth+1, childEval, alpha, beta)
+		} else {
+			score = -s.paranoid(g, buffer, cpu, depth+1, -childEval, -beta, -alpha)
+		}
+		g.UnplayMove(move, capturedPiece)
+
+		if score > bestScore {
+			bestScore = score
+
+			continuation := buffer.continuation[depth][:0]
+			continuation = append(continuation, move)
+			buffer.continuation[depth] = append(continuation, buffer.continuation[depth+1]...)
+		}
+
+		alpha = math.Max(alpha, bestScore)
+		if alpha >= beta || buffer.evalsCount >= s.evalLimit || s.stopped(buffer) {
+			break
+		}
+	}
+
+	return bestScore
+}
+
+// brs is Negamax for AlgorithmBRS. The root player's nodes alternate with the opponents'
+// nodes, which hold the moves of both opponents; the replies are played out of turn, and
+// the root player moves next whoever replied.
+func (s *search) brs(g *game.Game, buffer *buffer, cpu, depth int, eval, alpha, beta float64) float64 {
+	buffer.continuation[depth] = buffer.continuation[depth][:0]
+
+	if g.HasEnded() {
+		return float64(-1001 + depth)
+	}
+	if depth > buffer.depth {
+		return eval
+	}
+
+	rootToMove := g.ActivePlayer == s.root
+	var moveEvals []moveScore
+	if rootToMove {
+		moveEvals = s.getMoveEvals(g, buffer, depth)
+	} else {
+		moveEvals = s.getReplyEvals(g, buffer, depth)
+	}
+
+	moveIndexesToSearch := s.ai.GetMoveIndexesToSearch(g, moveEvals, depth, buffer.moveIndexesToSearch[depth][:0])
+	buffer.moveIndexesToSearch[depth] = moveIndexesToSearch
+	if len(moveIndexesToSearch) == 0 {
+		return eval
+	}
+
+	bestScore := -math.MaxFloat64
+
+	for _, i := range moveIndexesToSearch {
+		if depth == 2 { // See Negamax.
+			beta = math.Min(beta, -s.loadSharedAlpha())
+			if alpha >= beta {
+				return alpha
+			}
+		}
+
+		move := moveEvals[i].move
+		childEval := -moveEvals[i].score
+
+		var opponentScore float64
+		if rootToMove {
+			capturedPiece := g.Play(move)
+			opponentScore = s.brs(g, buffer, cpu, depth+1, childEval, -beta, -alpha)
+			g.UnplayMove(move, capturedPiece)
+		} else {
+			capturedPiece := s.playReply(g, move)
+			opponentScore = s.brs(g, buffer, cpu, depth+1, childEval, -beta, -alpha)
+			s.unplayReply(g, move, capturedPiece)
+		}
+
+		score := -opponentScore
+		if score > bestScore {
+			bestScore = score
+
+			continuation := buffer.continuation[depth][:0]
+			continuation = append(continuation, move)
+			buffer.continuation[depth] = append(continuation, buffer.continuation[depth+1]...)
+		}
+
+		alpha = math.Max(alpha, bestScore)
+		if alpha >= beta || buffer.evalsCount >= s.evalLimit || s.stopped(buffer) {
+			break
+		}
+	}
+
+	return bestScore
+}
+
+// opponents returns the opponents of the root player, the next player first.
+func (s *search) opponents() [2]game.Player {
+	return [2]game.Player{(s.root + 1) % 4, (s.root + 3) % 4}
+}
+
+// getReplyEvals returns the moves of both opponents of the root player sorted by 1-ply
+// evaluation, for the opponents' node of BRS (the next player is to move there).
+func (s *search) getReplyEvals(g *game.Game, buffer *buffer, depth int) []moveScore {
+	moves := buffer.moves[depth][:0]
+	for _, opponent := range s.opponents() {
+		g.ActivePlayer = opponent
+		moves = g.GetMoves(moves)
+	}
+	g.ActivePlayer = s.opponents()[0]
+	buffer.moves[depth] = moves
+
+	if cap(buffer.moveEvals[depth]) < len(moves) { // Both opponents may have more than MovesUpperBound.
+		buffer.moveEvals[depth] = make([]moveScore, 0, len(moves))
+	}
+	moveEvals := buffer.moveEvals[depth][:len(moves)]
+	for i := range moves {
+		capturedPiece := s.playReply(g, moves[i])
+		moveEvals[i] = moveScore{moves[i], -s.ai.EvaluateCurrent(g, buffer)}
+		s.unplayReply(g, moves[i], capturedPiece)
+	}
+	buffer.moveEvals[depth] = moveEvals
+
+	slices.SortFunc(moveEvals, func(a, b moveScore) int {
+		return cmp.Compare(b.score, a.score)
+	})
+
+	return moveEvals
+}
+
+// playReply plays the move of an opponent of the root player out of turn, and gives
+// the move to the root player.
+func (s *search) playReply(g *game.Game, move game.Move) game.Piece {
+	g.ActivePlayer = game.Piece(g.Board.GetPiece(move.From)).Player()
+	capturedPiece := g.Play(move)
+	g.ActivePlayer = s.root
+	return capturedPiece
+}
+
+// unplayReply undoes playReply.
+func (s *search) unplayReply(g *game.Game, move game.Move, capturedPiece game.Piece) {
+	g.ActivePlayer = (game.Piece(g.Board.GetPiece(move.To)).Player() + 1) % 4
+	g.UnplayMove(move, capturedPiece)
+	g.ActivePlayer = s.opponents()[0]
+}
+
+// maxN is the search of AlgorithmMaxN. It returns the score vector of the position that
+// is reached if every player picks the move that is best for itself.
+func (s *search) maxN(g *game.Game, buffer *buffer, cpu, depth int) [4]float64 {
+	buffer.continuation[depth] = buffer.continuation[depth][:0]
+
+	if g.HasEnded() {
+		return endUtilities(g, depth)
+	}
+	if depth > buffer.depth {
+		return s.ai.evaluatePlayers(g, buffer)
+	}
+
+	moveEvals := s.getMoveEvals(g, buffer, depth)
+	moveIndexesToSearch := s.ai.GetMoveIndexesToSearch(g, moveEvals, depth, buffer.moveIndexesToSearch[depth][:0])
+	buffer.moveIndexesToSearch[depth] = moveIndexesToSearch
+	if len(moveIndexesToSearch) == 0 {
+		return s.ai.evaluatePlayers(g, buffer)
+	}
+
+	mover := g.ActivePlayer
+	var best [4]float64
+
+	for n, i := range moveIndexesToSearch {
+		move := moveEvals[i].move
+
+		capturedPiece := g.Play(move)
+		scores := s.maxN(g, buffer, cpu, depth+1)
+		g.UnplayMove(move, capturedPiece)
+
+		if n == 0 || scores[mover] > best[mover] {
+			best = scores
+
+			continuation := buffer.continuation[depth][:0]
+			continuation = append(continuation, move)
+			buffer.continuation[depth] = append(continuation, buffer.continuation[depth+1]...)
+		}
+
+		if buffer.evalsCount >= s.evalLimit || s.stopped(buffer) {
+			break
+		}
+	}
+
+	return best
+}
+
+// evaluatePlayers returns the score vector of the position for AlgorithmMaxN: every player's
+// strength less the average strength of the other players.
+func (ai *AI) evaluatePlayers(g *game.Game, buffer *buffer) [4]float64 {
+	buffer.evalsCount++
+	if buffer.evalsCount&progressNodesMask == 0 {
+		buffer.progress.addNodes(progressNodesBatch)
+	}
+	if g.HasEnded() {
+		return endUtilities(g, 0)
+	}
+
+	strengths := playerStrengths(g)
+	total := strengths[0] + strengths[1] + strengths[2] + strengths[3]
+
+	scores := [4]float64{}
+	for player, strength := range strengths {
+		scores[player] = strength - (total-strength)/3
+	}
+	return scores
+}
+
+// endUtilities returns the score vector of an ended game. They add up to the same team
+// score as a mate of the other algorithms (see teamScore).
+func endUtilities(g *game.Game, depth int) [4]float64 {
+	scores := [4]float64{}
+	if g.Winner == 0 {
+		return scores
+	}
+	for player := range scores {
+		scores[player] = float64(g.Winner*game.Player(player).Team()) * float64(1001-depth) / 3
+	}
+	return scores
+}
+
+// teamScore returns the score of the player's team from a score vector of AlgorithmMaxN,
+// on the scale of EvaluateCurrent.
+func teamScore(scores [4]float64, player game.Player) float64 {
+	partner := (player + 2) % 4
+	return (scores[player] + scores[partner] - scores[(player+1)%4] - scores[(player+3)%4]) * 3 / 4
+}
@@ -0,0 +1,140 @@
+package ai_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/vpoliakov01/2v2ChessAI/engine/ai"
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+func (s *TestSuite) TestAlgorithms() {
+	r := s.Require()
+
+	for _, algorithm := range Algorithms {
+		engine := New(4, DefaultSpread, DefaultSpreadDrop, 0, WithAlgorithm(algorithm))
+
+		for _, name := range []string{"Mate in 1 (g1-a7)", "Mate in 1 (m9-n8)", "Free queen (a7-b6)"} {
+			gt := s.GetGame(name)
+			g := gt.Game.Copy()
+
+			continuation, score, err := engine.GetBestMove(g)
+			r.NoError(err)
+			r.Equal(gt.bestMove.String(), continuation[0].String(), "%v: %v", algorithm, name)
+			if gt.score != nil { // A mate.
+				r.Greater(score, 900.0, "%v: %v", algorithm, name)
+			}
+			r.Equal(gt.Game.FEN(), g.FEN(), "%v must leave the game as it was", algorithm)
+		}
+	}
+
+	algorithm, err := ParseAlgorithm("")
+	r.NoError(err)
+	r.Equal(AlgorithmNegamax, algorithm)
+	_, err = ParseAlgorithm("minimax")
+	r.Error(err)
+}
+
+// TestAlgorithmsPerformance compares the nodes and time the algorithms take on the open games.
+func (s *TestSuite) TestAlgorithmsPerformance() {
+	r := s.Require()
+	depth := 4
+
+	fmt.Printf("%-10v %12v %10v %10v\n", "algorithm", "nodes", "time", "µs/node")
+	for _, algorithm := range Algorithms {
+		engine := New(depth, DefaultSpread, DefaultSpreadDrop, 0, WithAlgorithm(algorithm))
+
+		nodes := 0
+		start := time.Now()
+		for _, gt := range s.openGames {
+			result, err := engine.GetBestMoveCtx(context.Background(), gt.Game.Copy(), Limits{})
+			r.NoError(err)
+			r.Equal(depth, result.Depth)
+			nodes += result.Nodes
+		}
+		elapsed := time.Since(start)
+
+		fmt.Printf("%-10v %12v %9.2fs %10.2f\n", algorithm, nodes, elapsed.Seconds(), float64(elapsed.Microseconds())/float64(nodes))
+	}
+}
+
+// TestAlgorithmsMatch plays the algorithms against each other: every algorithm plays both
+// teams against every other one from the open games, for a few moves, and is scored by the
+// default evaluation of the reached positions.
+func (s *TestSuite) TestAlgorithmsMatch() {
+	r := s.Require()
+	depth, moves := 3, 6
+
+	engines := map[Algorithm]*AI{}
+	for _, algorithm := range Algorithms {
+		engines[algorithm] = New(depth, DefaultSpread, DefaultSpreadDrop, 0, WithAlgorithm(algorithm))
+	}
+	judge := New(1, DefaultSpread, DefaultSpreadDrop, 0)
+
+	totals := map[Algorithm]float64{}
+	for _, a := range Algorithms {
+		for _, b := range Algorithms {
+			if a == b {
+				continue
+			}
+			for _, gt := range s.openGames {
+				g := gt.Game.Copy()
+				redYellow := g.ActivePlayer.Team() // a plays the team to move.
+
+				for i := 0; i < moves && !g.HasEnded(); i++ {
+					engine := engines[b]
+					if g.ActivePlayer.Team() == redYellow {
+						engine = engines[a]
+					}
+					continuation, _, err := engine.GetBestMove(g)
+					r.NoError(err)
+					g.Play(continuation[0])
+				}
+
+				// The judge's score is for the team to move after its own best move.
+				_, score, err := judge.GetBestMove(g)
+				if err == ErrGameEnded {
+					score = 1000 * float64(g.Winner*g.ActivePlayer.Team())
+				} else {
+					r.NoError(err)
+				}
+				if g.ActivePlayer.Team() != redYellow {
+					score = -score
+				}
+				totals[a] += score
+				totals[b] -= score
+			}
+		}
+	}
+
+	for _, algorithm := range Algorithms {
+		fmt.Printf("%-10v %+.2f\n", algorithm, totals[algorithm])
+	}
+}
+
+func BenchmarkAlgorithms(b *testing.B) {
+	g, err := game.LoadPGN(`
+1. h2-h3 b9-c9 i13-i12 m8-l8
+2. g1-j4 a8-d11 e13-e12 m5-l5
+3. e2-e3 d11-g8 h14-k11 n7-l9`)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, algorithm := range Algorithms {
+		b.Run(string(algorithm), func(b *testing.B) {
+			engine := New(5, DefaultSpread, DefaultSpreadDrop, 0, WithAlgorithm(algorithm))
+			nodes := 0
+			for range b.N {
+				result, err := engine.GetBestMoveCtx(context.Background(), g.Game.Copy(), Limits{})
+				if err != nil {
+					b.Fatal(err)
+				}
+				nodes += result.Nodes
+			}
+			b.ReportMetric(float64(nodes)/float64(b.N), "nodes/op")
+		})
+	}
+}
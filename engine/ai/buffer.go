@@ -1,6 +1,10 @@
 package ai
 
-import "github.com/vpoliakov01/2v2ChessAI/engine/game"
+import (
+	"sync/atomic"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
 
 const (
 	MovesUpperBound = 256
@@ -12,13 +16,24 @@ type buffer struct {
 	moveEvals           [][]moveScore
 	moveIndexesToSearch [][]int
 	continuation        [][]game.Move
+	played              []game.Move // By depth: the move being searched from the position at the depth.
+	losingCaptures      []moveScore // Scratch space of getMoveEvals.
 
 	evalsCount int
+	ttProbes   int
+	ttHits     int
+	progress   *progress // Progress of the search the buffer is used by; may be nil.
+
+	depth   int          // Depth the worker searches to.
+	helping *atomic.Bool // Set while the worker helps another one search a root move; see search.help.
+
+	heuristics *heuristics // Move ordering tables; nil unless ordering by OrderingHeuristics.
 }
 
 // init populates buffers for searches up to maxDepth.
 func (buff *buffer) init(maxDepth int) {
 	buff.evalsCount = 0
+	buff.ttProbes, buff.ttHits = 0, 0
 
 	if len(buff.moves) >= maxDepth {
 		return
@@ -28,6 +43,7 @@ func (buff *buffer) init(maxDepth int) {
 	buff.moveEvals = make([][]moveScore, maxDepth)
 	buff.moveIndexesToSearch = make([][]int, maxDepth)
 	buff.continuation = make([][]game.Move, maxDepth)
+	buff.played = make([]game.Move, maxDepth)
 
 	for d := range buff.continuation {
 		buff.continuation[d] = make([]game.Move, 0, maxDepth)
@@ -40,13 +56,31 @@ func (buff *buffer) init(maxDepth int) {
 	}
 }
 
-// initBuffers lazily allocates one buffer per CPU, sized for the current configuration.
-func (ai *AI) initBuffers() {
-	if len(ai.buffers) < cpus {
-		ai.buffers = make([]buffer, cpus)
+// getBuffers returns one buffer per thread for a search up to maxDepth, reusing pooled ones when possible.
+func (ai *AI) getBuffers(maxDepth int) []buffer {
+	buffers := make([]buffer, ai.workers())
+	if pooled, ok := ai.bufferPool.Get().(*[]buffer); ok {
+		buffers = *pooled
 	}
 
-	for i := range ai.buffers { // Per each cpu.
-		ai.buffers[i].init(ai.Depth + 2)
+	for i := range buffers { // Per each cpu.
+		buffers[i].init(maxDepth)
+
+		if ai.ordering == OrderingHeuristics {
+			if buffers[i].heuristics == nil {
+				buffers[i].heuristics = &heuristics{}
+			}
+			buffers[i].heuristics.init(maxDepth)
+		}
+	}
+
+	return buffers
+}
+
+// putBuffers returns the buffers to the pool.
+func (ai *AI) putBuffers(buffers []buffer) {
+	for i := range buffers {
+		buffers[i].progress = nil
 	}
+	ai.bufferPool.Put(&buffers)
 }
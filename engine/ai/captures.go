@@ -0,0 +1,72 @@
+package ai
+
+import (
+	"sort"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+// WithQuiescence makes Negamax search the captures at its leaves up to the plies deeper (0, the
+// default, disables it), so that a leaf is not evaluated halfway through an exchange. The captures
+// that lose material by their static exchange evaluation are not searched.
+func WithQuiescence(plies int) func(*AI) {
+	return func(ai *AI) {
+		ai.quiescence = plies
+	}
+}
+
+// WithHangingPieces makes the evaluation count the material the player to move can win by a capture,
+// times the weight (0, the default, leaves it out): the highest static exchange evaluation of its
+// captures (see game.Board.HangingValue). It costs a search of the attackers of every opponent piece
+// per evaluation.
+func WithHangingPieces(weight float64) func(*AI) {
+	return func(ai *AI) {
+		ai.hanging = weight
+	}
+}
+
+// quiescence searches the captures of the position at the depth, past the depth of the search, that
+// don't lose material. The player to move may also stand pat: keep the static evaluation.
+func (s *search) quiescence(g *game.Game, buffer *buffer, depth int, standPat, alpha, beta float64) float64 {
+	if g.HasEnded() {
+		return float64(-1001 + depth)
+	}
+	if standPat >= beta || depth > buffer.depth+s.ai.quiescence || s.stopped(buffer) {
+		return standPat
+	}
+	alpha = max(alpha, standPat)
+
+	moves := g.GetMoves(buffer.moves[depth][:0])
+	buffer.moves[depth] = moves
+
+	// Ordered by MVV-LVA.
+	captures := buffer.moveEvals[depth][:0]
+	for _, move := range moves {
+		victim := g.Board.GetPiece(move.To)
+		if victim.IsEmpty() || !g.Board.SEEAtLeast(move, 0) {
+			continue
+		}
+		attacker := g.Board.GetPiece(move.From)
+		captures = append(captures, moveScore{move, 16*game.Strength[victim.Kind()] - game.Strength[attacker.Kind()]})
+	}
+	buffer.moveEvals[depth] = captures
+
+	sort.Slice(captures, func(a, b int) bool {
+		return captures[a].score > captures[b].score
+	})
+
+	bestScore := standPat
+	for _, capture := range captures {
+		capturedPiece := g.Play(capture.move)
+		score := -s.quiescence(g, buffer, depth+1, s.ai.EvaluateCurrent(g, buffer), -beta, -alpha)
+		g.UnplayMove(capture.move, capturedPiece)
+
+		bestScore = max(bestScore, score)
+		alpha = max(alpha, score)
+		if alpha >= beta || buffer.evalsCount >= s.evalLimit {
+			break
+		}
+	}
+
+	return bestScore
+}
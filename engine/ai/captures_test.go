@@ -0,0 +1,40 @@
+package ai_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/vpoliakov01/2v2ChessAI/engine/ai"
+)
+
+// TestCaptures compares the quiescence search and the hanging pieces evaluation with the plain
+// search by the time and nodes they take to find the best moves of the solved positions.
+func (s *TestSuite) TestCaptures() {
+	r := s.Require()
+	depth := 8
+
+	engines := []struct {
+		name   string
+		engine *AI
+	}{
+		{"plain", New(depth, DefaultSpread, DefaultSpreadDrop, 0)},
+		{"quiescence", New(depth, DefaultSpread, DefaultSpreadDrop, 0, WithQuiescence(2))},
+		{"hanging pieces", New(depth, DefaultSpread, DefaultSpreadDrop, 0, WithHangingPieces(0.5))},
+		{"spread, hanging pieces", New(depth, DefaultSpread, DefaultSpreadDrop, 0, WithPruning(PruningSpread), WithHangingPieces(0.5))},
+	}
+	for _, e := range engines {
+		name, engine := e.name, e.engine
+
+		nodes := 0
+		startTime := time.Now()
+		for _, gt := range s.solvedGames {
+			result, err := engine.GetBestMoveCtx(context.Background(), gt.Game.Copy(), Limits{})
+			r.NoError(err)
+			r.Equal(gt.bestMove.String(), result.Continuation[0].String(), "%v: %v", name, gt.name)
+			nodes += result.Nodes
+		}
+
+		fmt.Printf("%v: %v nodes in %v\n", name, nodes, time.Since(startTime).Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,19 @@
+package ai
+
+import (
+	"context"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+// SearchRoot searches the position to depth after the previous iteration, as GetBestMoveCtx does,
+// and returns the root lines with whether the search used an aspiration window.
+func (ai *AI) SearchRoot(g *game.Game, depth, multiPV int, previous Result) (lines []Line, aspirated bool, err error) {
+	s := ai.startSearch(context.Background(), g, depth, multiPV)
+	defer ai.finishSearch(s)
+
+	s.depth = depth
+	s.evalLimit = MaxEvalLimit
+	lines, err = s.searchRoot(g, previous)
+	return lines, s.aspirates(previous), err
+}
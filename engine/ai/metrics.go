@@ -0,0 +1,157 @@
+package ai
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SearchTimeBuckets are the upper bounds of the buckets of Stats' search time histograms.
+var SearchTimeBuckets = []time.Duration{
+	10 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second, time.Minute,
+}
+
+// Metrics receives the telemetry of an engine's searches (see WithMetrics).
+// Its methods are called concurrently by the searches.
+type Metrics interface {
+	SearchStarted()
+	DepthCompleted(depth int, elapsed time.Duration) // Elapsed since the search started.
+	SearchFinished(SearchStats)
+}
+
+// SearchStats describes a finished search.
+type SearchStats struct {
+	Depth    int // The deepest completed depth.
+	Nodes    int
+	Elapsed  time.Duration
+	TTProbes int // Transposition table lookups; 0 with the table disabled.
+	TTHits   int
+}
+
+// WithMetrics makes the engine publish the telemetry of its searches to metrics.
+// Several engines can share the metrics.
+func WithMetrics(metrics Metrics) func(*AI) {
+	return func(ai *AI) {
+		ai.metrics = metrics
+	}
+}
+
+// Stats is Metrics that aggregates the searches, e.g. for a summary or an exporter.
+type Stats struct {
+	inFlight atomic.Int64
+	searches atomic.Int64
+	nodes    atomic.Int64
+	elapsed  atomic.Int64 // Nanoseconds.
+	ttProbes atomic.Int64
+	ttHits   atomic.Int64
+
+	depthsMutex sync.Mutex
+	depths      map[int]*DepthStats
+}
+
+// StatsSnapshot is the state of Stats at a point in time.
+type StatsSnapshot struct {
+	InFlight int // Searches running.
+	Searches int // Searches finished.
+	Nodes    int
+	Elapsed  time.Duration // Total time of the finished searches.
+	TTProbes int
+	TTHits   int
+	Depths   []DepthStats // By depth, ascending.
+}
+
+// DepthStats is a histogram of the time searches took to complete a depth.
+type DepthStats struct {
+	Depth   int
+	Count   int
+	Sum     time.Duration
+	Buckets []int // Counts of the times up to each of SearchTimeBuckets, cumulative.
+}
+
+// NewStats creates empty stats.
+func NewStats() *Stats {
+	return &Stats{depths: map[int]*DepthStats{}}
+}
+
+func (s *Stats) SearchStarted() {
+	s.inFlight.Add(1)
+}
+
+func (s *Stats) DepthCompleted(depth int, elapsed time.Duration) {
+	s.depthsMutex.Lock()
+	defer s.depthsMutex.Unlock()
+
+	ds, ok := s.depths[depth]
+	if !ok {
+		ds = &DepthStats{Depth: depth, Buckets: make([]int, len(SearchTimeBuckets))}
+		s.depths[depth] = ds
+	}
+	ds.Count++
+	ds.Sum += elapsed
+	for i, bound := range SearchTimeBuckets {
+		if elapsed <= bound {
+			ds.Buckets[i]++
+		}
+	}
+}
+
+func (s *Stats) SearchFinished(stats SearchStats) {
+	s.inFlight.Add(-1)
+	s.searches.Add(1)
+	s.nodes.Add(int64(stats.Nodes))
+	s.elapsed.Add(int64(stats.Elapsed))
+	s.ttProbes.Add(int64(stats.TTProbes))
+	s.ttHits.Add(int64(stats.TTHits))
+}
+
+// Snapshot returns the current state of the stats.
+func (s *Stats) Snapshot() StatsSnapshot {
+	snapshot := StatsSnapshot{
+		InFlight: int(s.inFlight.Load()),
+		Searches: int(s.searches.Load()),
+		Nodes:    int(s.nodes.Load()),
+		Elapsed:  time.Duration(s.elapsed.Load()),
+		TTProbes: int(s.ttProbes.Load()),
+		TTHits:   int(s.ttHits.Load()),
+	}
+
+	s.depthsMutex.Lock()
+	for _, ds := range s.depths {
+		depth := *ds
+		depth.Buckets = slices.Clone(ds.Buckets)
+		snapshot.Depths = append(snapshot.Depths, depth)
+	}
+	s.depthsMutex.Unlock()
+	slices.SortFunc(snapshot.Depths, func(a, b DepthStats) int { return a.Depth - b.Depth })
+
+	return snapshot
+}
+
+// NPS returns the average nodes per second of the finished searches.
+func (s StatsSnapshot) NPS() int {
+	return int(float64(s.Nodes) / max(s.Elapsed.Seconds(), 1e-3))
+}
+
+// TTHitRate returns the share of the transposition table lookups that hit (0 without lookups).
+func (s StatsSnapshot) TTHitRate() float64 {
+	if s.TTProbes == 0 {
+		return 0
+	}
+	return float64(s.TTHits) / float64(s.TTProbes)
+}
+
+// String summarizes the stats, one line for the searches and one per depth.
+func (s StatsSnapshot) String() string {
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "Searches: %v, nodes: %v, time: %.3fs, nps: %v, TT hit rate: %.1f%%\n",
+		s.Searches, s.Nodes, s.Elapsed.Seconds(), s.NPS(), s.TTHitRate()*100)
+	for _, ds := range s.Depths {
+		fmt.Fprintf(&sb, "Depth %v: completed %v times, avg %.3fs\n",
+			ds.Depth, ds.Count, ds.Sum.Seconds()/float64(ds.Count))
+	}
+	return sb.String()
+}
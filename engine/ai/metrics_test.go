@@ -0,0 +1,40 @@
+package ai_test
+
+import (
+	"context"
+
+	. "github.com/vpoliakov01/2v2ChessAI/engine/ai"
+)
+
+func (s *TestSuite) TestMetrics() {
+	r := s.Require()
+
+	stats := NewStats()
+	engine := New(4, DefaultSpread, DefaultSpreadDrop, 0, WithMetrics(stats))
+
+	g := s.GetGame("Free queen (a7-b6)")
+	result, err := engine.GetBestMoveCtx(context.Background(), g.Game, Limits{OnIteration: func(SearchInfo) {}})
+	r.NoError(err)
+	_, _, err = engine.GetBestMove(g.Game)
+	r.NoError(err)
+
+	snapshot := stats.Snapshot()
+	r.Equal(0, snapshot.InFlight)
+	r.Equal(2, snapshot.Searches)
+	r.Equal(result.Nodes+engine.EvalsCount, snapshot.Nodes)
+	r.Positive(snapshot.NPS())
+	r.Positive(snapshot.TTHits, "the second search finds the first one's results")
+	r.Less(snapshot.TTHits, snapshot.TTProbes)
+
+	// The iterative search completed depths 1 to 4, the other one only 4.
+	r.Len(snapshot.Depths, 4)
+	for _, ds := range snapshot.Depths {
+		expected := 1
+		if ds.Depth == 4 {
+			expected = 2
+		}
+		r.Equal(expected, ds.Count, "depth %v", ds.Depth)
+		r.Equal(ds.Count, ds.Buckets[len(ds.Buckets)-1])
+	}
+	r.Contains(snapshot.String(), "Searches: 2")
+}
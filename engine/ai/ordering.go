@@ -0,0 +1,138 @@
+package ai
+
+import (
+	"sort"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+// MoveOrdering is how Negamax orders the moves of a position, which decides the moves the spread
+// searches and how soon alpha-beta cuts the others off. The root moves are always ordered by evaluation.
+type MoveOrdering string
+
+const (
+	// OrderingEvaluation orders the moves by the evaluation of the positions they lead to,
+	// which takes an evaluation per move, and the captures that lose material by their static
+	// exchange evaluation without attacking a king last. The default of PruningSpread.
+	OrderingEvaluation MoveOrdering = "evaluation"
+	// OrderingHeuristics orders the moves without evaluating them: the captures by MVV-LVA
+	// (the most valuable victim first, then the least valuable attacker), those that lose material
+	// by their static exchange evaluation (see game.Board.SEE) after the others, then the killer
+	// moves and the counter-move, then the other moves by history. Only the leaves are evaluated.
+	// The default of PruningSelective.
+	OrderingHeuristics MoveOrdering = "heuristics"
+)
+
+// WithMoveOrdering makes Negamax order the moves with the ordering instead of the default of its pruning.
+func WithMoveOrdering(ordering MoveOrdering) func(*AI) {
+	return func(ai *AI) {
+		ai.ordering = ordering
+	}
+}
+
+const (
+	squares = game.BoardSize * game.BoardSize
+
+	// Ordering keys of OrderingHeuristics. The history of a move stays within ±maxHistory.
+	maxHistory     = 1 << 20
+	orderLosing    = 1 << 8 // More than the MVV-LVA keys, which are below 16*14.
+	orderCounter   = 1 << 21
+	orderKiller    = 1 << 22
+	orderCapture   = 1 << 23
+	killersByDepth = 2
+)
+
+// heuristics are the move ordering tables of a worker, learned from the beta cutoffs of its searches.
+type heuristics struct {
+	killers  [][killersByDepth]game.Move // By depth: the last quiet moves that caused a cutoff, the latest first.
+	history  [4][squares][squares]int32  // By player, from and to: how often a quiet move caused a cutoff.
+	counters [squares][squares]game.Move // By the previous move: the last quiet move that refuted it.
+}
+
+// init prepares the heuristics for a search up to maxDepth. The killers are forgotten,
+// while the history and the counter-moves carry over.
+func (h *heuristics) init(maxDepth int) {
+	if len(h.killers) < maxDepth {
+		h.killers = make([][killersByDepth]game.Move, maxDepth)
+	}
+	clear(h.killers)
+}
+
+// squareIndex returns the index of the square in the tables.
+func squareIndex(square game.Square) int {
+	return square.Rank*game.BoardSize + square.File
+}
+
+// getOrderedMoves returns the active player's moves sorted by OrderingHeuristics. Their scores
+// are the ordering keys rather than evaluations.
+func (s *search) getOrderedMoves(g *game.Game, buffer *buffer, depth int) []moveScore {
+	moves := g.GetMoves(buffer.moves[depth][:0])
+	buffer.moves[depth] = moves
+
+	h := buffer.heuristics
+	history := &h.history[g.ActivePlayer]
+	killers := h.killers[depth]
+	previous := buffer.played[depth-1]
+	counter := h.counters[squareIndex(previous.From)][squareIndex(previous.To)]
+
+	moveEvals := buffer.moveEvals[depth][:len(moves)]
+	for i, move := range moves {
+		key := float64(history[squareIndex(move.From)][squareIndex(move.To)])
+		if victim := game.Piece(g.Board.GetPiece(move.To)); !victim.IsEmpty() {
+			attacker := game.Piece(g.Board.GetPiece(move.From))
+			key = orderCapture + 16*game.Strength[victim.Kind()] - game.Strength[attacker.Kind()]
+			if !g.Board.SEEAtLeast(move, 0) {
+				key -= orderLosing
+			}
+		} else if move == killers[0] {
+			key = orderKiller + 1
+		} else if move == killers[1] {
+			key = orderKiller
+		} else if move == counter {
+			key = orderCounter
+		}
+		moveEvals[i] = moveScore{move, key}
+	}
+	buffer.moveEvals[depth] = moveEvals
+
+	sort.Slice(moveEvals, func(a, b int) bool {
+		return moveEvals[a].score > moveEvals[b].score
+	})
+
+	return moveEvals
+}
+
+// recordCutoff updates the heuristics after the quiet move at moveEvals[cutoff] caused a beta
+// cutoff at the depth, having searched the moves at moveIndexes before it in vain.
+func (s *search) recordCutoff(g *game.Game, buffer *buffer, depth, draft int, moveEvals []moveScore, moveIndexes []int, cutoff int) {
+	h := buffer.heuristics
+	move := moveEvals[cutoff].move
+
+	if killers := &h.killers[depth]; killers[0] != move {
+		killers[1], killers[0] = killers[0], move
+	}
+
+	previous := buffer.played[depth-1]
+	h.counters[squareIndex(previous.From)][squareIndex(previous.To)] = move
+
+	bonus := int32(min(draft*draft, maxHistory))
+	history := &h.history[g.ActivePlayer]
+	for _, i := range moveIndexes {
+		tried := moveEvals[i].move
+		if !g.Board.IsEmpty(tried.To) {
+			continue
+		}
+		if i == cutoff {
+			updateHistory(&history[squareIndex(tried.From)][squareIndex(tried.To)], bonus)
+		} else {
+			updateHistory(&history[squareIndex(tried.From)][squareIndex(tried.To)], -bonus)
+		}
+	}
+}
+
+// updateHistory adds the bonus to the history of a move, scaled down as the history
+// approaches ±maxHistory, so that it stays within them.
+func updateHistory(history *int32, bonus int32) {
+	abs := int64(max(bonus, -bonus))
+	*history += bonus - int32(int64(*history)*abs/maxHistory)
+}
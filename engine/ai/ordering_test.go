@@ -0,0 +1,40 @@
+package ai_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/vpoliakov01/2v2ChessAI/engine/ai"
+)
+
+// TestMoveOrdering compares the move orderings: the time and nodes they take on every position,
+// and how early they order the best moves by depth (the ratio of the index of the best move to
+// the number of moves, the lower the better).
+func (s *TestSuite) TestMoveOrdering() {
+	r := s.Require()
+	depth := 8
+
+	for _, ordering := range []MoveOrdering{OrderingEvaluation, OrderingHeuristics} {
+		engine := New(depth, DefaultSpread, DefaultSpreadDrop, 0, WithMoveOrdering(ordering), WithEnableDebug(true))
+
+		nodes := 0
+		startTime := time.Now()
+		for _, gt := range append(s.solvedGames, s.openGames...) {
+			result, err := engine.GetBestMoveCtx(context.Background(), gt.Game.Copy(), Limits{})
+			r.NoError(err)
+			nodes += result.Nodes
+		}
+
+		fmt.Printf("%v: %v nodes in %v\n", ordering, nodes, time.Since(startTime).Round(time.Millisecond))
+		engine.PrintBestMoveIndexes(false, true)
+	}
+
+	engine := New(4, DefaultSpread, DefaultSpreadDrop, 0, WithMoveOrdering(OrderingHeuristics))
+	for _, name := range []string{"Mate in 1 (g1-a7)", "Mate in 1 (m9-n8)", "Free queen (a7-b6)"} {
+		gt := s.GetGame(name)
+		continuation, _, err := engine.GetBestMove(gt.Game)
+		r.NoError(err)
+		r.Equal(gt.bestMove.String(), continuation[0].String(), name)
+	}
+}
@@ -0,0 +1,183 @@
+package ai
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+const (
+	// Workers publish their eval counts in batches to keep the hot path free of atomics.
+	progressNodesBatch = 1024
+	progressNodesMask  = progressNodesBatch - 1
+)
+
+// SearchInfo is a snapshot of a running search.
+type SearchInfo struct {
+	MoveNumber   int         // Move number of the searched position.
+	Player       game.Player // Player to move in the searched position.
+	Depth        int
+	Continuation []game.Move // Best line found so far.
+	Score        float64     // Score of the best line for the team to move.
+	Lines        []Line      // Best lines of the last completed depth (see Limits.MultiPV).
+	Nodes        int
+	NPS          int
+	Elapsed      time.Duration
+	Final        bool // Set on the last report of the search.
+}
+
+// progress tracks a running search and periodically reports it.
+type progress struct {
+	interval time.Duration
+	report   func(SearchInfo)
+
+	mu           sync.Mutex
+	info         SearchInfo
+	hasBest      bool // Whether the current iteration has a result yet.
+	changed      bool
+	nodes        atomic.Int64
+	startTime    time.Time
+	stopReporter chan struct{}
+	reporterDone chan struct{}
+}
+
+// WithProgress makes GetBestMove report its progress at most once per interval
+// (and once more when the search finishes). report is called from a separate goroutine.
+func WithProgress(interval time.Duration, report func(SearchInfo)) func(*AI) {
+	return func(ai *AI) {
+		ai.progressInterval = interval
+		ai.progressReport = report
+	}
+}
+
+// newSearchInfo describes the result of a search of g.
+func newSearchInfo(g *game.Game, result Result, final bool) SearchInfo {
+	return SearchInfo{MoveNumber: g.MoveNumber, Player: g.ActivePlayer}.withResult(result, final)
+}
+
+// withResult returns a copy of info describing the result.
+func (info SearchInfo) withResult(result Result, final bool) SearchInfo {
+	info.Depth = result.Depth
+	info.Continuation = result.Continuation
+	info.Score = result.Score
+	info.Lines = result.Lines
+	info.Nodes = result.Nodes
+	info.NPS = int(float64(result.Nodes) / max(result.Elapsed.Seconds(), 1e-3))
+	info.Elapsed = result.Elapsed
+	info.Final = final
+	return info
+}
+
+// newProgress starts tracking a search of g, or returns nil if progress is not reported.
+func (ai *AI) newProgress(g *game.Game) *progress {
+	if ai.progressReport == nil {
+		return nil
+	}
+
+	p := &progress{
+		interval:     ai.progressInterval,
+		report:       ai.progressReport,
+		info:         SearchInfo{MoveNumber: g.MoveNumber, Player: g.ActivePlayer},
+		startTime:    time.Now(),
+		stopReporter: make(chan struct{}),
+		reporterDone: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(p.reporterDone)
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.stopReporter:
+				return
+			case <-ticker.C:
+				p.mu.Lock()
+				changed := p.changed
+				p.changed = false
+				p.mu.Unlock()
+
+				if changed {
+					p.report(p.snapshot())
+				}
+			}
+		}
+	}()
+
+	return p
+}
+
+// startIteration starts tracking the next depth. The best line of the previous depth
+// is reported until the new depth finds one.
+func (p *progress) startIteration(depth int) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.info.Depth = depth
+	p.hasBest = false
+	p.changed = true
+}
+
+// finish stops the reporter and sends the final report with the search result.
+func (p *progress) finish(result Result) {
+	if p == nil {
+		return
+	}
+
+	close(p.stopReporter)
+	<-p.reporterDone
+
+	p.report(p.info.withResult(result, true))
+}
+
+// addNodes records a batch of evaluations.
+func (p *progress) addNodes(n int) {
+	if p == nil {
+		return
+	}
+
+	p.nodes.Add(int64(n))
+
+	p.mu.Lock()
+	p.changed = true
+	p.mu.Unlock()
+}
+
+// improve records a root move result if it beats the best one of the current iteration.
+func (p *progress) improve(score float64, continuation []game.Move) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.hasBest && score <= p.info.Score {
+		return
+	}
+
+	p.hasBest = true
+	p.changed = true
+	p.info.Score = score
+	p.info.Continuation = continuation
+}
+
+func (p *progress) snapshot() SearchInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info := p.info
+	info.Nodes = int(p.nodes.Load())
+	info.Elapsed = time.Since(p.startTime)
+	info.NPS = int(float64(info.Nodes) / max(info.Elapsed.Seconds(), 1e-3))
+
+	return info
+}
@@ -0,0 +1,110 @@
+package ai
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+// Pruning is how Negamax picks the moves it searches, and how deep. The root moves are all searched.
+type Pruning string
+
+const (
+	// PruningSelective searches all the moves, the late quiet ones shallower (late move
+	// reductions) and searched again at full depth if they turn out better. Off the principal
+	// variation, it cuts off the positions good enough to pass (null move pruning), and skips
+	// the quiet moves of the positions too bad to reach alpha near the leaves (futility pruning).
+	// The default.
+	PruningSelective Pruning = "selective"
+	// PruningSpread searches the Spread best moves of every position by the move ordering
+	// (half of them at most captures), SpreadDrop fewer every 4 plies, and skips the rest.
+	PruningSpread Pruning = "spread"
+)
+
+// Prunings are the available prunings.
+var Prunings = []Pruning{PruningSelective, PruningSpread}
+
+// ParsePruning parses the name of a pruning. The empty name is PruningSelective.
+func ParsePruning(name string) (Pruning, error) {
+	if name == "" {
+		return PruningSelective, nil
+	}
+	if !slices.Contains(Prunings, Pruning(name)) {
+		return "", fmt.Errorf("unknown pruning %q (expected one of %v)", name, Prunings)
+	}
+	return Pruning(name), nil
+}
+
+// WithPruning makes Negamax pick the moves to search with the pruning. The Spread and SpreadDrop
+// of the engine are only used by PruningSpread, and by the other algorithms.
+func WithPruning(pruning Pruning) func(*AI) {
+	return func(ai *AI) {
+		ai.pruning = pruning
+	}
+}
+
+const (
+	lmrMoves          = 3   // Moves searched at full depth before the reductions start.
+	lmrDraft          = 3   // Minimum draft of the reduced nodes.
+	nullMoveReduction = 2   // Plies the search after a pass is shallower by, besides the pass.
+	futilityDraft     = 2   // Maximum draft of the nodes pruned by futility.
+	futilityMargin    = 1.5 // Most a quiet move is expected to gain per ply of draft.
+)
+
+// nullMove is the move of a pass in buffer.played.
+var nullMove = game.Move{}
+
+// lmrReductions are the late move reductions by draft and by the index of the move in the search order.
+var lmrReductions [MovesUpperBound][MovesUpperBound]int8
+
+func init() {
+	for draft := lmrDraft; draft < MovesUpperBound; draft++ {
+		for n := lmrMoves; n < MovesUpperBound; n++ {
+			reduction := int(0.75 + math.Log(float64(draft))*math.Log(float64(n+1))/2.25)
+			lmrReductions[draft][n] = int8(min(max(reduction, 1), draft-2))
+		}
+	}
+}
+
+// lmrReduction returns the plies the nth searched move of a node of the draft is reduced by.
+func lmrReduction(draft, n int) int {
+	if draft < lmrDraft || n < lmrMoves {
+		return 0
+	}
+	return int(lmrReductions[min(draft, MovesUpperBound-1)][min(n, MovesUpperBound-1)])
+}
+
+// nullMove tries the null move pruning of PruningSelective: the player to move passes, and if
+// a shallower search still scores at least beta, a move would too, so the moves need no search.
+//
+// In the turn order of four players, a pass gives the move to the next opponent, and then to the
+// partner and the other opponent before the passer moves again. So the search after the pass must
+// be at least 3 plies deep for both opponents to make their threats, and the passes are more than
+// a round of plies apart, so that the passes of a team do not stack up.
+func (s *search) nullMove(g *game.Game, buffer *buffer, cpu, depth, draft int, staticEval, beta float64) (score float64, ok bool) {
+	if staticEval < beta || draft-1-nullMoveReduction < 3 {
+		return 0, false
+	}
+	for d := max(depth-3, 1); d < depth; d++ {
+		if buffer.played[d] == nullMove {
+			return 0, false
+		}
+	}
+
+	buffer.played[depth] = nullMove
+	g.ActivePlayer = (g.ActivePlayer + 1) % 4
+	buffer.depth -= nullMoveReduction
+	score = -s.Negamax(g, buffer, cpu, depth+1, -staticEval, -beta, -beta+nullWindow)
+	buffer.depth += nullMoveReduction
+	g.ActivePlayer = (g.ActivePlayer + 3) % 4
+
+	if score < beta || s.stopped(buffer) {
+		return 0, false
+	}
+	if score > mateThreshold { // A mate after a pass is not a mate.
+		score = beta
+	}
+	return score, true
+}
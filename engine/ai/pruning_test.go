@@ -0,0 +1,31 @@
+package ai_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/vpoliakov01/2v2ChessAI/engine/ai"
+)
+
+// TestPruning compares the prunings by the time and nodes they take to find the best moves of the
+// solved positions.
+func (s *TestSuite) TestPruning() {
+	r := s.Require()
+	depth := 10
+
+	for _, pruning := range Prunings {
+		engine := New(depth, DefaultSpread, DefaultSpreadDrop, 0, WithPruning(pruning))
+
+		nodes := 0
+		startTime := time.Now()
+		for _, gt := range s.solvedGames {
+			result, err := engine.GetBestMoveCtx(context.Background(), gt.Game.Copy(), Limits{})
+			r.NoError(err)
+			r.Equal(gt.bestMove.String(), result.Continuation[0].String(), "%v: %v", pruning, gt.name)
+			nodes += result.Nodes
+		}
+
+		fmt.Printf("%v: %v nodes in %v\n", pruning, nodes, time.Since(startTime).Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,18 @@
+package ai
+
+const (
+	// nullWindow is the width of the windows that PVS proves the moves after the first one
+	// worse with; far below the differences of the scores that matter.
+	nullWindow = 1e-6
+	// aspirationWindow is the distance from the score of the previous depth to the bounds of the
+	// first window of the next one (half a pawn). It doubles every time the score falls out of it.
+	aspirationWindow = 0.5
+)
+
+// WithPVS makes Negamax search with principal variation search, and with aspiration windows at
+// the root (on by default). Both return the same results as the plain search, with fewer nodes.
+func WithPVS(enabled bool) func(*AI) {
+	return func(ai *AI) {
+		ai.pvs = enabled
+	}
+}
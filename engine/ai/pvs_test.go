@@ -0,0 +1,65 @@
+package ai_test
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/vpoliakov01/2v2ChessAI/engine/ai"
+)
+
+// TestPVS checks that principal variation search and aspiration windows return the same best
+// move and score as the plain search on every position, and reports the nodes they take.
+func (s *TestSuite) TestPVS() {
+	r := s.Require()
+	depth := 6
+
+	// Iterative deepening, for the aspiration windows. With PruningSpread, as the reductions
+	// of PruningSelective depend on the windows (see TestPVSSelective for the default search).
+	limits := Limits{OnIteration: func(SearchInfo) {}}
+	plain := New(depth, DefaultSpread, DefaultSpreadDrop, 0, WithPruning(PruningSpread), WithPVS(false))
+	engine := New(depth, DefaultSpread, DefaultSpreadDrop, 0, WithPruning(PruningSpread))
+
+	nodes, plainNodes := 0, 0
+	for _, gt := range append(s.solvedGames, s.openGames...) {
+		expected, err := plain.GetBestMoveCtx(context.Background(), gt.Game.Copy(), limits)
+		r.NoError(err)
+		result, err := engine.GetBestMoveCtx(context.Background(), gt.Game.Copy(), limits)
+		r.NoError(err)
+
+		r.Equal(expected.Continuation[0].String(), result.Continuation[0].String(), gt.name)
+		r.InDelta(expected.Score, result.Score, 1e-9, gt.name)
+		plainNodes += expected.Nodes
+		nodes += result.Nodes
+
+		expectedContinuation, expectedScore, err := plain.GetBestMove(gt.Game.Copy())
+		r.NoError(err)
+		continuation, score, err := engine.GetBestMove(gt.Game.Copy())
+		r.NoError(err)
+		r.Equal(expectedContinuation[0].String(), continuation[0].String(), gt.name)
+		r.InDelta(expectedScore, score, 1e-9, gt.name)
+	}
+
+	fmt.Printf("Nodes: %v with PVS, %v without\n", nodes, plainNodes)
+}
+
+// TestPVSSelective checks that with the default PruningSelective, whose reductions depend on the
+// windows, principal variation search finds the same best moves as the plain search at a fixed
+// depth, and the mates of the solved positions.
+func (s *TestSuite) TestPVSSelective() {
+	r := s.Require()
+	depth := 6
+
+	plain := New(depth, DefaultSpread, DefaultSpreadDrop, 0, WithPVS(false))
+	engine := New(depth, DefaultSpread, DefaultSpreadDrop, 0)
+	for _, gt := range s.solvedGames {
+		expected, err := plain.GetBestMoveCtx(context.Background(), gt.Game.Copy(), Limits{})
+		r.NoError(err)
+		result, err := engine.GetBestMoveCtx(context.Background(), gt.Game.Copy(), Limits{})
+		r.NoError(err)
+		r.Equal(expected.Continuation[0].String(), result.Continuation[0].String(), gt.name)
+	}
+
+	for _, pvs := range []bool{true, false} {
+		s.requireSolved(New(8, DefaultSpread, DefaultSpreadDrop, 0, WithPVS(pvs)), fmt.Sprintf("PVS %v", pvs))
+	}
+}
@@ -0,0 +1,232 @@
+package ai
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+// search holds the state of a single GetBestMoveCtx call.
+type search struct {
+	ai *AI
+
+	cancel    context.CancelFunc
+	stopAfter func() bool // Unregisters the stopFlag update from the context.
+
+	buffers  []buffer // One buffer per CPU.
+	progress *progress
+	tt       *transpositionTable // Nil if disabled.
+
+	stopFlag    atomic.Bool // Mirrors the search context being done; cheap to poll in the hot path.
+	sharedAlpha atomic.Uint64
+
+	multiPV    int // Number of root moves to score exactly.
+	rootMutex  sync.Mutex
+	rootScores []float64 // Best root scores of the current iteration, descending.
+
+	depth     int         // Depth of the current iteration.
+	evalLimit int         // Per-worker evaluation limit of the current iteration.
+	root      game.Player // Player to move in the searched position.
+}
+
+// startSearch registers a new search that stops when ctx is done or Stop is called.
+func (ai *AI) startSearch(ctx context.Context, g *game.Game, maxDepth, multiPV int) *search {
+	ctx, cancel := context.WithCancel(ctx)
+
+	s := &search{
+		ai:       ai,
+		cancel:   cancel,
+		multiPV:  max(multiPV, 1),
+		buffers:  ai.getBuffers(maxDepth + 2 + ai.quiescence),
+		root:     g.ActivePlayer,
+		progress: ai.newProgress(g),
+		tt:       ai.getTT(),
+	}
+	if s.tt != nil {
+		s.tt.newSearch()
+	}
+	for i := range s.buffers {
+		s.buffers[i].progress = s.progress
+	}
+
+	s.stopAfter = context.AfterFunc(ctx, func() { s.stopFlag.Store(true) })
+
+	ai.searchesMutex.Lock()
+	if ai.searches == nil {
+		ai.searches = map[*search]context.CancelFunc{}
+	}
+	ai.searches[s] = cancel
+	ai.searchesMutex.Unlock()
+
+	// The context may already be done, in which case AfterFunc runs asynchronously.
+	if ctx.Err() != nil {
+		s.stopFlag.Store(true)
+	}
+
+	return s
+}
+
+// finishSearch unregisters the search and releases its resources.
+func (ai *AI) finishSearch(s *search) {
+	ai.searchesMutex.Lock()
+	delete(ai.searches, s)
+	ai.searchesMutex.Unlock()
+
+	s.stopAfter()
+	s.cancel()
+	ai.putBuffers(s.buffers)
+}
+
+// searchRoot searches the position to s.depth and returns the best lines (see searchRootWindow).
+// With PVS, the window of the search is narrowed around the score of the previous depth
+// (an aspiration window), and widened on the side the best score falls out of it.
+func (s *search) searchRoot(g *game.Game, previous Result) (lines []Line, err error) {
+	for i := range s.buffers {
+		s.buffers[i].evalsCount = 0
+		s.buffers[i].ttProbes, s.buffers[i].ttHits = 0, 0
+		s.buffers[i].depth = s.depth
+	}
+
+	forcedMateScore := 1002 - float64(s.depth)
+	alpha := -forcedMateScore
+	beta := forcedMateScore
+	delta := aspirationWindow
+	if s.aspirates(previous) {
+		alpha = max(previous.Score-delta, -forcedMateScore)
+		beta = min(previous.Score+delta, forcedMateScore)
+	}
+
+	for {
+		lines, err = s.searchRootWindow(g, alpha, beta)
+		if err != nil || s.stopFlag.Load() || s.isOutOfEvals() {
+			return lines, err
+		}
+
+		score := lines[0].Score
+		delta *= 2
+		switch {
+		case score <= alpha && alpha > -forcedMateScore:
+			alpha = max(score-delta, -forcedMateScore)
+		case score >= beta && beta < forcedMateScore:
+			beta = min(score+delta, forcedMateScore)
+		default:
+			return lines, nil
+		}
+	}
+}
+
+// aspirates returns whether the search of the depth after previous uses an aspiration window.
+// The scores of the lines other than the best one are only bounds in a narrow window, and the
+// score vectors of AlgorithmMaxN have no window.
+func (s *search) aspirates(previous Result) bool {
+	return s.ai.pvs && previous.Depth > 0 && s.multiPV == 1 && s.ai.algorithm != AlgorithmMaxN &&
+		math.Abs(previous.Score) < mateThreshold
+}
+
+// searchRootWindow searches the position to s.depth within the window (alpha, beta), and returns
+// the best s.multiPV lines, and at least 2 of them for the time manager. Past s.multiPV, the moves
+// are only searched to fail low (except with AlgorithmMaxN), so the scores are upper bounds.
+func (s *search) searchRootWindow(g *game.Game, alpha, beta float64) (lines []Line, err error) {
+	buffer := &s.buffers[0]
+	s.sharedAlpha.Store(math.Float64bits(alpha))
+	s.rootScores = s.rootScores[:0]
+
+	moveEvals := s.getMoveEvals(g, buffer, 1)
+	if len(moveEvals) == 0 {
+		return nil, ErrNoMoves
+	}
+
+	// YBW: search the highest-scored move to establish alpha
+	results := s.searchRootMoves(g, moveEvals[:1], beta)
+
+	// Parallel search of the remaining moves with tightened alpha
+	if s.loadSharedAlpha() < beta && !s.stopFlag.Load() && len(moveEvals) > 1 {
+		results = append(results, s.searchRootMoves(g, moveEvals[1:], beta)...)
+	}
+
+	// Stable, so that the earlier searched move wins a tie.
+	sort.SliceStable(results, func(a, b int) bool {
+		return results[a].rank > results[b].rank
+	})
+
+	lines = make([]Line, 0, max(s.multiPV, 2))
+	for _, result := range results[:min(max(s.multiPV, 2), len(results))] {
+		lines = append(lines, Line{Continuation: result.continuation, Score: result.score})
+	}
+
+	return lines, nil
+}
+
+// recordRootScore tracks the best s.multiPV root scores. Once there are enough of them,
+// the worst one becomes the shared alpha: other root moves only matter if they beat it.
+func (s *search) recordRootScore(score float64) {
+	s.rootMutex.Lock()
+	i, _ := slices.BinarySearchFunc(s.rootScores, score, func(a, b float64) int { return cmp.Compare(b, a) })
+	s.rootScores = slices.Insert(s.rootScores, i, score)
+	s.rootScores = s.rootScores[:min(len(s.rootScores), s.multiPV)]
+
+	full := len(s.rootScores) == s.multiPV
+	worst := s.rootScores[len(s.rootScores)-1]
+	s.rootMutex.Unlock()
+
+	if full {
+		s.raiseSharedAlpha(worst)
+	}
+}
+
+// loadSharedAlpha returns the current shared root-level alpha as float64.
+func (s *search) loadSharedAlpha() float64 {
+	return math.Float64frombits(s.sharedAlpha.Load())
+}
+
+// raiseSharedAlpha atomically lifts the shared alpha to candidate if candidate is greater.
+func (s *search) raiseSharedAlpha(candidate float64) {
+	for { // Retry until success in case it's overwritten by another worker.
+		current := s.sharedAlpha.Load()
+		if candidate <= math.Float64frombits(current) {
+			return
+		}
+		if s.sharedAlpha.CompareAndSwap(current, math.Float64bits(candidate)) {
+			return
+		}
+	}
+}
+
+// stopped returns whether the worker of the buffer should stop searching.
+func (s *search) stopped(buffer *buffer) bool {
+	return s.stopFlag.Load() || buffer.helping != nil && buffer.helping.Load()
+}
+
+// sumTTStats aggregates the per-worker transposition table probes and hits of the current iteration.
+func (s *search) sumTTStats() (probes, hits int) {
+	for i := range s.buffers {
+		probes += s.buffers[i].ttProbes
+		hits += s.buffers[i].ttHits
+	}
+	return probes, hits
+}
+
+// sumEvalsCounts aggregates the per-worker eval counts of the current iteration.
+func (s *search) sumEvalsCounts() int {
+	total := 0
+	for i := range s.buffers {
+		total += s.buffers[i].evalsCount
+	}
+	return total
+}
+
+// isOutOfEvals returns whether any worker hit the evaluation limit in the current iteration.
+func (s *search) isOutOfEvals() bool {
+	for i := range s.buffers {
+		if s.buffers[i].evalsCount >= s.evalLimit {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package ai
+
+import (
+	"time"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+const (
+	maxMovesToGo = 40                    // Number of moves the remaining time is budgeted for at the start.
+	minMovesToGo = 20                    // ... and later in the game.
+	moveOverhead = 50 * time.Millisecond // Time between the end of a search and the move reaching the clock.
+	minMoveTime  = 10 * time.Millisecond
+
+	hardLimitFactor  = 4   // How much longer than planned a move may take at most.
+	instabilityScale = 1.5 // Soft limit scale when the best move changed in the last iteration.
+	scoreDropScale   = 1.3 // Soft limit scale when the score dropped in the last iteration.
+	dominanceScale   = 0.3 // Soft limit scale when the best move clearly dominates.
+
+	scoreDropMargin  = 0.5 // Score drop between iterations that calls for more time (in pawns).
+	dominanceMargin  = 3.0 // Lead of the best move over the second best that makes it dominate (in pawns).
+	stableIterations = 2   // Iterations without a change of the best move before it can dominate.
+)
+
+// Clock is the clock of the player to move.
+type Clock struct {
+	Remaining   time.Duration // Time left on the clock.
+	Increment   time.Duration // Time added after the move.
+	MovesPlayed int           // Moves the player has made so far.
+}
+
+// TimeBudget is the time to spend on a move.
+type TimeBudget struct {
+	Soft time.Duration // Planned time: no new iteration starts after it (scaled by the search's progress).
+	Hard time.Duration // Time after which the search is stopped.
+}
+
+// MoveTime returns the time to plan for the next move (the soft limit of Budget).
+func (c Clock) MoveTime() time.Duration {
+	return c.Budget().Soft
+}
+
+// Budget splits the remaining time between the moves expected to be left, plus most of the
+// increment. A move never takes more than a third of the remaining time (plus the increment).
+func (c Clock) Budget() TimeBudget {
+	movesToGo := time.Duration(max(maxMovesToGo-c.MovesPlayed/2, minMovesToGo))
+	available := max(c.Remaining-moveOverhead, 0)
+
+	soft := available/movesToGo + c.Increment*3/4
+	hard := min(soft*hardLimitFactor, available/3+c.Increment*3/4, available)
+	soft = min(soft, hard)
+
+	return TimeBudget{Soft: max(soft, minMoveTime), Hard: max(hard, minMoveTime)}
+}
+
+// timeManager decides when to stop iterative deepening under a time budget.
+type timeManager struct {
+	budget    TimeBudget
+	startTime time.Time
+
+	iterations int
+	bestMove   game.Move // Of the last iteration.
+	score      float64   // Of the last iteration.
+	stability  int       // Number of iterations in a row that agreed on the best move.
+}
+
+// newTimeManager starts managing the time of a search that started at startTime.
+func newTimeManager(budget TimeBudget, startTime time.Time) *timeManager {
+	return &timeManager{budget: budget, startTime: startTime}
+}
+
+// afterIteration takes the result of a completed depth with its best root lines, at least 2
+// unless there is a single move, and returns whether to stop searching. The score of the second
+// line may only be an upper bound (see searchRootWindow), which underestimates the lead of the best move.
+//
+// The planned time is extended when the best move changes or the score drops, as the search
+// has not settled yet, and cut short when the best move has been stable and far ahead of the
+// others. Since the next depth takes longer than all the previous ones together, it is only
+// started if at least half of the planned time is left.
+func (tm *timeManager) afterIteration(result Result, lines []Line) (stop bool) {
+	if len(lines) < 2 { // The only move.
+		return true
+	}
+
+	scale := 1.0
+	bestMove := result.Continuation[0]
+	if tm.iterations > 0 {
+		if bestMove != tm.bestMove {
+			tm.stability = 0
+			scale *= instabilityScale
+		}
+		if result.Score < tm.score-scoreDropMargin {
+			scale *= scoreDropScale
+		}
+	}
+	tm.iterations++
+	tm.stability++
+	tm.bestMove = bestMove
+	tm.score = result.Score
+
+	if tm.stability > stableIterations && lines[0].Score-lines[1].Score > dominanceMargin {
+		scale *= dominanceScale
+	}
+
+	soft := min(time.Duration(float64(tm.budget.Soft)*scale), tm.budget.Hard)
+	return time.Since(tm.startTime) >= soft/2
+}
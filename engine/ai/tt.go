@@ -0,0 +1,157 @@
+package ai
+
+import (
+	"math"
+	"sync/atomic"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+// DefaultHashSize is the size of the transposition table of an engine by default, in MB.
+var DefaultHashSize = 16
+
+// WithHashSize sets the size of the engine's transposition table in MB (0 disables it).
+// The table is allocated by the first search, and shared by the engine's searches and threads.
+func WithHashSize(mb int) func(*AI) {
+	return func(ai *AI) {
+		ai.hashSize = mb
+	}
+}
+
+// Bounds of the scores stored in the transposition table.
+const (
+	boundExact = iota + 1
+	boundLower // The score is at least the stored one (a beta cutoff).
+	boundUpper // The score is at most the stored one (no move raised alpha).
+)
+
+// ttEntry is an entry of the transposition table. It is written and read without locks:
+// key is the hash of the position XORed with the other words, so an entry torn by
+// concurrent writes does not match the position and is ignored.
+type ttEntry struct {
+	key   atomic.Uint64
+	score atomic.Uint64 // math.Float64bits of the score.
+	data  atomic.Uint64 // See ttData.
+}
+
+// ttData is the unpacked data word of an entry. Packed, it holds from low bits up:
+// draft (8 bits), bound (2), move from and to (8 + 8; square index + 1, 0 for no move)
+// and generation (8).
+type ttData struct {
+	draft      int // Depth searched below the position.
+	bound      int
+	move       game.Move
+	hasMove    bool
+	generation uint8
+}
+
+// transpositionTable caches the results of the searched positions by their Zobrist hashes.
+type transpositionTable struct {
+	entries    []ttEntry
+	generation atomic.Uint32 // Bumped by every search, so that old entries are replaced first.
+}
+
+// newTranspositionTable creates a table of about mb megabytes.
+func newTranspositionTable(mb int) *transpositionTable {
+	size := mb << 20 / 24 // sizeof(ttEntry).
+	return &transpositionTable{entries: make([]ttEntry, max(size, 1))}
+}
+
+// getTT returns the engine's transposition table, allocating it on first use,
+// or nil if it is disabled.
+func (ai *AI) getTT() *transpositionTable {
+	if ai.hashSize <= 0 {
+		return nil
+	}
+	ai.ttOnce.Do(func() { ai.tt = newTranspositionTable(ai.hashSize) })
+	return ai.tt
+}
+
+// newSearch starts a new generation of entries.
+func (tt *transpositionTable) newSearch() {
+	tt.generation.Add(1)
+}
+
+// probe returns the entry of the position at the given ply, if there is one.
+func (tt *transpositionTable) probe(hash uint64, ply int) (score float64, data ttData, ok bool) {
+	entry := &tt.entries[hash%uint64(len(tt.entries))]
+	scoreBits, dataBits := entry.score.Load(), entry.data.Load()
+	if entry.key.Load()^scoreBits^dataBits != hash {
+		return 0, ttData{}, false
+	}
+
+	return scoreFromTT(math.Float64frombits(scoreBits), ply), unpackTTData(dataBits), true
+}
+
+// store saves the result of the position at the given ply, unless the slot holds
+// a deeper result of another position from the current search.
+func (tt *transpositionTable) store(hash uint64, ply int, score float64, data ttData) {
+	entry := &tt.entries[hash%uint64(len(tt.entries))]
+	data.generation = uint8(tt.generation.Load())
+
+	oldScore, oldData := entry.score.Load(), entry.data.Load()
+	if entry.key.Load()^oldScore^oldData != hash {
+		if old := unpackTTData(oldData); old.generation == data.generation && old.draft > data.draft {
+			return
+		}
+	}
+
+	scoreBits, dataBits := math.Float64bits(scoreToTT(score, ply)), data.pack()
+	entry.key.Store(hash ^ scoreBits ^ dataBits)
+	entry.score.Store(scoreBits)
+	entry.data.Store(dataBits)
+}
+
+// pack packs the data into a word.
+func (d ttData) pack() uint64 {
+	from, to := uint64(0), uint64(0)
+	if d.hasMove {
+		from = uint64(d.move.From.Rank*game.BoardSize+d.move.From.File) + 1
+		to = uint64(d.move.To.Rank*game.BoardSize+d.move.To.File) + 1
+	}
+	return uint64(min(d.draft, math.MaxUint8)) | uint64(d.bound)<<8 | from<<10 | to<<18 | uint64(d.generation)<<26
+}
+
+// unpackTTData unpacks the data word of an entry.
+func unpackTTData(bits uint64) ttData {
+	d := ttData{
+		draft:      int(bits & 0xff),
+		bound:      int(bits >> 8 & 0x3),
+		generation: uint8(bits >> 26),
+	}
+	from, to := int(bits>>10&0xff), int(bits>>18&0xff)
+	if from > 0 {
+		d.hasMove = true
+		d.move = game.Move{
+			From: game.Square{Rank: (from - 1) / game.BoardSize, File: (from - 1) % game.BoardSize},
+			To:   game.Square{Rank: (to - 1) / game.BoardSize, File: (to - 1) % game.BoardSize},
+		}
+	}
+	return d
+}
+
+// Mate scores are relative to the root, and are stored relative to the position instead,
+// so that they stay right when the position is reached at another ply.
+const mateThreshold = 900
+
+// scoreToTT converts a score at the given ply to the one stored.
+func scoreToTT(score float64, ply int) float64 {
+	switch {
+	case score > mateThreshold:
+		return score + float64(ply)
+	case score < -mateThreshold:
+		return score - float64(ply)
+	}
+	return score
+}
+
+// scoreFromTT converts a stored score to the one at the given ply.
+func scoreFromTT(score float64, ply int) float64 {
+	switch {
+	case score > mateThreshold:
+		return score - float64(ply)
+	case score < -mateThreshold:
+		return score + float64(ply)
+	}
+	return score
+}
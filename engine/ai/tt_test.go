@@ -0,0 +1,58 @@
+package ai_test
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/vpoliakov01/2v2ChessAI/engine/ai"
+)
+
+// TestTranspositionTable checks that the table does not change the results of the searches,
+// and that it saves nodes.
+func (s *TestSuite) TestTranspositionTable() {
+	r := s.Require()
+	// With PruningSpread, as the reductions of PruningSelective depend on the windows
+	// (see TestTranspositionTableSelective for the default search).
+	depth := 6
+
+	nodes, nodesWithoutTT := 0, 0
+	for _, gt := range s.solvedGames {
+		withoutTT := New(depth, DefaultSpread, DefaultSpreadDrop, 0, WithPruning(PruningSpread), WithHashSize(0))
+		expected, err := withoutTT.GetBestMoveCtx(context.Background(), gt.Game.Copy(), Limits{})
+		r.NoError(err)
+		nodesWithoutTT += expected.Nodes
+
+		engine := New(depth, DefaultSpread, DefaultSpreadDrop, 0, WithPruning(PruningSpread))
+		for range 2 { // The second search reuses the results of the first.
+			result, err := engine.GetBestMoveCtx(context.Background(), gt.Game.Copy(), Limits{})
+			r.NoError(err)
+			r.Equal(expected.Continuation[0].String(), result.Continuation[0].String(), gt.name)
+			r.InDelta(expected.Score, result.Score, 1e-9, gt.name)
+			nodes += result.Nodes
+		}
+	}
+	r.Less(nodes, 2*nodesWithoutTT)
+}
+
+// TestTranspositionTableSelective checks that with the default PruningSelective, the table doesn't
+// change the best moves at a fixed depth, and that the search finds the mates of the solved positions
+// without the table too (see TestPVSSelective).
+func (s *TestSuite) TestTranspositionTableSelective() {
+	r := s.Require()
+	depth := 6
+
+	withoutTT := New(depth, DefaultSpread, DefaultSpreadDrop, 0, WithHashSize(0))
+	engine := New(depth, DefaultSpread, DefaultSpreadDrop, 0)
+	for _, gt := range s.solvedGames {
+		expected, err := withoutTT.GetBestMoveCtx(context.Background(), gt.Game.Copy(), Limits{})
+		r.NoError(err)
+		result, err := engine.GetBestMoveCtx(context.Background(), gt.Game.Copy(), Limits{})
+		r.NoError(err)
+		r.Equal(expected.Continuation[0].String(), result.Continuation[0].String(), gt.name)
+	}
+
+	for _, pvs := range []bool{true, false} {
+		s.requireSolved(New(8, DefaultSpread, DefaultSpreadDrop, 0, WithHashSize(0), WithPVS(pvs)),
+			fmt.Sprintf("PVS %v without the table", pvs))
+	}
+}
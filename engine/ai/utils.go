@@ -3,25 +3,29 @@ package ai
 import (
 	"sort"
 	"sync"
+	"sync/atomic"
 
 	"github.com/vpoliakov01/2v2ChessAI/engine/game"
 )
 
-// candidateResult carries one root-move worker's findings back to GetBestMove.
+// candidateResult carries one root-move worker's findings back to searchRoot.
 type candidateResult struct {
 	score        float64
+	rank         float64     // What the root player maximizes; the score except for AlgorithmMaxN.
 	continuation []game.Move // detached from any buffer; safe to keep.
 }
 
-// getMoveEvals returns the active player's moves sorted by 1-ply evaluation.
-func (ai *AI) getMoveEvals(g *game.Game, buffer *buffer, depth int) []moveScore {
+// getMoveEvals returns the active player's moves sorted by 1-ply evaluation, except for the captures
+// that lose material by SEE without attacking a king: they come last, out of the spread, and
+// the mates that start with a sacrifice keep their place.
+func (s *search) getMoveEvals(g *game.Game, buffer *buffer, depth int) []moveScore {
 	moves := g.GetMoves(buffer.moves[depth][:0])
 	buffer.moves[depth] = moves // In case moves got reallocated by append inside GetMoves.
 
 	moveEvals := buffer.moveEvals[depth][:len(moves)]
 	for i := range moves {
 		capturedPiece := g.Play(moves[i])
-		moveEvals[i] = moveScore{moves[i], -ai.EvaluateCurrent(g, buffer)}
+		moveEvals[i] = moveScore{moves[i], -s.ai.EvaluateCurrent(g, buffer)}
 		g.UnplayMove(moves[i], capturedPiece)
 	}
 	buffer.moveEvals[depth] = moveEvals
@@ -30,73 +34,160 @@ func (ai *AI) getMoveEvals(g *game.Game, buffer *buffer, depth int) []moveScore
 		return moveEvals[a].score > moveEvals[b].score
 	})
 
+	// Stable, so that both keep the order of their evaluation.
+	n := 0
+	losing := buffer.losingCaptures[:0]
+	for _, moveEval := range moveEvals {
+		if isLosingCapture(g, moveEval.move) {
+			losing = append(losing, moveEval)
+		} else {
+			moveEvals[n] = moveEval
+			n++
+		}
+	}
+	copy(moveEvals[n:], losing)
+	buffer.losingCaptures = losing
+
 	return moveEvals
 }
 
-// searchRootMove plays the candidate move, runs Negamax on it, and returns the score and continuation.
-func (ai *AI) searchRootMove(g *game.Game, buffer *buffer, cpu int, candidate moveScore, alpha, beta float64) (score float64, continuation []game.Move) {
+// isLosingCapture reports whether the move is a capture that loses material by SEE, and doesn't
+// leave the king of an opponent attacked.
+func isLosingCapture(g *game.Game, move game.Move) bool {
+	if g.Board.IsEmpty(move.To) || g.Board.SEEAtLeast(move, 0) {
+		return false
+	}
+
+	player := g.ActivePlayer
+	capturedPiece := g.Play(move)
+	defer g.UnplayMove(move, capturedPiece)
+
+	return !g.Board.IsKingAttacked((player+1)%4) && !g.Board.IsKingAttacked((player+3)%4)
+}
+
+// searchRootMove plays the candidate move, searches it with the engine's algorithm,
+// and returns the score and continuation.
+func (s *search) searchRootMove(g *game.Game, buffer *buffer, cpu int, candidate moveScore, alpha, beta float64) candidateResult {
 	move := candidate.move
+	result := candidateResult{}
 
+	buffer.played[1] = move
 	capturedPiece := g.Play(move)
-	opponentScore := ai.Negamax(g, buffer, cpu, 2, -candidate.score, -beta, -alpha)
+	switch s.ai.algorithm {
+	case AlgorithmParanoid:
+		result.score = -s.paranoid(g, buffer, cpu, 2, -candidate.score, -beta, -alpha)
+	case AlgorithmMaxN:
+		scores := s.maxN(g, buffer, cpu, 2)
+		result.score = teamScore(scores, s.root)
+		result.rank = scores[s.root]
+	case AlgorithmBRS:
+		result.score = -s.brs(g, buffer, cpu, 2, -candidate.score, -beta, -alpha)
+	default:
+		result.score = -s.Negamax(g, buffer, cpu, 2, -candidate.score, -beta, -alpha)
+	}
 	g.UnplayMove(move, capturedPiece)
 
-	score = -opponentScore
-	ai.raiseSharedAlpha(score)
+	if s.ai.algorithm != AlgorithmMaxN {
+		result.rank = result.score
+	}
+	s.recordRootScore(result.rank)
 
 	childCont := buffer.continuation[2]
-	continuation = make([]game.Move, 0, len(childCont)+1)
-	continuation = append(continuation, move)
-	continuation = append(continuation, childCont...)
+	result.continuation = make([]game.Move, 0, len(childCont)+1)
+	result.continuation = append(result.continuation, move)
+	result.continuation = append(result.continuation, childCont...)
 
-	return score, continuation
+	return result
 }
 
-// searchRootMovesParallel searches the given candidates concurrently — one goroutine per
-// candidate, each on its own game copy and buffer. Returns the best score and continuation,
-// folding bestScoreIn / bestContinuationIn (typically the YBW result) into the comparison.
-func (ai *AI) searchRootMovesParallel(
-	g *game.Game,
-	candidates []moveScore,
-	beta,
-	bestScore float64,
-	bestContinuation []game.Move,
-) (
-	float64, // bestScore
-	[]game.Move, // bestContinuation
-) {
-	// Pool of CPUs for the goroutines.
-	cpuIDs := make(chan int, cpus)
-	for i := range cpus {
-		cpuIDs <- i
+// searchRootMoves searches the candidates on all the workers, each on its own game copy and
+// buffer, the workers taking the next candidate until none are left. Returns the results
+// in the order of candidates.
+//
+// With the transposition table, the workers without candidates left help search the running
+// ones (Lazy SMP) until they are done; see help.
+func (s *search) searchRootMoves(g *game.Game, candidates []moveScore, beta float64) []candidateResult {
+	results := make([]candidateResult, len(candidates))
+	done := make([]atomic.Bool, len(candidates))
+	helpers := make([]atomic.Int32, len(candidates))
+	next := atomic.Int32{}
+
+	workers := len(s.buffers)
+	if !s.canHelp() {
+		workers = min(workers, len(candidates))
 	}
 
-	results := make([]candidateResult, len(candidates))
 	var wg sync.WaitGroup
-
-	for i, candidate := range candidates {
+	for cpu := range workers {
 		wg.Add(1)
 
-		go func(slot int, candidate moveScore) {
+		go func() {
 			defer wg.Done()
-			cpuID := <-cpuIDs
-			defer func() { cpuIDs <- cpuID }()
-
 			gameCopy := g.Copy()
-			alpha := ai.loadSharedAlpha()
-
-			score, continuation := ai.searchRootMove(gameCopy, &ai.buffers[cpuID], cpuID, candidate, alpha, beta)
-			results[slot] = candidateResult{score: score, continuation: continuation}
-		}(i, candidate)
+			buffer := &s.buffers[cpu]
+
+			for i := int(next.Add(1)) - 1; i < len(candidates); i = int(next.Add(1)) - 1 {
+				results[i] = s.searchRootMove(gameCopy, buffer, cpu, candidates[i], s.loadSharedAlpha(), beta)
+				s.progress.improve(results[i].score, results[i].continuation)
+				done[i].Store(true)
+			}
+
+			for s.canHelp() && !s.stopFlag.Load() {
+				target := -1 // The running candidate with the fewest helpers.
+				for i := range candidates {
+					if !done[i].Load() && (target < 0 || helpers[i].Load() < helpers[target].Load()) {
+						target = i
+					}
+				}
+				if target < 0 {
+					return
+				}
+
+				helper := helpers[target].Add(1)
+				s.help(gameCopy, buffer, cpu, candidates[target], &done[target], int(helper)%2, beta)
+				helpers[target].Add(-1)
+
+				if !done[target].Load() { // Out of depth.
+					return
+				}
+			}
+		}()
 	}
 	wg.Wait()
 
-	for _, result := range results {
-		if result.score > bestScore {
-			bestScore = result.score
-			bestContinuation = result.continuation
-		}
+	return results
+}
+
+// canHelp returns whether idle workers can help the others search, which takes the
+// transposition table to share their results through. Only Negamax uses it.
+func (s *search) canHelp() bool {
+	switch s.ai.algorithm {
+	case AlgorithmParanoid, AlgorithmMaxN, AlgorithmBRS:
+		return false
 	}
+	return s.tt != nil
+}
 
-	return bestScore, bestContinuation
+// help searches the candidate root move alongside the worker searching it, until the candidate
+// is done. The helper's results are discarded; they reach the worker through the transposition
+// table, which also orders its moves. Every other helper searches a ply deeper than the worker,
+// so that the helpers do not all search the same tree, and they deepen further as long as
+// the candidate is running and the buffer has the depth.
+func (s *search) help(g *game.Game, buffer *buffer, cpu int, candidate moveScore, done *atomic.Bool, extraDepth int, beta float64) {
+	buffer.helping = done
+	defer func() {
+		buffer.helping = nil
+		buffer.depth = s.depth
+	}()
+
+	buffer.played[1] = candidate.move
+	capturedPiece := g.Play(candidate.move)
+	defer g.UnplayMove(candidate.move, capturedPiece)
+
+	// Negamax writes the continuation a ply below the depth, and the quiescence search goes deeper.
+	maxDepth := len(buffer.continuation) - 2 - s.ai.quiescence
+	for depth := s.depth + extraDepth; depth <= maxDepth && !s.stopped(buffer); depth++ {
+		buffer.depth = depth
+		s.Negamax(g, buffer, cpu, 2, -candidate.score, -beta, -s.loadSharedAlpha())
+	}
 }
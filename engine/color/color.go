@@ -1,7 +1,5 @@
 package color
 
-import "fmt"
-
 type Color string
 
 var (
@@ -14,6 +12,5 @@ var (
 )
 
 func init() {
-	Reset = White
-	fmt.Print(Reset)
+	Reset = White // The terminal's text is white (see play.RunCLI).
 }
@@ -0,0 +1,215 @@
+package game
+
+import "math"
+
+// AttackMap holds the number of a player's pieces that attack every square. The squares of the
+// player's team are attacked as well: defended.
+type AttackMap [BoardSize][BoardSize]uint8
+
+// Count returns the number of the player's pieces that attack the square.
+func (m *AttackMap) Count(square Square) int {
+	return int(m[square.Rank][square.File])
+}
+
+// attackMaps caches the attack maps of a board by its hash.
+type attackMaps struct {
+	hashes [4]uint64
+	valid  [4]bool
+	maps   [4]AttackMap
+}
+
+// AttackMap returns the attack map of the player. It is computed once per position of the pieces,
+// and cached by the board until they move; so, like the moves, it is not safe for concurrent use.
+// The cache is keyed by the hash: after writing the grid directly, e.g. decoding it from JSON,
+// call SetPieceSquares, which the other methods need as well.
+func (b *Board) AttackMap(player Player) AttackMap {
+	if b.attackMaps == nil {
+		b.attackMaps = &attackMaps{}
+	}
+	cache := b.attackMaps
+	if cache.valid[player] && cache.hashes[player] == b.hash {
+		return cache.maps[player]
+	}
+
+	m := &cache.maps[player]
+	*m = AttackMap{}
+	var attacks [4 * BoardSize]Square // Enough for a queen.
+	for from := range b.PieceSquares[player] {
+		for _, square := range b.Attacks(from, attacks[:0]) {
+			m[square.Rank][square.File]++
+		}
+	}
+	cache.hashes[player], cache.valid[player] = b.hash, true
+
+	return *m
+}
+
+// Attacks appends the squares the piece on from attacks to dst and returns the extended slice:
+// the squares it could capture on, were an opponent's piece there, whatever is on them.
+func (b *Board) Attacks(from Square, dst []Square) []Square {
+	piece := b.GetPiece(from)
+
+	switch piece.Kind() {
+	case KindPawn:
+		for _, dir := range pawnCaptureDirs[piece.Player()] {
+			if to := from.Add(dir[0], dir[1]); to.IsValid() {
+				dst = append(dst, to)
+			}
+		}
+	case KindKnight, KindKing:
+		dirs := knightDirs
+		if piece.Kind() == KindKing {
+			dirs = kingDirs
+		}
+		for _, dir := range dirs {
+			if to := from.Add(dir[0], dir[1]); to.IsValid() {
+				dst = append(dst, to)
+			}
+		}
+	case KindBishop, KindRook, KindQueen:
+		for i, dir := range queenDirs {
+			if !attacksAlong(piece, i, 2) {
+				continue
+			}
+			for dist := 1; ; dist++ {
+				to := from.Add(dist*dir[0], dist*dir[1])
+				if !to.IsValid() {
+					break
+				}
+				dst = append(dst, to)
+				if !b.IsEmpty(to) {
+					break
+				}
+			}
+		}
+	}
+
+	return dst
+}
+
+// Attackers appends the squares of the player's pieces that attack the square to dst and returns
+// the extended slice.
+func (b *Board) Attackers(square Square, player Player, dst []Square) []Square {
+	for _, dir := range pawnCaptureDirs[player] {
+		if s := square.Add(-dir[0], -dir[1]); s.IsValid() && b.GetPiece(s) == NewPiece(player, KindPawn) {
+			dst = append(dst, s)
+		}
+	}
+	for _, dir := range knightDirs {
+		if s := square.Add(dir[0], dir[1]); s.IsValid() && b.GetPiece(s) == NewPiece(player, KindKnight) {
+			dst = append(dst, s)
+		}
+	}
+	for i, dir := range queenDirs {
+		if s, piece, dist := b.firstPiece(square, dir); dist > 0 && piece.Player() == player && attacksAlong(piece, i, dist) {
+			dst = append(dst, s)
+		}
+	}
+	return dst
+}
+
+// IsAttacked reports whether a piece of the player attacks the square.
+func (b *Board) IsAttacked(square Square, player Player) bool {
+	_, ok := b.leastValuableAttacker(square, player)
+	return ok
+}
+
+// KingSquare returns the square of the player's king, if the player has one.
+func (b *Board) KingSquare(player Player) (Square, bool) {
+	for square := range b.PieceSquares[player] {
+		if b.GetPiece(square).Kind() == KindKing {
+			return square, true
+		}
+	}
+	return Square{}, false
+}
+
+// IsKingAttacked reports whether a piece of either opponent attacks the player's king.
+func (b *Board) IsKingAttacked(player Player) bool {
+	king, ok := b.KingSquare(player)
+	return ok && (b.IsAttacked(king, (player+1)%4) || b.IsAttacked(king, (player+3)%4))
+}
+
+// Pin is a piece pinned against its king: moving it off the line to the pinner exposes the king.
+type Pin struct {
+	Square Square // The pinned piece.
+	Pinner Square // The opponent's rook, bishop or queen that attacks the king through it.
+}
+
+// Pins appends the player's pieces that are pinned against its king to dst and returns the extended
+// slice. A piece of the partner in the way shields the king too, but it is not the player's to move.
+func (b *Board) Pins(player Player, dst []Pin) []Pin {
+	king, ok := b.KingSquare(player)
+	if !ok {
+		return dst
+	}
+
+	for i, dir := range queenDirs {
+		square, piece, dist := b.firstPiece(king, dir)
+		if dist == 0 || piece.Player() != player {
+			continue
+		}
+		pinner, piece, pinnerDist := b.firstPiece(square, dir)
+		if pinnerDist > 0 && !piece.Player().IsTeamMate(player) && attacksAlong(piece, i, dist+pinnerDist) {
+			dst = append(dst, Pin{Square: square, Pinner: pinner})
+		}
+	}
+
+	return dst
+}
+
+// firstPiece returns the first piece from the square in the direction, and its square and distance
+// (0 if there is none before the edge of the board).
+func (b *Board) firstPiece(from Square, dir [2]int) (square Square, piece Piece, dist int) {
+	for dist := 1; ; dist++ {
+		s := from.Add(dist*dir[0], dist*dir[1])
+		if !s.IsValid() {
+			return Square{}, EmptySquare, 0
+		}
+		if piece := b.GetPiece(s); !piece.IsEmpty() {
+			return s, piece, dist
+		}
+	}
+}
+
+// attacksAlong reports whether the piece attacks the square the distance away in the direction
+// queenDirs[dir] (in either sense), with nothing between them.
+func attacksAlong(piece Piece, dir, dist int) bool {
+	switch piece.Kind() {
+	case KindQueen:
+		return true
+	case KindRook:
+		return dir < len(rookDirs)
+	case KindBishop:
+		return dir >= len(rookDirs)
+	case KindKing:
+		return dist == 1
+	}
+	return false
+}
+
+// leastValuableAttacker returns the square of the player's least valuable piece that attacks the
+// square, by their values in the static exchange evaluation.
+func (b *Board) leastValuableAttacker(square Square, player Player) (from Square, ok bool) {
+	for _, dir := range pawnCaptureDirs[player] {
+		if s := square.Add(-dir[0], -dir[1]); s.IsValid() && b.GetPiece(s) == NewPiece(player, KindPawn) {
+			return s, true
+		}
+	}
+	for _, dir := range knightDirs {
+		if s := square.Add(dir[0], dir[1]); s.IsValid() && b.GetPiece(s) == NewPiece(player, KindKnight) {
+			return s, true
+		}
+	}
+
+	// The sliders and the king: the first piece in every direction.
+	value := math.MaxFloat64
+	for i, dir := range queenDirs {
+		s, piece, dist := b.firstPiece(square, dir)
+		if dist > 0 && piece.Player() == player && attacksAlong(piece, i, dist) && seeValue(piece) < value {
+			from, ok, value = s, true, seeValue(piece)
+		}
+	}
+
+	return from, ok
+}
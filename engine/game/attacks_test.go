@@ -0,0 +1,82 @@
+package game_test
+
+import (
+	. "github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+func (s *TestSuite) TestAttacks() {
+	r := s.Require()
+
+	// The attack maps agree with the attackers of every square, and follow the moves.
+	g := New()
+	for range 16 {
+		for player := range Player(4) {
+			m := g.Board.AttackMap(player)
+			for rank := range BoardSize {
+				for file := range BoardSize {
+					square := Square{Rank: rank, File: file}
+					if !square.IsValid() {
+						continue
+					}
+					attackers := g.Board.Attackers(square, player, nil)
+					r.Equal(len(attackers), m.Count(square), "%v on %v", player, square)
+					r.Equal(len(attackers) > 0, g.Board.IsAttacked(square, player), "%v on %v", player, square)
+				}
+			}
+			r.Equal(g.Copy().Board.AttackMap(player), m)
+		}
+		g.Play(g.GetMoves(nil)[0])
+	}
+
+	b := NewBoard()
+	for _, p := range []struct {
+		piece  Piece
+		square string
+	}{
+		{NewPiece(0, KindKing), "h1"},
+		{NewPiece(0, KindKnight), "h3"}, // Pinned by the rook.
+		{NewPiece(0, KindPawn), "i2"},   // Pinned by the bishop.
+		{NewPiece(0, KindQueen), "f1"},  // Not pinned by a bishop.
+		{NewPiece(2, KindPawn), "g2"},   // The partner's.
+		{NewPiece(1, KindRook), "h8"},   // Through the knight.
+		{NewPiece(3, KindBishop), "l5"}, // Through the pawn.
+		{NewPiece(1, KindBishop), "d1"}, // Through the queen, on a rank.
+		{NewPiece(3, KindQueen), "e4"},  // Through the partner's pawn.
+	} {
+		b.PlacePiece(p.piece, SquareFromPGN(p.square))
+	}
+
+	r.ElementsMatch([]Pin{
+		{Square: SquareFromPGN("h3"), Pinner: SquareFromPGN("h8")},
+		{Square: SquareFromPGN("i2"), Pinner: SquareFromPGN("l5")},
+	}, b.Pins(0, nil))
+	r.Empty(b.Pins(1, nil), "blue has no king")
+
+	m := b.AttackMap(0)
+	r.Equal(3, m.Count(SquareFromPGN("g1")), "the king, queen and knight")
+	r.False(b.IsKingAttacked(0))
+	m = b.AttackMap(1)
+	r.Zero(m.Count(SquareFromPGN("h1")))
+
+	b.PlacePiece(NewPiece(1, KindKnight), SquareFromPGN("g3"))
+	r.True(b.IsKingAttacked(0))
+	r.Equal([]Square{SquareFromPGN("g3")}, b.Attackers(SquareFromPGN("h1"), 1, nil))
+	m = b.AttackMap(1)
+	r.Equal(1, m.Count(SquareFromPGN("h1")), "the cached map is updated")
+
+	// A map computed while the grid was written directly, and the hash out of date, is dropped
+	// once SetPieceSquares sets the hash from the grid.
+	b.PlacePiece(NewPiece(0, KindPawn), SquareFromPGN("k2"))
+	g3 := SquareFromPGN("g3")
+	b.Grid[g3.Rank][g3.File] = EmptySquare
+	m = b.AttackMap(1)
+	r.Zero(m.Count(SquareFromPGN("h1")))
+	b.Grid[g3.Rank][g3.File] = NewPiece(1, KindKnight)
+	b.SetPieceSquares()
+	m = b.AttackMap(1)
+	r.Equal(1, m.Count(SquareFromPGN("h1")), "the cached map is dropped")
+
+	b.Clear()
+	m = b.AttackMap(1)
+	r.Zero(m.Count(SquareFromPGN("h1")))
+}
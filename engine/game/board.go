@@ -9,6 +9,9 @@ const (
 type Board struct {
 	Grid         [BoardSize][BoardSize]Piece    `json:"grid"`
 	PieceSquares map[Player]map[Square]struct{} `json:"-"`
+
+	hash       uint64      // Zobrist hash of the pieces, kept up to date by the methods (see Hash).
+	attackMaps *attackMaps // Cache of AttackMap; nil until it is first used.
 }
 
 // NewBoard creates a new board.
@@ -53,12 +56,16 @@ func (b *Board) Clear() {
 
 // PlacePiece places a piece onto the board.
 func (b *Board) PlacePiece(piece Piece, square Square) {
+	b.hash ^= zobristPiece(b.GetPiece(square), square) ^ zobristPiece(piece, square)
 	b.Grid[square.Rank][square.File] = piece
 	b.PieceSquares[piece.Player()][square] = struct{}{}
 }
 
-// SetPieceSquares sets PieceSquares.
+// SetPieceSquares sets PieceSquares, and the hash, from the grid, and drops the cached attack maps.
 func (b *Board) SetPieceSquares() {
+	b.setHash()
+	b.attackMaps = nil
+
 	b.PieceSquares = map[Player]map[Square]struct{}{}
 	for player := 0; player < 4; player++ {
 		b.PieceSquares[Player(player)] = map[Square]struct{}{}
@@ -106,6 +113,7 @@ func (b *Board) SetStartingPosition() {
 func (b *Board) Copy() *Board {
 	board := *b
 	board.PieceSquares = map[Player]map[Square]struct{}{}
+	board.attackMaps = nil
 
 	for player := range b.PieceSquares {
 		copy := map[Square]struct{}{}
@@ -129,17 +137,23 @@ func (b *Board) Move(move Move) {
 		delete(b.PieceSquares[opponent], move.To)
 	}
 
-	player := Piece(b.GetPiece(move.From)).Player()
+	piece := Piece(b.GetPiece(move.From))
+	player := piece.Player()
 
 	delete(b.PieceSquares[player], move.From)
 	b.PieceSquares[player][move.To] = struct{}{}
 
+	b.hash ^= zobristPiece(piece, move.From) ^ zobristPiece(piece, move.To) ^ zobristPiece(b.GetPiece(move.To), move.To)
+
 	b.Grid[move.To.Rank][move.To.File] = b.Grid[move.From.Rank][move.From.File]
 	b.Grid[move.From.Rank][move.From.File] = Piece(EmptySquare)
 }
 
 // Unmove undoes a move of a piece on the board.
 func (b *Board) Unmove(move Move, capturedPiece Piece) {
+	piece := b.GetPiece(move.To)
+	b.hash ^= zobristPiece(piece, move.To) ^ zobristPiece(piece, move.From) ^ zobristPiece(capturedPiece, move.To)
+
 	b.Grid[move.From.Rank][move.From.File] = b.Grid[move.To.Rank][move.To.File]
 	b.Grid[move.To.Rank][move.To.File] = capturedPiece
 
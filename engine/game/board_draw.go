@@ -2,35 +2,57 @@ package game
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
 	"github.com/vpoliakov01/2v2ChessAI/engine/color"
 )
 
 // Draw draws the board. Clunky but does the job.
 func (b *Board) Draw() {
-	fmt.Print("    ")
+	b.draw(os.Stdout, Piece.String, string(color.Reset))
+}
+
+// Text returns the board drawn like Draw, but without colors: the pieces are in the
+// FEN notation, e.g. rK.
+func (b *Board) Text() string {
+	sb := strings.Builder{}
+	b.draw(&sb, func(p Piece) string {
+		if p == EmptySquare || p == InactiveSquare {
+			return p.String()
+		}
+		return fmt.Sprintf("%-3v", p.fen())
+	}, "")
+	return sb.String()
+}
+
+// draw draws the board to w, each square as drawn by square (3 characters wide).
+// reset precedes the lines between the ranks.
+func (b *Board) draw(w io.Writer, square func(Piece) string, reset string) {
+	fmt.Fprint(w, "    ")
 	for file := 0; file < BoardSize; file++ {
-		fmt.Printf(" %v  ", fmt.Sprintf("%c", int('A')+file))
+		fmt.Fprintf(w, " %v  ", fmt.Sprintf("%c", int('A')+file))
 	}
-	fmt.Println()
+	fmt.Fprintln(w)
 
 	for rank := BoardSize - 1; rank >= 0; rank-- {
-		fmt.Println(color.Reset, "  +---+---+---+---+---+---+---+---+---+---+---+---+---+---+")
+		fmt.Fprintln(w, reset+"   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+")
 
-		fmt.Printf("%2v ", rank+1)
+		fmt.Fprintf(w, "%2v ", rank+1)
 
 		for file := 0; file < BoardSize; file++ {
-			fmt.Printf("|%v", b.GetPiece(Square{rank, file}))
+			fmt.Fprintf(w, "|%v", square(b.GetPiece(Square{rank, file})))
 		}
 
-		fmt.Printf("| %-2v\n", rank+1)
+		fmt.Fprintf(w, "| %-2v\n", rank+1)
 	}
-	fmt.Println(color.Reset, "  +---+---+---+---+---+---+---+---+---+---+---+---+---+---+")
+	fmt.Fprintln(w, reset+"   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+")
 
-	fmt.Print("    ")
+	fmt.Fprint(w, "    ")
 	for file := 0; file < BoardSize; file++ {
-		fmt.Printf(" %v  ", fmt.Sprintf("%c", int('A')+file))
+		fmt.Fprintf(w, " %v  ", fmt.Sprintf("%c", int('A')+file))
 	}
 
-	fmt.Println()
+	fmt.Fprintln(w)
 }
@@ -0,0 +1,60 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	svgSquareSize  = 40 // Pixels.
+	svgLightSquare = "#eeeed2"
+	svgDarkSquare  = "#b58863"
+)
+
+var svgColors = map[Player]string{
+	0: "#d32f2f",
+	1: "#1976d2",
+	2: "#f9a825",
+	3: "#388e3c",
+}
+
+// SVG returns the board as an SVG image, with Red at the bottom and the files and ranks labeled.
+func (b *Board) SVG() string {
+	size := (BoardSize + 1) * svgSquareSize // Plus the labels.
+	sb := strings.Builder{}
+
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%v" height="%v" viewBox="0 0 %v %v">`, size, size, size, size)
+	fmt.Fprintf(&sb, `<rect width="%v" height="%v" fill="white"/>`, size, size)
+
+	for rank := 0; rank < BoardSize; rank++ {
+		for file := 0; file < BoardSize; file++ {
+			if !IsSquareValid(rank, file) {
+				continue
+			}
+			x, y := (file+1)*svgSquareSize, (BoardSize-1-rank)*svgSquareSize
+
+			fill := svgDarkSquare
+			if (rank+file)%2 == 1 {
+				fill = svgLightSquare
+			}
+			fmt.Fprintf(&sb, `<rect x="%v" y="%v" width="%v" height="%v" fill="%v"/>`, x, y, svgSquareSize, svgSquareSize, fill)
+
+			piece := b.GetPiece(Square{rank, file})
+			if piece.IsEmpty() {
+				continue
+			}
+			fmt.Fprintf(&sb, `<text x="%v" y="%v" font-size="%v" text-anchor="middle" dominant-baseline="central" fill="%v">%v</text>`,
+				x+svgSquareSize/2, y+svgSquareSize/2, svgSquareSize*4/5, svgColors[piece.Player()], printMap[piece.Kind()])
+		}
+	}
+
+	for i := 0; i < BoardSize; i++ {
+		fmt.Fprintf(&sb, `<text x="%v" y="%v" font-size="%v" text-anchor="middle" dominant-baseline="central">%c</text>`,
+			(i+1)*svgSquareSize+svgSquareSize/2, BoardSize*svgSquareSize+svgSquareSize/2, svgSquareSize/3, 'a'+i)
+		fmt.Fprintf(&sb, `<text x="%v" y="%v" font-size="%v" text-anchor="middle" dominant-baseline="central">%v</text>`,
+			svgSquareSize/2, (BoardSize-1-i)*svgSquareSize+svgSquareSize/2, svgSquareSize/3, i+1)
+	}
+
+	sb.WriteString("</svg>")
+	return sb.String()
+}
@@ -0,0 +1,103 @@
+package game
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var timeControlRegex = regexp.MustCompile(`^(\d+)(?:\+(\d+))?(?:d(\d+))?$`)
+
+// TimeControl is the time every player gets for the game.
+type TimeControl struct {
+	Base      time.Duration // Time at the start of the game.
+	Increment time.Duration // Time added after each move.
+	Delay     time.Duration // Time at the start of each move that is not charged (simple delay).
+}
+
+// ParseTimeControl parses a time control in seconds: "<base>[+<increment>][d<delay>]",
+// e.g. "300+2" or "600d5". The empty string means an untimed game.
+func ParseTimeControl(s string) (TimeControl, error) {
+	if s == "" || s == "-" {
+		return TimeControl{}, nil
+	}
+
+	matches := timeControlRegex.FindStringSubmatch(s)
+	if matches == nil {
+		return TimeControl{}, fmt.Errorf("invalid time control %q", s)
+	}
+
+	durations := [3]time.Duration{}
+	for i, match := range matches[1:] {
+		if match == "" {
+			continue
+		}
+		seconds, err := strconv.Atoi(match)
+		if err != nil {
+			return TimeControl{}, fmt.Errorf("invalid time control %q: %w", s, err)
+		}
+		durations[i] = time.Duration(seconds) * time.Second
+	}
+
+	if durations[0] == 0 {
+		return TimeControl{}, fmt.Errorf("invalid time control %q: no base time", s)
+	}
+
+	return TimeControl{Base: durations[0], Increment: durations[1], Delay: durations[2]}, nil
+}
+
+// IsZero returns whether the time control is untimed.
+func (tc TimeControl) IsZero() bool {
+	return tc.Base == 0
+}
+
+// String returns the time control in the format of ParseTimeControl ("-" if untimed).
+func (tc TimeControl) String() string {
+	if tc.IsZero() {
+		return "-"
+	}
+
+	s := fmt.Sprint(int(tc.Base.Seconds()))
+	if tc.Increment > 0 {
+		s += fmt.Sprintf("+%v", int(tc.Increment.Seconds()))
+	}
+	if tc.Delay > 0 {
+		s += fmt.Sprintf("d%v", int(tc.Delay.Seconds()))
+	}
+	return s
+}
+
+// Clock is the chess clock of the four seats. Only the active player's clock runs.
+type Clock struct {
+	TimeControl
+	Remaining [4]time.Duration // Time left as of the start of the current turn.
+	TurnStart time.Time        // When the current turn started.
+	Flagged   bool             // Whether the active player ran out of time.
+}
+
+// NewClock creates a clock of the time control that starts running at the given time.
+func NewClock(tc TimeControl, now time.Time) *Clock {
+	c := &Clock{TimeControl: tc, TurnStart: now}
+	for player := range c.Remaining {
+		c.Remaining[player] = tc.Base
+	}
+	return c
+}
+
+// Left returns the time the player has left at the given time. The active player's
+// current turn counts, after the delay.
+func (c *Clock) Left(player, active Player, now time.Time) time.Duration {
+	if player != active || c.Flagged {
+		return c.Remaining[player]
+	}
+	return c.Remaining[player] - max(now.Sub(c.TurnStart)-c.Delay, 0)
+}
+
+// press charges the active player for the turn ending at the given time, adds the increment,
+// and starts the next turn. Returns the time the player has left.
+func (c *Clock) press(active Player, now time.Time) time.Duration {
+	c.Remaining[active] = c.Left(active, active, now) + c.Increment
+	c.TurnStart = now
+	return c.Remaining[active]
+}
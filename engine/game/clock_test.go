@@ -0,0 +1,65 @@
+package game_test
+
+import (
+	"time"
+
+	. "github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+func (s *TestSuite) TestParseTimeControl() {
+	r := s.Require()
+
+	tc, err := ParseTimeControl("300+2d1")
+	r.NoError(err)
+	r.Equal(TimeControl{Base: 5 * time.Minute, Increment: 2 * time.Second, Delay: time.Second}, tc)
+	r.Equal("300+2d1", tc.String())
+
+	tc, err = ParseTimeControl("")
+	r.NoError(err)
+	r.True(tc.IsZero())
+
+	for _, invalid := range []string{"5m", "0+2", "+2", "300+"} {
+		_, err = ParseTimeControl(invalid)
+		r.Error(err, invalid)
+	}
+}
+
+func (s *TestSuite) TestClock() {
+	r := s.Require()
+	start := time.Now()
+
+	session := NewGameSession()
+	session.SetTimeControl(TimeControl{Base: time.Minute, Increment: 2 * time.Second, Delay: time.Second}, start)
+
+	// Red thinks for 5s, of which the first second is free, and gets the increment.
+	session.PlayAt(Move{From: Square{1, 7}, To: Square{2, 7}}, start.Add(5*time.Second))
+	r.Equal(58*time.Second, session.Clock.Remaining[0])
+	r.Equal(time.Minute, session.Clock.Left(1, session.ActivePlayer, start.Add(5*time.Second)))
+	r.Equal(50*time.Second, session.Clock.Left(1, session.ActivePlayer, start.Add(16*time.Second)))
+
+	r.False(session.CheckTime(start.Add(65 * time.Second)))
+	r.True(session.CheckTime(start.Add(67 * time.Second)))
+	r.True(session.HasEnded())
+	r.True(session.Clock.Flagged)
+	r.Equal(Player(0).Team(), session.Winner, "Blue ran out of time, so Red/Yellow win")
+}
+
+func (s *TestSuite) TestClockPGN() {
+	r := s.Require()
+	start := time.Now()
+
+	session := NewGameSession()
+	session.SetTimeControl(TimeControl{Base: 5 * time.Minute, Increment: 2 * time.Second}, start)
+	session.PlayAt(Move{From: Square{1, 7}, To: Square{2, 7}}, start.Add(3500*time.Millisecond))
+	session.PlayAt(Move{From: Square{7, 1}, To: Square{7, 2}}, start.Add(10*time.Second))
+
+	pgn := session.PGN()
+	r.Equal("[TimeControl \"300+2\"]\n1. h2-h3 {[%clk 0:04:58.5]} b8-c8 {[%clk 0:04:55.5]}", pgn)
+
+	loaded, err := LoadPGN(pgn)
+	r.NoError(err)
+	r.Equal(session.PastMoves, loaded.PastMoves)
+	r.Equal(session.Clocks, loaded.Clocks)
+	r.Equal(session.Clock.TimeControl, loaded.Clock.TimeControl)
+	r.Equal(session.Clock.Remaining, loaded.Clock.Remaining)
+}
@@ -0,0 +1,167 @@
+package game
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FEN layout: "<rank 14>/<rank 13>/.../<rank 1> <active player> <move number>".
+// Each rank lists its 14 squares from file a to n as comma separated tokens:
+// a piece is the player letter followed by the kind letter (e.g. rK, yP),
+// and a number is a run of empty squares (the cut out corners count as empty).
+// The active player is one of r, b, y, g.
+
+var (
+	fenPlayers = [4]byte{'r', 'b', 'y', 'g'}
+	fenKinds   = map[PieceKind]byte{
+		KindPawn:   'P',
+		KindKnight: 'N',
+		KindBishop: 'B',
+		KindRook:   'R',
+		KindQueen:  'Q',
+		KindKing:   'K',
+	}
+)
+
+// FEN returns the position in the 4 player FEN notation.
+func (g *Game) FEN() string {
+	ranks := make([]string, 0, BoardSize)
+
+	for rank := BoardSize - 1; rank >= 0; rank-- {
+		tokens := []string{}
+		empty := 0
+
+		for file := 0; file < BoardSize; file++ {
+			square := Square{rank, file}
+			if !square.IsValid() || g.Board.IsEmpty(square) {
+				empty++
+				continue
+			}
+
+			if empty > 0 {
+				tokens = append(tokens, strconv.Itoa(empty))
+				empty = 0
+			}
+
+			tokens = append(tokens, g.Board.GetPiece(square).fen())
+		}
+
+		if empty > 0 {
+			tokens = append(tokens, strconv.Itoa(empty))
+		}
+		ranks = append(ranks, strings.Join(tokens, ","))
+	}
+
+	return fmt.Sprintf("%v %c %v", strings.Join(ranks, "/"), fenPlayers[g.ActivePlayer], g.MoveNumber)
+}
+
+// fen returns the piece in the FEN notation, e.g. rK.
+func (p Piece) fen() string {
+	return string([]byte{fenPlayers[p.Player()], fenKinds[p.Kind()]})
+}
+
+// LoadFEN returns the game defined by the 4 player FEN notation.
+// The active player and the move number are optional and default to Red and 1.
+func LoadFEN(fen string) (*Game, error) {
+	fields := strings.Fields(fen)
+	if len(fields) == 0 || len(fields) > 3 {
+		return nil, fmt.Errorf("fen %q must have 1 to 3 fields", fen)
+	}
+
+	g := New()
+	g.Board.Clear()
+
+	ranks := strings.Split(fields[0], "/")
+	if len(ranks) != BoardSize {
+		return nil, fmt.Errorf("fen has %v ranks, expected %v", len(ranks), BoardSize)
+	}
+
+	for i, rankStr := range ranks {
+		rank := BoardSize - 1 - i
+		file := 0
+
+		for _, token := range strings.Split(rankStr, ",") {
+			if empty, err := strconv.Atoi(token); err == nil {
+				if empty <= 0 {
+					return nil, fmt.Errorf("rank %v: invalid empty square count %q", rank+1, token)
+				}
+				file += empty
+				continue
+			}
+
+			piece, err := pieceFromFEN(token)
+			if err != nil {
+				return nil, fmt.Errorf("rank %v: %v", rank+1, err)
+			}
+
+			square := Square{rank, file}
+			if !square.IsValid() {
+				return nil, fmt.Errorf("rank %v: piece %q is placed on an inactive square %v", rank+1, token, square)
+			}
+
+			g.Board.PlacePiece(piece, square)
+			file++
+		}
+
+		if file != BoardSize {
+			return nil, fmt.Errorf("rank %v has %v squares, expected %v", rank+1, file, BoardSize)
+		}
+	}
+
+	if len(fields) > 1 {
+		player, err := playerFromFEN(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		g.ActivePlayer = player
+	}
+
+	if len(fields) > 2 {
+		moveNumber, err := strconv.Atoi(fields[2])
+		if err != nil || moveNumber < 1 {
+			return nil, fmt.Errorf("invalid move number %q", fields[2])
+		}
+		g.MoveNumber = moveNumber
+	}
+
+	// A position without a king is a finished game.
+	for player := Player(0); player < 4; player++ {
+		if !g.HasKing(player) {
+			g.Winner = player.Team().Opposite()
+			break
+		}
+	}
+
+	return g, nil
+}
+
+// pieceFromFEN parses a piece token such as "rK".
+func pieceFromFEN(token string) (Piece, error) {
+	if len(token) != 2 {
+		return EmptySquare, fmt.Errorf("invalid piece %q", token)
+	}
+
+	player, err := playerFromFEN(token[:1])
+	if err != nil {
+		return EmptySquare, err
+	}
+
+	for kind, letter := range fenKinds {
+		if token[1] == letter {
+			return NewPiece(player, kind), nil
+		}
+	}
+
+	return EmptySquare, fmt.Errorf("invalid piece kind %q", token[1:])
+}
+
+// playerFromFEN parses a player letter (r, b, y, g).
+func playerFromFEN(s string) (Player, error) {
+	for player, letter := range fenPlayers {
+		if s == string(letter) {
+			return Player(player), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid player %q", s)
+}
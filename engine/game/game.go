@@ -9,6 +9,7 @@ type Game struct {
 	ActivePlayer Player
 	Board        *Board
 	Winner       Team // Red/Yellow win: 1, Blue/Green win: -1.
+	Drawn        bool // Whether the game ended in a draw.
 	MoveNumber   int
 
 	squareBuffer []Square `json:"-"` // Reusable per-piece destination buffer for GetMoves; not shared across copies.
@@ -86,7 +87,7 @@ func (g *Game) HasKing(player Player) bool {
 
 // HasEnded returns whether the game has ended.
 func (g *Game) HasEnded() bool {
-	return g.Winner != 0
+	return g.Winner != 0 || g.Drawn
 }
 
 // Copy returns a deep copy of the game.
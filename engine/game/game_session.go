@@ -3,6 +3,7 @@ package game
 import (
 	"fmt"
 	"slices"
+	"time"
 )
 
 // GameSession represents a game with additional metadata.
@@ -10,6 +11,12 @@ type GameSession struct {
 	*Game
 	CurrentMove int
 	PastMoves   []Move
+
+	Clock  *Clock          // Nil for an untimed game.
+	Clocks []time.Duration // Time the mover had left after each past move; 0 where unknown.
+
+	Termination Termination // How the game ended; empty while it is in progress.
+	Loser       Player      // The player who lost their king, ran out of time or resigned.
 }
 
 // NewGameSession creates a new GameSession.
@@ -23,16 +30,59 @@ func NewGameSession() *GameSession {
 	}
 }
 
+// SetTimeControl starts the clocks of the time control at the given time for the rest of the game,
+// or stops timing the game if the time control is zero.
+func (g *GameSession) SetTimeControl(tc TimeControl, now time.Time) {
+	if tc.IsZero() {
+		g.Clock = nil
+		g.Clocks = nil
+		return
+	}
+
+	g.Clock = NewClock(tc, now)
+	g.Clocks = make([]time.Duration, len(g.PastMoves))
+}
+
 // Play plays a move in the game session.
 func (g *GameSession) Play(move Move) Piece {
+	return g.PlayAt(move, time.Now())
+}
+
+// PlayAt plays a move made at the given time in the game session, charging the mover's clock.
+func (g *GameSession) PlayAt(move Move, now time.Time) Piece {
 	g.PastMoves = g.PastMoves[:g.CurrentMove+1]
+	if g.Clock != nil {
+		g.Clocks = append(g.Clocks[:g.CurrentMove+1], g.Clock.press(g.ActivePlayer, now))
+	}
+
 	capturedPiece := g.Game.Play(move)
 	g.PastMoves = append(g.PastMoves, move)
 	g.CurrentMove++
 
+	if g.Winner != 0 {
+		g.Termination = TerminationKingCaptured
+		g.Loser = capturedPiece.Player()
+	}
+
 	return capturedPiece
 }
 
+// CheckTime ends the game if the active player ran out of time at the given time:
+// the player's team loses. Returns whether the player ran out of time.
+func (g *GameSession) CheckTime(now time.Time) bool {
+	if g.Clock == nil || g.HasEnded() {
+		return false
+	}
+	if g.Clock.Left(g.ActivePlayer, g.ActivePlayer, now) > 0 {
+		return false
+	}
+
+	g.Clock.Remaining[g.ActivePlayer] = 0
+	g.Clock.Flagged = true
+	g.end(g.ActivePlayer.Team().Opposite(), TerminationTime, g.ActivePlayer)
+	return true
+}
+
 // SetCurrentMove sets the current move index.
 func (g *GameSession) SetCurrentMove(moveIndex int) error {
 	if moveIndex < 0 || moveIndex > len(g.PastMoves) {
@@ -40,19 +90,70 @@ func (g *GameSession) SetCurrentMove(moveIndex int) error {
 	}
 	g.CurrentMove = moveIndex
 
+	g.replay()
+	return nil
+}
+
+// TakeBack takes back the current move: it is removed from the game along with the moves after it.
+func (g *GameSession) TakeBack() error {
+	if g.CurrentMove < 0 {
+		return fmt.Errorf("no move to take back")
+	}
+
+	g.PastMoves = g.PastMoves[:g.CurrentMove]
+	if len(g.Clocks) > g.CurrentMove {
+		g.Clocks = g.Clocks[:g.CurrentMove]
+	}
+	g.CurrentMove--
+	g.replay()
+
+	return nil
+}
+
+// replay sets up the position after the current move, which undoes the end of the game
+// if it came later.
+func (g *GameSession) replay() {
 	g.Game = New()
-	for i := 0; i <= moveIndex; i++ {
+	for i := 0; i <= g.CurrentMove; i++ {
 		g.Game.Play(g.PastMoves[i])
 	}
+	g.restoreClock(time.Now())
 
-	return nil
+	g.Termination = ""
+	if g.Winner != 0 {
+		g.Termination = TerminationKingCaptured
+	}
+}
+
+// restoreClock sets the clock to the times the players had left after their last move
+// up to the current one, and starts the active player's turn at the given time.
+func (g *GameSession) restoreClock(now time.Time) {
+	if g.Clock == nil {
+		return
+	}
+
+	clock := NewClock(g.Clock.TimeControl, now)
+	for i := 0; i <= g.CurrentMove && i < len(g.Clocks); i++ {
+		if g.Clocks[i] > 0 {
+			clock.Remaining[i%4] = g.Clocks[i]
+		}
+	}
+	g.Clock = clock
 }
 
 // Copy returns a deep copy of the game session.
 func (g *GameSession) Copy() *GameSession {
-	return &GameSession{
+	session := &GameSession{
 		Game:        g.Game.Copy(),
 		CurrentMove: g.CurrentMove,
 		PastMoves:   slices.Clone(g.PastMoves),
+		Clocks:      slices.Clone(g.Clocks),
+		Termination: g.Termination,
+		Loser:       g.Loser,
+	}
+	if g.Clock != nil {
+		clock := *g.Clock
+		session.Clock = &clock
 	}
+	return session
 }
@@ -0,0 +1,94 @@
+package game
+
+import "fmt"
+
+// Termination is how a game ended.
+type Termination string
+
+const (
+	TerminationKingCaptured Termination = "king"
+	TerminationTime         Termination = "time"
+	TerminationResignation  Termination = "resignation"
+	TerminationAgreement    Termination = "agreement"
+)
+
+// PGN results of the game.
+const (
+	ResultRedYellow  = "1-0"
+	ResultBlueGreen  = "0-1"
+	ResultDraw       = "1/2-1/2"
+	ResultInProgress = "*"
+)
+
+// Resign ends the game: the player's team loses.
+func (g *GameSession) Resign(player Player) error {
+	if g.HasEnded() {
+		return fmt.Errorf("the game has ended")
+	}
+
+	g.end(player.Team().Opposite(), TerminationResignation, player)
+	return nil
+}
+
+// AgreeDraw ends the game in a draw.
+func (g *GameSession) AgreeDraw() error {
+	if g.HasEnded() {
+		return fmt.Errorf("the game has ended")
+	}
+
+	g.Drawn = true
+	g.Termination = TerminationAgreement
+	return nil
+}
+
+// end ends the game with the team's win.
+func (g *GameSession) end(winner Team, termination Termination, loser Player) {
+	g.Winner = winner
+	g.Termination = termination
+	g.Loser = loser
+}
+
+// Result returns the result of the game in the PGN notation, Red/Yellow first.
+func (g *GameSession) Result() string {
+	switch {
+	case g.Drawn:
+		return ResultDraw
+	case g.Winner == 1:
+		return ResultRedYellow
+	case g.Winner == -1:
+		return ResultBlueGreen
+	default:
+		return ResultInProgress
+	}
+}
+
+// setResult ends the game with the PGN result, unless the moves ended it already.
+// The losing player is taken to be the one to move, or their teammate.
+func (g *GameSession) setResult(result string, termination Termination) error {
+	if g.HasEnded() {
+		return nil
+	}
+
+	switch result {
+	case ResultInProgress, "":
+		return nil
+	case ResultDraw:
+		g.Drawn = true
+		g.Termination = termination
+		return nil
+	case ResultRedYellow, ResultBlueGreen:
+		winner := Team(1)
+		if result == ResultBlueGreen {
+			winner = -1
+		}
+
+		loser := g.ActivePlayer
+		if loser.Team() == winner {
+			loser = (loser + 1) % 4
+		}
+		g.end(winner, termination, loser)
+		return nil
+	default:
+		return fmt.Errorf("invalid result %q", result)
+	}
+}
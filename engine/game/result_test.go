@@ -0,0 +1,56 @@
+package game_test
+
+import (
+	. "github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+func (s *TestSuite) TestResign() {
+	r := s.Require()
+
+	session := NewGameSession()
+	session.Play(MoveFromPGN("h2-h3"))
+	r.NoError(session.Resign(2))
+	r.Equal(Team(-1), session.Winner, "Yellow resigned for Red/Yellow")
+	r.Equal(ResultBlueGreen, session.Result())
+	r.Error(session.Resign(1), "the game has ended")
+
+	pgn := session.PGN()
+	r.Equal("[Result \"0-1\"]\n[Termination \"resignation\"]\n1. h2-h3", pgn)
+
+	loaded, err := LoadPGN(pgn)
+	r.NoError(err)
+	r.Equal(session.Winner, loaded.Winner)
+	r.Equal(TerminationResignation, loaded.Termination)
+	r.Equal(Player(2), loaded.Loser, "Blue is to move, so the loser is their teammate")
+}
+
+func (s *TestSuite) TestAgreeDraw() {
+	r := s.Require()
+
+	session := NewGameSession()
+	r.Equal(ResultInProgress, session.Result())
+	r.NoError(session.AgreeDraw())
+	r.True(session.HasEnded())
+	r.Empty(session.GetMoves(nil))
+
+	loaded, err := LoadPGN(session.PGN())
+	r.NoError(err)
+	r.True(loaded.Drawn)
+	r.Equal(ResultDraw, loaded.Result())
+	r.Equal(TerminationAgreement, loaded.Termination)
+}
+
+func (s *TestSuite) TestTakeBack() {
+	r := s.Require()
+
+	session := NewGameSession()
+	r.Error(session.TakeBack())
+
+	session.Play(MoveFromPGN("h2-h3"))
+	session.Play(MoveFromPGN("b7-c7"))
+	r.NoError(session.TakeBack())
+	r.Equal([]Move{MoveFromPGN("h2-h3")}, session.PastMoves)
+	r.Equal(0, session.CurrentMove)
+	r.Equal(Player(1), session.ActivePlayer)
+	r.True(session.Board.IsEmpty(MoveFromPGN("b7-c7").To))
+}
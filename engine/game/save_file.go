@@ -8,18 +8,33 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
-var moveRegex = regexp.MustCompile(`[QRBNK]?([a-n])([1-9][0-4]?){1,2}[-x]?[QRBNK]?([a-n])([1-9][0-4]?)(=[QRBN])?[+#]?`)
+var (
+	moveRegex    = regexp.MustCompile(`[QRBNK]?([a-n])([1-9][0-4]?){1,2}[-x]?[QRBNK]?([a-n])([1-9][0-4]?)(=[QRBN])?[+#]?`)
+	commentRegex = regexp.MustCompile(`^\{[^}]*\}$`)
+	tokenRegex   = regexp.MustCompile(`\{[^}]*\}|[^\s{]+`)
+	clockRegex   = regexp.MustCompile(`\[%clk (\d+):(\d\d):(\d\d(?:\.\d+)?)\]`)
+	tagRegex     = regexp.MustCompile(`^\[(\w+) "([^"]*)"\]`)
+)
 
 // JSON returns json of the game session object.
 func (g *GameSession) JSON() ([]byte, error) {
 	return json.Marshal(g)
 }
 
-// PGN returns the game session in pgn notation.
+// PGN returns the game session in pgn notation. The moves of a timed game are annotated
+// with the time the mover had left ([%clk]), and the result of an ended game is in the tags.
 func (g *GameSession) PGN() string {
 	pgn := ""
+	if g.HasEnded() {
+		pgn += fmt.Sprintf("[Result %q]\n[Termination %q]\n", g.Result(), g.Termination)
+	}
+	if g.Clock != nil {
+		pgn += fmt.Sprintf("[TimeControl %q]\n", g.Clock.TimeControl)
+	}
+
 	for i := 0; i < len(g.PastMoves); i += 4 {
 		if i > 0 && i%4 == 0 {
 			pgn += "\n"
@@ -27,11 +42,52 @@ func (g *GameSession) PGN() string {
 		pgn += fmt.Sprintf("%v.", i/4+1)
 		for j := 0; j < 4 && i+j < len(g.PastMoves); j++ {
 			pgn += fmt.Sprintf(" %v", g.PastMoves[i+j])
+			if i+j < len(g.Clocks) && g.Clocks[i+j] > 0 {
+				pgn += fmt.Sprintf(" {[%%clk %v]}", formatClock(g.Clocks[i+j]))
+			}
 		}
 	}
 	return pgn
 }
 
+// formatClock formats the time left as h:mm:ss, with tenths of a second if there are any.
+func formatClock(d time.Duration) string {
+	d = d.Round(100 * time.Millisecond)
+	s := fmt.Sprintf("%d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+	if tenths := d.Milliseconds() % 1000 / 100; tenths > 0 {
+		s += fmt.Sprintf(".%d", tenths)
+	}
+	return s
+}
+
+// parseClock returns the time of the [%clk] annotation in the comment, or 0 if there is none.
+func parseClock(comment string) (time.Duration, error) {
+	matches := clockRegex.FindStringSubmatch(comment)
+	if matches == nil {
+		return 0, nil
+	}
+
+	hours, _ := strconv.Atoi(matches[1])
+	minutes, _ := strconv.Atoi(matches[2])
+	seconds, err := strconv.ParseFloat(matches[3], 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(seconds*float64(time.Second)), nil
+}
+
+// parseTags returns the values of the pgn's tags by their names.
+func parseTags(pgn string) map[string]string {
+	tags := map[string]string{}
+	for _, line := range strings.Split(pgn, "\n") {
+		if matches := tagRegex.FindStringSubmatch(strings.TrimSpace(line)); matches != nil {
+			tags[matches[1]] = matches[2]
+		}
+	}
+	return tags
+}
+
 // LoadJSON returns the game session defined by the json.
 func LoadJSON(bytes []byte) (*GameSession, error) {
 	g := GameSession{}
@@ -48,7 +104,13 @@ func LoadJSON(bytes []byte) (*GameSession, error) {
 
 // LoadPGN returns the moves (pgn notation) specified in the file.
 func LoadPGN(pgn string) (*GameSession, error) {
-	moves, err := ParsePGN(pgn)
+	moves, clocks, err := parsePGN(pgn)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := parseTags(pgn)
+	tc, err := ParseTimeControl(tags["TimeControl"])
 	if err != nil {
 		return nil, err
 	}
@@ -58,6 +120,16 @@ func LoadPGN(pgn string) (*GameSession, error) {
 		g.Play(move)
 	}
 
+	if !tc.IsZero() {
+		g.SetTimeControl(tc, time.Now())
+		g.Clocks = clocks
+		g.restoreClock(time.Now())
+	}
+
+	if err := g.setResult(tags["Result"], Termination(tags["Termination"])); err != nil {
+		return nil, err
+	}
+
 	return g, nil
 }
 
@@ -91,26 +163,46 @@ func ParseMove(m string) (*Move, error) {
 
 // ParsePGN parses pgn from a string.
 func ParsePGN(pgn string) ([]Move, error) {
+	moves, _, err := parsePGN(pgn)
+	return moves, err
+}
+
+// parsePGN parses the moves from a pgn string, along with the time the mover had left
+// after each move ([%clk] annotations; 0 where missing).
+func parsePGN(pgn string) ([]Move, []time.Duration, error) {
 	lines := strings.Split(pgn, "\n")
 	moves := []Move{}
+	clocks := []time.Duration{}
 
 	for _, line := range lines {
 		if len(line) < 4 || line[0] == '[' {
 			continue
 		}
 
-		turnMovesStr := strings.Split(line, ". ")[1]
+		turnMovesStr := strings.SplitN(line, ". ", 2)[1]
+
+		for _, token := range tokenRegex.FindAllString(turnMovesStr, -1) {
+			if commentRegex.MatchString(token) {
+				if len(clocks) > 0 {
+					clock, err := parseClock(token)
+					if err != nil {
+						return nil, nil, err
+					}
+					clocks[len(clocks)-1] = clock
+				}
+				continue
+			}
 
-		for _, moveStr := range strings.Split(turnMovesStr, " ") {
-			move, err := ParseMove(moveStr)
+			move, err := ParseMove(token)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			moves = append(moves, *move)
+			clocks = append(clocks, 0)
 		}
 
 	}
-	return moves, nil
+	return moves, clocks, nil
 }
 
 // LoadFile attempts to load a game from pgn and if it fails,
@@ -121,17 +213,14 @@ func LoadFile(file string) (*GameSession, error) {
 		return nil, err
 	}
 
-	g, err := LoadPGN(string(bytes))
-	if err == nil {
+	g, pgnErr := LoadPGN(string(bytes))
+	if pgnErr == nil {
 		return g, nil
 	}
 
-	fmt.Printf("Failed to load pgn: %v\nAttempting to load json\n", err)
-
 	g, err = LoadJSON(bytes)
 	if err != nil {
-		fmt.Printf("Failed to load json: %v\n", err)
-		return nil, err
+		return nil, fmt.Errorf("%v is neither PGN (%v) nor JSON (%w)", file, pgnErr, err)
 	}
 
 	return g, nil
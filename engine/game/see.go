@@ -0,0 +1,96 @@
+package game
+
+const (
+	// SEEKingValue is the value of a king in the static exchange evaluation: its capture ends the game.
+	SEEKingValue = 100.0
+	// maxExchanges is the most captures an exchange is followed through; the later ones are not.
+	maxExchanges = 8
+)
+
+// seeValue returns the value of the piece in the static exchange evaluation: its base strength.
+func seeValue(piece Piece) float64 {
+	if piece.Kind() == KindKing {
+		return SEEKingValue
+	}
+	return Strength[piece.Kind()]
+}
+
+// SEE returns the static exchange evaluation of the move: the material the team of the moving piece
+// wins once the captures on the destination that follow it are over. The players take their turns
+// in order, and each one captures with its least valuable piece, or doesn't if that is better for its
+// team. A player whose partner's piece is on the square can't capture, while the next opponent still
+// can, so an exchange is over once the three players after the last capture have passed.
+// The move need not capture: a quiet move scores how much the moving piece is lost for.
+func (b *Board) SEE(move Move) float64 {
+	piece, captured := b.GetPiece(move.From), b.GetPiece(move.To)
+	if !captured.IsEmpty() && captured.Kind() == KindKing {
+		return SEEKingValue
+	}
+
+	b.Grid[move.From.Rank][move.From.File] = EmptySquare
+	b.Grid[move.To.Rank][move.To.File] = piece
+	score := seeValue(captured) - b.exchange(move.To, (piece.Player()+1)%4, 0, 1)
+	b.Grid[move.From.Rank][move.From.File] = piece
+	b.Grid[move.To.Rank][move.To.File] = captured
+
+	return score
+}
+
+// SEEAtLeast reports whether the SEE of the move is at least the threshold. It skips the exchange
+// when the captured piece makes up for the moving one: the opponents win at most the moving piece.
+func (b *Board) SEEAtLeast(move Move, threshold float64) bool {
+	if seeValue(b.GetPiece(move.To))-seeValue(b.GetPiece(move.From)) >= threshold {
+		return true
+	}
+	return b.SEE(move) >= threshold
+}
+
+// exchange returns the material the team of the player wins by the captures on the square from the
+// player's turn on, after the given number of players in a row passed and captures were made.
+// The pieces are moved on the grid only (the hash and PieceSquares are left alone), and put back.
+func (b *Board) exchange(square Square, player Player, passes, captures int) float64 {
+	if passes == 3 || captures == maxExchanges {
+		return 0
+	}
+
+	next := (player + 1) % 4
+	score := -b.exchange(square, next, passes+1, captures) // Not capturing.
+
+	target := b.GetPiece(square)
+	if target.Player().IsTeamMate(player) {
+		return score
+	}
+	from, ok := b.leastValuableAttacker(square, player)
+	if !ok {
+		return score
+	}
+	if target.Kind() == KindKing {
+		return SEEKingValue
+	}
+
+	attacker := b.GetPiece(from)
+	b.Grid[from.Rank][from.File] = EmptySquare
+	b.Grid[square.Rank][square.File] = attacker
+	capture := seeValue(target) - b.exchange(square, next, 0, captures+1)
+	b.Grid[from.Rank][from.File] = attacker
+	b.Grid[square.Rank][square.File] = target
+
+	return max(score, capture)
+}
+
+// HangingValue returns the most material the player can win by a capture: the highest SEE of its
+// captures with its least valuable attackers, or 0 if none wins material.
+func (b *Board) HangingValue(player Player) float64 {
+	best := 0.0
+	for _, opponent := range [2]Player{(player + 1) % 4, (player + 3) % 4} {
+		for square := range b.PieceSquares[opponent] {
+			if seeValue(b.GetPiece(square)) <= best {
+				continue // Can't win more than the piece.
+			}
+			if from, ok := b.leastValuableAttacker(square, player); ok {
+				best = max(best, b.SEE(Move{from, square}))
+			}
+		}
+	}
+	return best
+}
@@ -0,0 +1,67 @@
+package game_test
+
+import (
+	. "github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+func (s *TestSuite) TestSEE() {
+	r := s.Require()
+
+	type placed struct {
+		piece  Piece
+		square string
+	}
+	board := func(pieces ...placed) *Board {
+		b := NewBoard()
+		for _, p := range pieces {
+			b.PlacePiece(p.piece, SquareFromPGN(p.square))
+		}
+		return b
+	}
+	var (
+		redPawn     = placed{NewPiece(0, KindPawn), "f6"}
+		redQueen    = placed{NewPiece(0, KindQueen), "d7"}
+		redRook     = placed{NewPiece(0, KindRook), "c7"}
+		redRook2    = placed{NewPiece(0, KindRook), "b7"}
+		blueKnight  = placed{NewPiece(1, KindKnight), "g7"}
+		bluePawn    = placed{NewPiece(1, KindPawn), "g7"}
+		blueBishop  = placed{NewPiece(1, KindBishop), "g7"}
+		blueKing    = placed{NewPiece(1, KindKing), "g7"}
+		blueDefence = placed{NewPiece(1, KindPawn), "f6"}
+		blueKnight2 = placed{NewPiece(1, KindKnight), "h9"}
+		greenPawn   = placed{NewPiece(3, KindPawn), "h6"}
+		greenBishop = placed{NewPiece(3, KindBishop), "i9"}
+		yellowPawn  = placed{NewPiece(2, KindPawn), "f8"}
+	)
+
+	tests := []struct {
+		name   string
+		pieces []placed
+		move   string
+		see    float64
+	}{
+		{"undefended", []placed{redPawn, blueKnight}, "f6-g7", 2.2},
+		{"defended", []placed{redQueen, bluePawn, blueDefence}, "d7-g7", 1 - 14},
+		{"defended by the other opponent", []placed{redQueen, bluePawn, greenPawn}, "d7-g7", 1 - 14},
+		{"recapture declined", []placed{redRook, blueKnight, greenBishop, yellowPawn}, "c7-g7", 2.2},
+		{"recapture", []placed{redRook, blueKnight, greenBishop}, "c7-g7", 2.2 - 4.5},
+		{"x-ray", []placed{redRook, redRook2, blueBishop, blueKnight2}, "c7-g7", 5 - 4.5 + 2.2},
+		{"no x-ray", []placed{redRook, blueBishop, blueKnight2}, "c7-g7", 5 - 4.5},
+		{"king", []placed{redRook, blueKing, blueKnight2}, "c7-g7", SEEKingValue},
+		{"quiet", []placed{redQueen, greenPawn}, "d7-g7", -14},
+	}
+	for _, test := range tests {
+		b := board(test.pieces...)
+		hash := b.Hash()
+		r.InDelta(test.see, b.SEE(MoveFromPGN(test.move)), 1e-9, test.name)
+		r.Equal(test.see >= 0, b.SEEAtLeast(MoveFromPGN(test.move), 0), test.name)
+		r.Equal(test.see >= -1, b.SEEAtLeast(MoveFromPGN(test.move), -1), test.name)
+		r.Equal(hash, b.Hash(), test.name)
+		r.Equal(board(test.pieces...).Grid, b.Grid, test.name)
+	}
+
+	// Red wins the bishop for a rook, and nothing more.
+	r.InDelta(5-4.5+2.2, board(redRook, redRook2, blueBishop, blueKnight2).HangingValue(0), 1e-9)
+	r.Zero(board(redQueen, bluePawn, blueDefence).HangingValue(0))
+	r.Zero(board(redRook, blueBishop, blueKnight2).HangingValue(1), "blue can't capture")
+}
@@ -0,0 +1,54 @@
+package game
+
+import "math/rand/v2"
+
+// Zobrist keys: a random key per piece per square, and per player to move. The hash of a position
+// is the XOR of the keys of its pieces and of its active player, so a move updates it with a few XORs.
+// The seed is fixed, so that hashes are the same across runs.
+var (
+	zobristPieces  [32][BoardSize][BoardSize]uint64 // By Piece, which takes 5 bits.
+	zobristPlayers [4]uint64
+)
+
+func init() {
+	rng := rand.New(rand.NewPCG(0x2f2c4e55, 0x41c0ffee))
+	for piece := range zobristPieces {
+		for rank := range BoardSize {
+			for file := range BoardSize {
+				zobristPieces[piece][rank][file] = rng.Uint64()
+			}
+		}
+	}
+	for player := range zobristPlayers {
+		zobristPlayers[player] = rng.Uint64()
+	}
+}
+
+// zobristPiece returns the key of the piece on the square (0 for an empty or inactive square).
+func zobristPiece(piece Piece, square Square) uint64 {
+	if piece == EmptySquare || piece == InactiveSquare {
+		return 0
+	}
+	return zobristPieces[piece][square.Rank][square.File]
+}
+
+// Hash returns the Zobrist hash of the pieces on the board. Equal boards have equal hashes,
+// and different boards almost surely different ones.
+func (b *Board) Hash() uint64 {
+	return b.hash
+}
+
+// setHash computes the hash of the board from scratch.
+func (b *Board) setHash() {
+	b.hash = 0
+	for rank := range BoardSize {
+		for file := range BoardSize {
+			b.hash ^= zobristPiece(b.Grid[rank][file], Square{rank, file})
+		}
+	}
+}
+
+// Hash returns the Zobrist hash of the position: the pieces and the player to move.
+func (g *Game) Hash() uint64 {
+	return g.Board.hash ^ zobristPlayers[g.ActivePlayer]
+}
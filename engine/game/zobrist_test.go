@@ -0,0 +1,49 @@
+package game_test
+
+import (
+	. "github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+func (s *TestSuite) TestHash() {
+	r := s.Require()
+
+	g := New()
+	start := g.Hash()
+	r.NotZero(start)
+
+	// The hash is updated by the moves, and restored by undoing them.
+	moves := []Move{}
+	captured := []Piece{}
+	for range 12 {
+		move := g.GetMoves(nil)[0]
+		moves = append(moves, move)
+		captured = append(captured, g.Play(move))
+
+		loaded, err := LoadFEN(g.FEN())
+		r.NoError(err)
+		r.Equal(loaded.Hash(), g.Hash(), "after %v", moves)
+		r.Equal(g.Hash(), g.Copy().Hash())
+	}
+	for i := len(moves) - 1; i >= 0; i-- {
+		g.UnplayMove(moves[i], captured[i])
+	}
+	r.Equal(start, g.Hash())
+
+	// Transpositions hash the same, unlike the same pieces with another player to move.
+	a, err := LoadPGN("1. h2-h3 b9-c9 i13-i12 m8-l8\n2. g2-g3")
+	r.NoError(err)
+	b, err := LoadPGN("1. g2-g3 b9-c9 i13-i12 m8-l8\n2. h2-h3")
+	r.NoError(err)
+	r.Equal(a.Hash(), b.Hash())
+	r.Equal(a.Board.Hash(), b.Board.Hash())
+
+	b.ActivePlayer = (b.ActivePlayer + 1) % 4
+	r.NotEqual(a.Hash(), b.Hash())
+
+	// Boards loaded from JSON are hashed too.
+	bytes, err := a.JSON()
+	r.NoError(err)
+	loaded, err := LoadJSON(bytes)
+	r.NoError(err)
+	r.Equal(a.Hash(), loaded.Hash())
+}
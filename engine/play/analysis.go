@@ -0,0 +1,197 @@
+package play
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/ai"
+)
+
+// processAnalyze starts analysing the current position for the player to move, whoever it is.
+// The analysis streams analysisInfo messages to this connection only, and never plays a move.
+// It runs until stopAnalysis, a move being made, or the requested limits.
+func (c *Connection) processAnalyze(req AnalyzeRequest) {
+	c.stopAnalysis()
+
+	gs := c.room.snapshot()
+	if gs.HasEnded() {
+		c.SendMessage(MessageTypeAnalysisInfo, SearchInfoResponse{MoveNumber: gs.MoveNumber, Final: true})
+		return
+	}
+	c.configureAnalyst()
+
+	limits := ai.Limits{
+		Depth:    req.Depth,
+		MoveTime: time.Duration(req.MoveTime) * time.Millisecond,
+		MultiPV:  req.MultiPV,
+		Infinite: req.Depth == 0 && req.MoveTime == 0,
+	}
+	if limits.Depth == 0 && limits.MoveTime > 0 {
+		limits.Depth = ai.MaxDepth
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	c.analysisMutex.Lock()
+	c.analysisCancel = cancel
+	c.analysisDone = done
+	c.analysisMutex.Unlock()
+
+	logger := c.logger()
+	pool := c.room.settings().Pool
+	go func() {
+		defer close(done)
+		defer cancel()
+
+		// The analysis gives way to the other searches of the engine pool, and starts over once
+		// it gets a slot again.
+		for {
+			searchCtx, release, err := pool.Acquire(ctx, c.poolOwner(), PriorityAnalysis, c.sendQueued(MessageTypeAnalyze))
+			if err != nil { // Stopped while queued.
+				c.SendMessage(MessageTypeAnalysisInfo, SearchInfoResponse{MoveNumber: gs.MoveNumber, Final: true})
+				return
+			}
+
+			c.analysisMutex.Lock()
+			c.analysisSearch = searchCtx
+			c.analysisMutex.Unlock()
+
+			// The final analysisInfo is reported by the engine's progress.
+			_, err = c.analyst.GetBestMoveCtx(searchCtx, gs.Game, limits)
+			preempted := searchCtx.Err() != nil && ctx.Err() == nil
+			release()
+			if preempted {
+				continue
+			}
+			if err != nil {
+				logger.Warn("Error analysing", "error", err)
+			}
+			return
+		}
+	}()
+}
+
+// processHint suggests a move for the player to move, searching as deep as the engine would.
+// The error of the search is sent in response to the request, as is the position changing
+// before the hint is found.
+func (c *Connection) processHint(request Message) {
+	ctx := c.hintContext() // Before the snapshot, so that a move made in between cancels the hint.
+	gs := c.room.snapshot()
+	cfg := c.room.settings()
+	engine := c.hintEngine(cfg)
+	logger := c.logger()
+
+	go func() {
+		searchCtx, release, err := cfg.Pool.Acquire(ctx, c.poolOwner(), PriorityRequest, c.sendQueued(MessageTypeHint))
+		if err == nil {
+			var result ai.Result
+			result, err = engine.GetBestMoveCtx(searchCtx, gs.Game, ai.Limits{})
+			release()
+			if err == nil && ctx.Err() == nil {
+				c.SendMessage(MessageTypeHintResponse, HintResponse{
+					MoveNumber: gs.MoveNumber,
+					Move:       PGNMoveFromGameMove(result.Continuation[0]),
+					Score:      math.Round(result.Score*float64(gs.ActivePlayer.Team())*100) / 100,
+				})
+				return
+			}
+		}
+
+		if ctx.Err() != nil {
+			c.SendError(&request, requestErrorf(ErrorCodeInvalidRequest, "cannot give a hint: the position changed"))
+			return
+		}
+		logger.Warn("Error getting hint", "error", err)
+		c.SendError(&request, requestErrorf(ErrorCodeInvalidRequest, "cannot give a hint: %v", err))
+	}()
+}
+
+// hintContext returns the context of the hints of the current position, which stopHints cancels.
+func (c *Connection) hintContext() context.Context {
+	c.analysisMutex.Lock()
+	defer c.analysisMutex.Unlock()
+
+	if c.hintCtx == nil {
+		c.hintCtx, c.hintCancel = context.WithCancel(context.Background())
+	}
+	return c.hintCtx
+}
+
+// stopHints stops the hints of the current position, if any.
+func (c *Connection) stopHints() {
+	c.analysisMutex.Lock()
+	cancel := c.hintCancel
+	c.hintCtx, c.hintCancel = nil, nil
+	c.analysisMutex.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// hintEngine returns the engine of the hints, which searches like the room's engine. It is kept
+// between the hints, so that they share its transposition table, until the engine settings change.
+func (c *Connection) hintEngine(cfg Config) *ai.AI {
+	c.analysisMutex.Lock()
+	defer c.analysisMutex.Unlock()
+
+	if c.hinter == nil || cfg.engineChanged(c.hinterCfg) {
+		c.hinter = ai.New(cfg.Depth, cfg.Spread, cfg.SpreadDrop, cfg.EvalLimit, cfg.engineOptions()...)
+		c.hinterCfg = cfg
+	}
+	return c.hinter
+}
+
+// stopAnalysis stops the running analysis, if any, and waits for its final report.
+func (c *Connection) stopAnalysis() {
+	c.analysisMutex.Lock()
+	cancel, done := c.analysisCancel, c.analysisDone
+	c.analysisCancel, c.analysisDone = nil, nil
+	c.analysisMutex.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// configureAnalyst makes the analyst search like the room's engine. The analysis is bounded
+// by its own limits rather than the eval limit per move. It must not be called while an analysis is running.
+func (c *Connection) configureAnalyst() {
+	cfg := c.room.settings()
+
+	c.analyst = ai.New(cfg.Depth, cfg.Spread, cfg.SpreadDrop, ai.MaxEvalLimit,
+		cfg.engineOptions(ai.WithProgress(searchInfoInterval, c.sendAnalysisInfo))...)
+}
+
+// sendAnalysisInfo forwards the analysis progress to the client. The final report of an analysis
+// preempted by the engine pool is left out, as the analysis starts over.
+func (c *Connection) sendAnalysisInfo(info ai.SearchInfo) {
+	c.analysisMutex.Lock()
+	preempted := info.Final && c.analysisSearch != nil && c.analysisSearch.Err() != nil && c.analysisCancel != nil
+	c.analysisMutex.Unlock()
+	if preempted {
+		return
+	}
+
+	c.SendMessage(MessageTypeAnalysisInfo, NewSearchInfoResponse(info))
+}
+
+// sendQueued returns the function that reports the position of the connection's search for
+// the request in the queue of the engine pool.
+func (c *Connection) sendQueued(request MessageType) func(position int) {
+	return func(position int) {
+		c.SendMessage(MessageTypeEngineQueued, EngineQueuedResponse{Request: request, Position: position})
+	}
+}
+
+// poolOwner identifies the connection's searches to the engine pool.
+func (c *Connection) poolOwner() string {
+	if c.ID == "" { // A connection with a private room.
+		return fmt.Sprintf("connection:%p", c)
+	}
+	return "session:" + c.ID
+}
@@ -0,0 +1,458 @@
+package play
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/ai"
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+// MaxAPISearchTime bounds the searches of the analyze endpoint.
+const MaxAPISearchTime = time.Minute
+
+// Render formats of the render endpoint.
+const (
+	RenderFormatSVG  = "svg"
+	RenderFormatText = "text"
+)
+
+// PositionRequest gives a position by its FEN, or by the PGN of the game leading to it
+// (the starting position if neither), followed by the moves.
+type PositionRequest struct {
+	FEN   string    `json:"fen,omitempty"`
+	PGN   string    `json:"pgn,omitempty"`
+	Moves []PGNMove `json:"moves,omitempty"`
+}
+
+// PositionResponse describes a position.
+type PositionResponse struct {
+	FEN          string      `json:"fen"`
+	ActivePlayer game.Player `json:"activePlayer"`
+	MoveNumber   int         `json:"moveNumber"`
+	Ended        bool        `json:"ended"`
+}
+
+// APIAnalyzeRequest asks for the best line in the position. Without limits, the search is
+// as deep as the engine's (Config.Depth); it never takes longer than MaxAPISearchTime.
+type APIAnalyzeRequest struct {
+	PositionRequest
+	Depth    int `json:"depth"`
+	MoveTime int `json:"moveTime"` // Milliseconds.
+	Nodes    int `json:"nodes"`
+	MultiPV  int `json:"multiPV"`
+}
+
+// APIAnalyzeResponse is the engine's best line, with absolute scores (positive favours Red/Yellow).
+type APIAnalyzeResponse struct {
+	PositionResponse
+	BestMove     PGNMove   `json:"bestMove"`
+	Continuation []PGNMove `json:"continuation"`
+	Score        float64   `json:"score"`
+	Lines        []PGNLine `json:"lines"`
+	Depth        int       `json:"depth"`
+	Evaluations  int       `json:"evaluations"`
+	Time         float64   `json:"time"`
+}
+
+// APIMovesResponse lists the moves available to the player to move.
+type APIMovesResponse struct {
+	PositionResponse
+	Moves []PGNMove `json:"moves"`
+}
+
+// APIValidateResponse tells whether the position and its moves are valid.
+type APIValidateResponse struct {
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+	*PositionResponse
+}
+
+// APIRenderRequest asks for a picture of the position.
+type APIRenderRequest struct {
+	PositionRequest
+	Format string `json:"format"` // RenderFormatSVG (default) or RenderFormatText.
+}
+
+// APIRenderResponse is a picture of the position.
+type APIRenderResponse struct {
+	Format string `json:"format"`
+	Image  string `json:"image"`
+}
+
+// APIGameRequest stores a game.
+type APIGameRequest struct {
+	PGN string `json:"pgn"`
+}
+
+// APIGameResponse is a stored game.
+type APIGameResponse struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	PGN     string    `json:"pgn,omitempty"` // Omitted from the list of games.
+	Moves   int       `json:"moves"`
+	Result  string    `json:"result"`
+	PositionResponse
+}
+
+// gameStore keeps the games stored through the API in memory.
+type gameStore struct {
+	mutex sync.Mutex
+	games map[string]APIGameResponse
+}
+
+func newGameStore() *gameStore {
+	return &gameStore{games: map[string]APIGameResponse{}}
+}
+
+// add stores the game under a new ID, and returns it.
+func (gs *gameStore) add(session *game.GameSession) APIGameResponse {
+	stored := APIGameResponse{
+		ID:               newID(8),
+		Created:          time.Now(),
+		PGN:              session.PGN(),
+		Moves:            len(session.PastMoves),
+		Result:           session.Result(),
+		PositionResponse: newPositionResponse(session),
+	}
+
+	gs.mutex.Lock()
+	gs.games[stored.ID] = stored
+	gs.mutex.Unlock()
+
+	return stored
+}
+
+// load adds the games saved to the file by save. A missing file has no games.
+func (gs *gameStore) load(file string) error {
+	bytes, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	games := []APIGameResponse{}
+	if err := json.Unmarshal(bytes, &games); err != nil {
+		return fmt.Errorf("error loading games from %v: %w", file, err)
+	}
+
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+	for _, stored := range games {
+		gs.games[stored.ID] = stored
+	}
+	return nil
+}
+
+// save writes the games to the file, replacing it only once they are written.
+func (gs *gameStore) save(file string) error {
+	gs.mutex.Lock()
+	games := make([]APIGameResponse, 0, len(gs.games))
+	for _, stored := range gs.games {
+		games = append(games, stored)
+	}
+	gs.mutex.Unlock()
+	slices.SortFunc(games, func(a, b APIGameResponse) int { return a.Created.Compare(b.Created) })
+
+	bytes, err := json.MarshalIndent(games, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file+".tmp", bytes, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// registerAPI adds the REST endpoints to the app. Requests and responses are JSON.
+func (s *Server) registerAPI() {
+	api := s.app.Group("/api")
+	api.Post("/analyze", s.handleAnalyze)
+	api.Post("/moves", s.handleMoves)
+	api.Post("/validate", s.handleValidate)
+	api.Post("/render", s.handleRender)
+	api.Get("/games", s.handleListGames)
+	api.Post("/games", s.handleStoreGame)
+	api.Get("/games/:id", s.handleGetGame)
+	api.Get("/schema", s.handleSchema)
+}
+
+// handleError responds with the error's status (500 unless it is a fiber.Error) and message.
+func handleError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	var e *fiber.Error
+	if errors.As(err, &e) {
+		status = e.Code
+	}
+
+	code := ErrorCodeInternal
+	switch {
+	case status == fiber.StatusNotFound:
+		code = ErrorCodeNotFound
+	case status < fiber.StatusInternalServerError:
+		code = ErrorCodeInvalidRequest
+	}
+	return c.Status(status).JSON(ErrorResponse{Code: code, Error: err.Error()})
+}
+
+// parseBody decodes the JSON body of the request into req. An empty body leaves req as is.
+func parseBody(c *fiber.Ctx, req interface{}) error {
+	if len(c.Body()) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(c.Body(), req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid request: %v", err))
+	}
+	return nil
+}
+
+// gameSession returns the game in the requested position.
+func (req PositionRequest) gameSession() (*game.GameSession, error) {
+	var gs *game.GameSession
+	switch {
+	case req.FEN != "" && req.PGN != "":
+		return nil, errors.New("either fen or pgn can be given, not both")
+	case req.FEN != "":
+		g, err := game.LoadFEN(req.FEN)
+		if err != nil {
+			return nil, err
+		}
+		gs = &game.GameSession{Game: g, CurrentMove: -1, PastMoves: []game.Move{}}
+	case req.PGN != "":
+		var err error
+		if gs, err = loadPGN(req.PGN); err != nil {
+			return nil, err
+		}
+	default:
+		gs = game.NewGameSession()
+	}
+
+	for i, pgnMove := range req.Moves {
+		move, err := game.ParseMove(string(pgnMove))
+		if err != nil {
+			return nil, fmt.Errorf("move %v (%v): %w", i+1, pgnMove, err)
+		}
+		if gs.HasEnded() {
+			return nil, fmt.Errorf("move %v (%v): the game has ended", i+1, pgnMove)
+		}
+		if err := gs.ValidateMove(move); err != nil {
+			return nil, fmt.Errorf("move %v: %w", i+1, err)
+		}
+		gs.Play(*move)
+	}
+
+	return gs, nil
+}
+
+// loadPGN loads the game of the PGN, checking that its moves are legal.
+func loadPGN(pgn string) (*game.GameSession, error) {
+	gs, err := game.LoadPGN(pgn)
+	if err != nil {
+		return nil, err
+	}
+
+	g := game.New()
+	for i, move := range gs.PastMoves {
+		if g.HasEnded() {
+			return nil, fmt.Errorf("move %v (%v): the game has ended", i+1, move)
+		}
+		if err := g.ValidateMove(&move); err != nil {
+			return nil, fmt.Errorf("move %v: %w", i+1, err)
+		}
+		g.Play(move)
+	}
+	return gs, nil
+}
+
+// position returns the requested position, or a 400 error if it is invalid.
+func (req PositionRequest) position() (*game.GameSession, error) {
+	gs, err := req.gameSession()
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid position: %v", err))
+	}
+	return gs, nil
+}
+
+func newPositionResponse(gs *game.GameSession) PositionResponse {
+	return PositionResponse{
+		FEN:          gs.FEN(),
+		ActivePlayer: gs.ActivePlayer,
+		MoveNumber:   gs.MoveNumber,
+		Ended:        gs.HasEnded(),
+	}
+}
+
+// handleAnalyze responds with the engine's best line in the position.
+func (s *Server) handleAnalyze(c *fiber.Ctx) error {
+	req := APIAnalyzeRequest{}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	gs, err := req.position()
+	if err != nil {
+		return err
+	}
+	if gs.HasEnded() {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "the game has ended")
+	}
+
+	moveTime := time.Duration(req.MoveTime) * time.Millisecond
+	switch {
+	case req.Depth < 0 || req.Depth > ai.MaxDepth:
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("depth must be at most %v", ai.MaxDepth))
+	case req.MoveTime < 0 || moveTime > MaxAPISearchTime:
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("moveTime must be at most %v ms", MaxAPISearchTime.Milliseconds()))
+	case req.Nodes < 0 || req.MultiPV < 0:
+		return fiber.NewError(fiber.StatusBadRequest, "nodes and multiPV cannot be negative")
+	}
+
+	limits := ai.Limits{Depth: req.Depth, MoveTime: moveTime, Nodes: req.Nodes, MultiPV: req.MultiPV}
+	if limits.Depth == 0 && (limits.MoveTime > 0 || limits.Nodes > 0) {
+		limits.Depth = ai.MaxDepth
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), MaxAPISearchTime)
+	defer cancel()
+
+	// The time in the queue of the engine pool counts towards MaxAPISearchTime.
+	ctx, release, err := s.cfg.Pool.Acquire(ctx, "api:"+c.IP(), PriorityRequest, nil)
+	if err != nil {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "the engines are busy")
+	}
+	defer release()
+
+	engine := ai.New(s.cfg.Depth, s.cfg.Spread, s.cfg.SpreadDrop, s.cfg.EvalLimit, s.cfg.engineOptions()...)
+	result, err := engine.GetBestMoveCtx(ctx, gs.Game, limits)
+	if err != nil {
+		return err
+	}
+
+	player := gs.ActivePlayer
+	return c.JSON(APIAnalyzeResponse{
+		PositionResponse: newPositionResponse(gs),
+		BestMove:         PGNMoveFromGameMove(result.Continuation[0]),
+		Continuation:     PGNMovesFromGameMoves(result.Continuation),
+		Score:            math.Round(result.Score*float64(player.Team())*100) / 100,
+		Lines:            PGNLinesFromLines(result.Lines, player),
+		Depth:            result.Depth,
+		Evaluations:      result.Nodes,
+		Time:             math.Round(result.Elapsed.Seconds()*100) / 100,
+	})
+}
+
+// handleMoves responds with the moves available in the position.
+func (s *Server) handleMoves(c *fiber.Ctx) error {
+	req := PositionRequest{}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	gs, err := req.position()
+	if err != nil {
+		return err
+	}
+
+	moves := []PGNMove{}
+	if !gs.HasEnded() {
+		moves = PGNMovesFromGameMoves(gs.GetMoves(nil))
+	}
+	return c.JSON(APIMovesResponse{PositionResponse: newPositionResponse(gs), Moves: moves})
+}
+
+// handleValidate responds whether the position and its moves are valid. An invalid position
+// is a valid answer, not an error.
+func (s *Server) handleValidate(c *fiber.Ctx) error {
+	req := PositionRequest{}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	gs, err := req.gameSession()
+	if err != nil {
+		return c.JSON(APIValidateResponse{Valid: false, Error: err.Error()})
+	}
+	position := newPositionResponse(gs)
+	return c.JSON(APIValidateResponse{Valid: true, PositionResponse: &position})
+}
+
+// handleRender responds with a picture of the position.
+func (s *Server) handleRender(c *fiber.Ctx) error {
+	req := APIRenderRequest{}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	gs, err := req.position()
+	if err != nil {
+		return err
+	}
+
+	switch req.Format {
+	case "", RenderFormatSVG:
+		return c.JSON(APIRenderResponse{Format: RenderFormatSVG, Image: gs.Board.SVG()})
+	case RenderFormatText:
+		return c.JSON(APIRenderResponse{Format: RenderFormatText, Image: gs.Board.Text()})
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("unknown format %q", req.Format))
+	}
+}
+
+// handleListGames responds with the stored games (without their PGN), oldest first.
+func (s *Server) handleListGames(c *fiber.Ctx) error {
+	s.games.mutex.Lock()
+	games := make([]APIGameResponse, 0, len(s.games.games))
+	for _, stored := range s.games.games {
+		stored.PGN = ""
+		games = append(games, stored)
+	}
+	s.games.mutex.Unlock()
+
+	slices.SortFunc(games, func(a, b APIGameResponse) int { return a.Created.Compare(b.Created) })
+	return c.JSON(games)
+}
+
+// handleStoreGame stores the game given by its PGN, and responds with it and its ID.
+func (s *Server) handleStoreGame(c *fiber.Ctx) error {
+	req := APIGameRequest{}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	gs, err := loadPGN(req.PGN)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid game: %v", err))
+	}
+
+	stored := s.games.add(gs)
+
+	return c.Status(fiber.StatusCreated).JSON(stored)
+}
+
+// handleGetGame responds with the stored game of the ID.
+func (s *Server) handleGetGame(c *fiber.Ctx) error {
+	s.games.mutex.Lock()
+	stored, ok := s.games.games[c.Params("id")]
+	s.games.mutex.Unlock()
+
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("game %q not found", c.Params("id")))
+	}
+	return c.JSON(stored)
+}
+
+// handleSchema responds with the JSON Schema of the websocket messages (see ProtocolSchema).
+func (s *Server) handleSchema(c *fiber.Ctx) error {
+	schema, err := ProtocolSchema()
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(schema)
+}
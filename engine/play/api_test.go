@@ -0,0 +1,138 @@
+package play_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+	"github.com/vpoliakov01/2v2ChessAI/engine/play"
+)
+
+// apiRequest sends a request with the JSON body to the server's API, and decodes the
+// JSON response into resp. Returns the status code.
+func apiRequest(t *testing.T, server *play.Server, method, path, body string, resp interface{}) int {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	res, err := server.App().Test(req, -1)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.NoError(t, json.NewDecoder(res.Body).Decode(resp))
+	return res.StatusCode
+}
+
+func TestAPIAnalyze(t *testing.T) {
+	cfg := defaultTestConfig()
+	cfg.EvalLimit = 0
+	server := play.NewServer(cfg)
+
+	resp := play.APIAnalyzeResponse{}
+	status := apiRequest(t, server, http.MethodPost, "/api/analyze", `{"moves": ["h2-h3"], "depth": 2, "multiPV": 2}`, &resp)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, playerBlue, resp.ActivePlayer)
+	require.NotEmpty(t, resp.BestMove)
+	require.Equal(t, resp.BestMove, resp.Continuation[0])
+	require.Len(t, resp.Lines, 2)
+	require.Equal(t, 2, resp.Depth)
+
+	errResp := play.ErrorResponse{}
+	status = apiRequest(t, server, http.MethodPost, "/api/analyze", `{"depth": 1000}`, &errResp)
+	require.Equal(t, http.StatusBadRequest, status)
+	require.Contains(t, errResp.Error, "depth")
+}
+
+func TestAPIMoves(t *testing.T) {
+	server := play.NewServer(defaultTestConfig())
+	start := game.New()
+
+	resp := play.APIMovesResponse{}
+	status := apiRequest(t, server, http.MethodPost, "/api/moves", `{"fen": "`+start.FEN()+`"}`, &resp)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, playerRed, resp.ActivePlayer)
+	require.Len(t, resp.Moves, len(start.GetMoves(nil)))
+	require.Contains(t, resp.Moves, play.PGNMove("h2-h3"))
+
+	status = apiRequest(t, server, http.MethodPost, "/api/moves", `{"pgn": "1. h2-h3"}`, &resp)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, playerBlue, resp.ActivePlayer)
+
+	errResp := play.ErrorResponse{}
+	status = apiRequest(t, server, http.MethodPost, "/api/moves", `{"fen": "nonsense"}`, &errResp)
+	require.Equal(t, http.StatusBadRequest, status)
+	require.Contains(t, errResp.Error, "invalid position")
+
+	status = apiRequest(t, server, http.MethodPost, "/api/moves", `{"fen": `, &errResp)
+	require.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestAPIValidate(t *testing.T) {
+	server := play.NewServer(defaultTestConfig())
+
+	resp := play.APIValidateResponse{}
+	status := apiRequest(t, server, http.MethodPost, "/api/validate", `{"moves": ["h2-h3", "b7-c7"]}`, &resp)
+	require.Equal(t, http.StatusOK, status)
+	require.True(t, resp.Valid)
+	require.Equal(t, playerYellow, resp.ActivePlayer)
+
+	resp = play.APIValidateResponse{}
+	status = apiRequest(t, server, http.MethodPost, "/api/validate", `{"moves": ["h2-h3", "h3-h4"]}`, &resp)
+	require.Equal(t, http.StatusOK, status)
+	require.False(t, resp.Valid)
+	require.Contains(t, resp.Error, "move 2")
+	require.Nil(t, resp.PositionResponse)
+}
+
+func TestAPIRender(t *testing.T) {
+	server := play.NewServer(defaultTestConfig())
+
+	resp := play.APIRenderResponse{}
+	status := apiRequest(t, server, http.MethodPost, "/api/render", `{}`, &resp)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, play.RenderFormatSVG, resp.Format)
+	require.True(t, strings.HasPrefix(resp.Image, "<svg"))
+
+	status = apiRequest(t, server, http.MethodPost, "/api/render", `{"format": "text"}`, &resp)
+	require.Equal(t, http.StatusOK, status)
+	require.Contains(t, resp.Image, "|rK |")
+
+	errResp := play.ErrorResponse{}
+	status = apiRequest(t, server, http.MethodPost, "/api/render", `{"format": "gif"}`, &errResp)
+	require.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestAPIGames(t *testing.T) {
+	server := play.NewServer(defaultTestConfig())
+
+	stored := play.APIGameResponse{}
+	status := apiRequest(t, server, http.MethodPost, "/api/games", `{"pgn": "1. h2-h3 b7-c7"}`, &stored)
+	require.Equal(t, http.StatusCreated, status)
+	require.NotEmpty(t, stored.ID)
+	require.Equal(t, 2, stored.Moves)
+	require.Equal(t, game.ResultInProgress, stored.Result)
+
+	games := []play.APIGameResponse{}
+	status = apiRequest(t, server, http.MethodGet, "/api/games", "", &games)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, games, 1)
+	require.Equal(t, stored.ID, games[0].ID)
+	require.Empty(t, games[0].PGN)
+
+	got := play.APIGameResponse{}
+	status = apiRequest(t, server, http.MethodGet, "/api/games/"+stored.ID, "", &got)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "1. h2-h3 b7-c7", got.PGN)
+
+	errResp := play.ErrorResponse{}
+	status = apiRequest(t, server, http.MethodGet, "/api/games/missing", "", &errResp)
+	require.Equal(t, http.StatusNotFound, status)
+
+	status = apiRequest(t, server, http.MethodPost, "/api/games", `{"pgn": "1. h2-h9"}`, &errResp)
+	require.Equal(t, http.StatusBadRequest, status)
+}
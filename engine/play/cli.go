@@ -2,6 +2,7 @@ package play
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"slices"
@@ -9,16 +10,22 @@ import (
 	"time"
 
 	"github.com/vpoliakov01/2v2ChessAI/engine/ai"
+	"github.com/vpoliakov01/2v2ChessAI/engine/color"
 	"github.com/vpoliakov01/2v2ChessAI/engine/game"
 )
 
 func RunCLI(cfg *Config) {
+	fmt.Print(color.Reset)
 	fmt.Printf("\nDepth: %v\nMoves limit: %v\nHuman players: %v\nEvaluation: %v\nLoad: %v\n\n", cfg.Depth, cfg.MoveLimit, cfg.HumanPlayers, cfg.Evaluation, cfg.Load)
 
-	engine := ai.New(cfg.Depth, cfg.Spread, cfg.SpreadDrop, cfg.EvalLimit)
+	stats := ai.NewStats()
+	engine := ai.New(cfg.Depth, cfg.Spread, cfg.SpreadDrop, cfg.EvalLimit, cfg.engineOptions(ai.WithMetrics(stats))...)
 	startTime := time.Now()
 
 	g := game.SetupBoard(cfg.Load)
+	if g.Clock == nil {
+		g.SetTimeControl(cfg.timeControl(), time.Now())
+	}
 	g.Board.Draw()
 
 	// Play the game.
@@ -68,7 +75,8 @@ func RunCLI(cfg *Config) {
 				break
 			}
 		} else { // AI's turn.
-			continuation, s, err := engine.GetBestMove(g.Game)
+			limits := ai.Limits{MultiPV: cfg.MultiPV, Clock: engineClock(g, time.Now())}
+			result, err := engine.GetBestMoveCtx(context.Background(), g.Game, limits)
 			if err != nil {
 				if err == ai.ErrGameEnded {
 					fmt.Printf("%v: Team %v won!\n", i, g.Winner)
@@ -77,16 +85,26 @@ func RunCLI(cfg *Config) {
 				}
 				break
 			}
-			move = &continuation[0]
-			score = s
+			move = &result.Continuation[0]
+			score = result.Score
 
 			if cfg.Evaluation {
 				fmt.Printf("Evaluation: %.3f\n", score*float64(g.ActivePlayer.Team()))
-				fmt.Printf("Continuation: %v\n", continuation)
+				fmt.Printf("Continuation: %v\n", result.Continuation)
+
+				if len(result.Lines) > 1 {
+					for j, line := range result.Lines {
+						fmt.Printf("Line %v: %.3f %v\n", j+1, line.Score*float64(g.ActivePlayer.Team()), line.Continuation)
+					}
+				}
 			}
 		}
 
 		fmt.Printf("Time used: %.3fs\n", time.Since(moveStartTime).Seconds())
+		if g.CheckTime(time.Now()) {
+			fmt.Printf("%v: %v ran out of time\n", i, g.ActivePlayer)
+			break
+		}
 		piece := game.Piece(g.Board.GetPiece(move.From))
 
 		if !g.Board.IsEmpty(move.To) {
@@ -98,12 +116,16 @@ func RunCLI(cfg *Config) {
 
 		g.Play(*move)
 		g.Board.Draw()
+		if g.Clock != nil {
+			fmt.Printf("Clock: %v\n", g.Clock.Remaining)
+		}
 	}
 
 	if g.Winner != 0 {
 		fmt.Printf("Team %v won!\n", g.Winner)
 	}
 	fmt.Printf("Total time: %v\n", time.Since(startTime))
+	fmt.Print(stats.Snapshot())
 }
 
 // ReadInput reads user io from STDIN.
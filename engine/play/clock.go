@@ -0,0 +1,83 @@
+package play
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/ai"
+	g "github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+// timeControl returns the time control of the config. An invalid one is logged and ignored.
+func (cfg Config) timeControl() g.TimeControl {
+	tc, err := g.ParseTimeControl(cfg.TimeControl)
+	if err != nil {
+		slog.Warn("Ignoring time control", "timeControl", cfg.TimeControl, "error", err)
+	}
+	return tc
+}
+
+// newGameSessionLocked returns a new game timed by the room's time control. r.mutex must be held.
+func (r *Room) newGameSessionLocked() *g.GameSession {
+	gs := g.NewGameSession()
+	gs.SetTimeControl(r.cfg.timeControl(), time.Now())
+	return gs
+}
+
+// engineClock returns the clock of the active player at the given time for the engine
+// to manage its time by, or nil if the game is untimed.
+func engineClock(gs *g.GameSession, now time.Time) *ai.Clock {
+	if gs.Clock == nil {
+		return nil
+	}
+
+	return &ai.Clock{
+		Remaining:   gs.Clock.Left(gs.ActivePlayer, gs.ActivePlayer, now),
+		Increment:   gs.Clock.Increment + gs.Clock.Delay, // Thinking within the delay is free as well.
+		MovesPlayed: (gs.MoveNumber - 1) / 4,
+	}
+}
+
+// resetClockTimerLocked makes the room check the time when the active player's time runs out.
+// r.mutex must be held.
+func (r *Room) resetClockTimerLocked() {
+	if r.clockTimer != nil {
+		r.clockTimer.Stop()
+		r.clockTimer = nil
+	}
+
+	if r.gs.Clock == nil || r.gs.HasEnded() {
+		return
+	}
+
+	left := r.gs.Clock.Left(r.gs.ActivePlayer, r.gs.ActivePlayer, time.Now())
+	r.clockTimer = time.AfterFunc(left, r.checkTime)
+}
+
+// checkTime ends the game if the active player ran out of time, and tells the participants.
+func (r *Room) checkTime() {
+	r.mutex.Lock()
+	flagged := r.checkTimeLocked(time.Now())
+	if !flagged { // Woken up early, or the turn has changed since.
+		r.resetClockTimerLocked()
+	}
+	gs := r.gs.Copy()
+	r.mutex.Unlock()
+
+	if flagged {
+		r.broadcast(MessageTypeGameEnded, NewGameEndedResponse(gs))
+	}
+}
+
+// checkTimeLocked ends the game and stops the engine if the active player ran out of time
+// at the given time. Returns whether they did. r.mutex must be held.
+func (r *Room) checkTimeLocked(now time.Time) (flagged bool) {
+	if !r.gs.CheckTime(now) {
+		return false
+	}
+
+	r.logger().Info("Player ran out of time", "player", r.gs.ActivePlayer)
+	r.stopPlayingEngineMovesIfRunning(true)
+	r.resetClockTimerLocked()
+	return true
+}
@@ -0,0 +1,52 @@
+package play_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+	"github.com/vpoliakov01/2v2ChessAI/engine/play"
+)
+
+func TestClockMoves(t *testing.T) {
+	cfg := defaultTestConfig()
+	cfg.TimeControl = "60+1"
+	lobby := play.NewLobby(cfg)
+	red := ConnectToLobby(t, lobby, "room", playerRed, playerYellow, playerGreen)
+
+	game := dataFromMessage[play.LoadGameResponse](t, requireSingleMessage(t, red, play.MessageTypeLoadGameResponse))
+	require.NotNil(t, game.Clock)
+	require.Equal(t, "60+1", game.Clock.TimeControl)
+	require.True(t, game.Clock.Running)
+
+	red.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+	moved := dataFromMessage[play.MovePlayedResponse](t, requireSingleMessage(t, red, play.MessageTypeMovePlayed))
+	require.NotNil(t, moved.Clock)
+	require.Greater(t, moved.Clock.Remaining[playerRed], int64(60000), "Red got the increment")
+	require.Equal(t, playerBlue, moved.Clock.ActivePlayer)
+
+	// The engine plays for Blue within its time.
+	engineMove := dataFromMessage[play.BestMoveResponse](t, red.WaitForMessagesOfType(play.MessageTypeEngineMove, 1)[0])
+	require.NotNil(t, engineMove.Clock)
+	require.Greater(t, engineMove.Clock.Remaining[playerBlue], int64(58000))
+	require.Equal(t, playerYellow, engineMove.Clock.ActivePlayer)
+
+	red.ProcessMessage(play.MessageTypeSaveGame, nil)
+	pgn := dataFromMessage[play.SaveGameResponse](t, requireSingleMessage(t, red, play.MessageTypeSaveGameResponse)).PGN
+	require.Contains(t, pgn, `[TimeControl "60+1"]`)
+	require.Contains(t, pgn, "[%clk 0:01:0")
+}
+
+func TestClockFlag(t *testing.T) {
+	cfg := defaultTestConfig()
+	cfg.TimeControl = "1"
+	lobby := play.NewLobby(cfg)
+	red := ConnectToLobby(t, lobby, "room", playerRed, playerBlue, playerYellow, playerGreen)
+
+	ended := dataFromMessage[play.GameEndedResponse](t, red.WaitForMessagesOfType(play.MessageTypeGameEnded, 1)[0])
+	require.Equal(t, play.GameEndedResponse{King: "Red", Winner: game.Team(-1).String(), Reason: "time", Result: "0-1"}, ended)
+
+	red.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+	require.Len(t, red.MessagesOfType(play.MessageTypeInvalidMove), 1, "the game has ended")
+}
@@ -2,22 +2,58 @@ package play
 
 import (
 	"context"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/vpoliakov01/2v2ChessAI/engine/ai"
 	"github.com/vpoliakov01/2v2ChessAI/engine/game"
 )
 
+// searchInfoInterval is the minimum interval between searchInfo messages of a search.
+const searchInfoInterval = 250 * time.Millisecond
+
 // Config is the config for the game.
 type Config struct {
 	Depth        int           `json:"depth"`
 	Spread       int           `json:"spread"`
 	SpreadDrop   int           `json:"spreadDrop"`
 	HumanPlayers []game.Player `json:"humanPlayers"`
-	MoveLimit    int           `json:"moveLimit"`  // Number of moves to play before stopping.
-	EvalLimit    int           `json:"evalLimit"`  // Max number of evaluations to perform per move.
-	Evaluation   bool          `json:"evaluation"` // Whether to display the evaluation of the position.
-	Load         string        `json:"load"`       // PGN file to load.
+	MoveLimit    int           `json:"moveLimit"`   // Number of moves to play before stopping.
+	EvalLimit    int           `json:"evalLimit"`   // Max number of evaluations to perform per move.
+	MultiPV      int           `json:"multiPV"`     // Number of best lines to report per engine move.
+	Evaluation   bool          `json:"evaluation"`  // Whether to display the evaluation of the position.
+	Load         string        `json:"load"`        // PGN file to load.
+	TimeControl  string        `json:"timeControl"` // Time control of new games, e.g. "300+2" (see game.ParseTimeControl).
+	Algorithm    string        `json:"algorithm"`   // Search algorithm of the engine (see ai.Algorithms); negamax if empty.
+	Pruning      string        `json:"pruning"`     // Pruning of the negamax engine (see ai.Prunings); selective if empty.
+
+	// Not settings of the clients.
+	Metrics ai.Metrics  `json:"-"` // Receives the telemetry of the engines' searches, if set.
+	Pool    *EnginePool `json:"-"` // Runs the engines' searches, if set.
+}
+
+// clone returns a deep copy of the config.
+func (cfg Config) clone() Config {
+	cfg.HumanPlayers = slices.Clone(cfg.HumanPlayers)
+	return cfg
+}
+
+// engineOptions returns the options of the engines configured by cfg, followed by options.
+func (cfg Config) engineOptions(options ...func(*ai.AI)) []func(*ai.AI) {
+	return append([]func(*ai.AI){
+		ai.WithMetrics(cfg.Metrics),
+		ai.WithAlgorithm(ai.Algorithm(cfg.Algorithm)),
+		ai.WithPruning(ai.Pruning(cfg.Pruning)),
+		ai.WithThreads(cfg.Pool.Threads()),
+	}, options...)
+}
+
+// engineChanged reports whether the engines configured by cfg differ from the ones configured by
+// previous, so that an engine created with previous has to be re-created.
+func (cfg Config) engineChanged(previous Config) bool {
+	return cfg.Depth != previous.Depth || cfg.Spread != previous.Spread || cfg.SpreadDrop != previous.SpreadDrop ||
+		cfg.EvalLimit != previous.EvalLimit || cfg.Algorithm != previous.Algorithm || cfg.Pruning != previous.Pruning
 }
 
 // MessageWriter is the minimal interface Connection needs from a websocket
@@ -26,22 +62,72 @@ type MessageWriter interface {
 	WriteMessage(messageType int, data []byte) error
 }
 
+// Connection is a websocket client. It is a participant of a room, and can analyse
+// the room's position on its own.
 type Connection struct {
-	conn   MessageWriter
-	cfg    *Config
-	gs     *game.GameSession
-	engine *ai.AI
+	ID        string        // Session ID; empty for a connection with a private room.
+	expiry    *time.Timer   // Closes the session once the grace period after a disconnect ends.
+	conn      MessageWriter // Nil while detached.
+	lobby     *Lobby        // Nil for a connection with a private room.
+	room      *Room
+	spectator bool // A spectator only watches the room, and cannot change its game.
+
+	analyst        *ai.AI
+	analysisCancel context.CancelFunc
+	analysisDone   chan struct{}      // Closed when the running analysis finishes; nil while idle.
+	analysisSearch context.Context    // Of the running analysis' current search (see EnginePool.Acquire).
+	hinter         *ai.AI             // Gives the hints; kept until the room's engine settings change.
+	hinterCfg      Config             // The config hinter was created with.
+	hintCtx        context.Context    // Of the hints of the current position; nil if there are none.
+	hintCancel     context.CancelFunc // Cancels hintCtx.
+	analysisMutex  sync.Mutex         // Guards the analysis and the hint fields.
 
-	engineCancel context.CancelFunc
-	engineMutex  sync.Mutex
-	writeLock    sync.Mutex
+	writeLock sync.Mutex
 }
 
+// NewConnection creates a connection playing a private game that is set up according to cfg.
+// The connection claims the seats of cfg.HumanPlayers; the engine plays the rest.
 func NewConnection(c MessageWriter, cfg *Config) *Connection {
-	return &Connection{
-		conn:   c,
-		cfg:    cfg,
-		gs:     game.SetupBoard(cfg.Load),
-		engine: ai.New(cfg.Depth, cfg.Spread, cfg.SpreadDrop, cfg.EvalLimit),
+	conn := newConnection(c, cfg)
+	conn.room = newRoom("", cfg.clone())
+	conn.room.addParticipant(conn, cfg.HumanPlayers)
+
+	return conn
+}
+
+// newConnection creates a connection that is not in any room yet.
+func newConnection(c MessageWriter, cfg *Config) *Connection {
+	conn := &Connection{conn: c}
+	conn.analyst = ai.New(cfg.Depth, cfg.Spread, cfg.SpreadDrop, 0,
+		cfg.engineOptions(ai.WithProgress(searchInfoInterval, conn.sendAnalysisInfo))...)
+
+	return conn
+}
+
+// Close stops the connection's searches, leaves the room and ends the session.
+func (c *Connection) Close() {
+	c.stopAnalysis()
+	c.stopHints()
+	c.leaveRoom()
+	if c.lobby != nil {
+		c.lobby.endSession(c)
+	}
+}
+
+// leaveRoom removes the connection from its room, if any.
+func (c *Connection) leaveRoom() {
+	room := c.room
+	if room == nil {
+		return
+	}
+	c.room = nil
+
+	if c.lobby != nil {
+		c.lobby.leave(c, room)
+		return
+	}
+
+	if room.removeParticipant(c) {
+		room.close()
 	}
 }
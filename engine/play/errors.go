@@ -0,0 +1,91 @@
+package play
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// ErrorCode tells why a request failed.
+type ErrorCode string
+
+const (
+	ErrorCodeInvalidMessage      ErrorCode = "invalidMessage"      // Malformed JSON, or data of the wrong type.
+	ErrorCodeUnknownMessage      ErrorCode = "unknownMessage"      // A message type the server does not handle.
+	ErrorCodeForbidden           ErrorCode = "forbidden"           // E.g. a spectator moving, or acting for another's seat.
+	ErrorCodeInvalidMove         ErrorCode = "invalidMove"         // An illegal move, or a move out of turn.
+	ErrorCodeInvalidGame         ErrorCode = "invalidGame"         // A game that cannot be loaded.
+	ErrorCodeInvalidRequest      ErrorCode = "invalidRequest"      // A request the game's state does not allow, e.g. a draw offer after the game ended.
+	ErrorCodeNotFound            ErrorCode = "notFound"            // A room or session that does not exist.
+	ErrorCodeInternal            ErrorCode = "internal"            // A failure of the server.
+	ErrorCodeIncompatibleVersion ErrorCode = "incompatibleVersion" // A client of another protocol version.
+)
+
+// RequestError is the failure of a request. It is sent to the client as an error message.
+type RequestError struct {
+	Code ErrorCode
+	Err  error
+}
+
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// requestErrorf returns a RequestError with the code and the formatted message.
+func requestErrorf(code ErrorCode, format string, args ...interface{}) error {
+	return &RequestError{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// errorCode returns the code of the error, ErrorCodeInternal unless it is a RequestError.
+func errorCode(err error) ErrorCode {
+	var e *RequestError
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ErrorCodeInternal
+}
+
+// decodeData decodes the data of the message into the given type.
+func decodeData[T any](msg *Message) (T, error) {
+	data, err := CastData[T](msg.Data)
+	if err != nil {
+		return data, requestErrorf(ErrorCodeInvalidMessage, "invalid %s data: %v", msg.Type, err)
+	}
+	return data, nil
+}
+
+// decodeDataOnto decodes the data of the message onto data, whose fields the message leaves out
+// keep their values.
+func decodeDataOnto[T any](msg *Message, data *T) error {
+	bytes, err := json.Marshal(msg.Data)
+	if err == nil {
+		err = json.Unmarshal(bytes, data)
+	}
+	if err != nil {
+		return requestErrorf(ErrorCodeInvalidMessage, "invalid %s data: %v", msg.Type, err)
+	}
+	return nil
+}
+
+// SendError tells the client that its request failed. The error message carries the request's ID.
+func (c *Connection) SendError(request *Message, err error) {
+	c.sendMessage(Message{
+		Type: MessageTypeError,
+		ID:   request.ID,
+		Data: ErrorResponse{Code: errorCode(err), Error: err.Error(), Request: request.Type},
+	})
+}
+
+// recoverRequest turns a panic while handling the request into an internal error,
+// so that a bad request cannot crash the server. It must be deferred.
+func (c *Connection) recoverRequest(request *Message) {
+	if r := recover(); r != nil {
+		c.logger().Error("Panic processing message", "type", request.Type, "panic", r, "stack", string(debug.Stack()))
+		c.SendError(request, requestErrorf(ErrorCodeInternal, "internal error"))
+	}
+}
@@ -0,0 +1,24 @@
+package play
+
+import (
+	"io"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/ai"
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+// UCIEngines feeds the commands to a session of the text protocol, and returns its engine after
+// every command.
+func UCIEngines(cfg *Config, commands ...string) []*ai.AI {
+	s := &uciSession{cfg: *cfg, game: game.New(), out: io.Discard}
+	s.updateEngine()
+
+	engines := make([]*ai.AI, len(commands))
+	for i, command := range commands {
+		s.handle(command)
+		engines[i] = s.engine
+	}
+	s.wait()
+
+	return engines
+}
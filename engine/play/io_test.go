@@ -2,6 +2,7 @@ package play_test
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
@@ -33,8 +34,34 @@ func (s *TestSuite) TestParsePGN() {
 	fmt.Println(moves)
 }
 
+func (s *TestSuite) TestFEN() {
+	r := s.Require()
+
+	session, err := game.LoadPGN(`
+1. h2-h3 b7-c7 g13-g12 m8-l8
+2. g1-b6`)
+	r.NoError(err)
+
+	fen := session.FEN()
+	fmt.Println(fen)
+
+	g, err := game.LoadFEN(fen)
+	r.NoError(err)
+	r.Equal(session.Board.Grid, g.Board.Grid)
+	r.Equal(session.ActivePlayer, g.ActivePlayer)
+	r.Equal(session.MoveNumber, g.MoveNumber)
+	r.Equal(fen, g.FEN())
+
+	_, err = game.LoadFEN("3,yR/14")
+	r.Error(err)
+
+	_, err = game.LoadFEN(strings.Replace(fen, "3,", "yK,2,", 1))
+	r.Error(err, "pieces on inactive squares must be rejected")
+}
+
 func (s *TestSuite) TestSaveLoad() {
 	r := s.Require()
+	s.T().Chdir(s.T().TempDir()) // SaveToFile writes to the working directory.
 
 	session := game.NewGameSession()
 	file, err := game.SaveToFile(session)
@@ -0,0 +1,251 @@
+package play
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	g "github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+// Lobby keeps the rooms by their IDs, and the sessions of their participants.
+type Lobby struct {
+	cfg         Config        // Config of new rooms.
+	gracePeriod time.Duration // How long a disconnected session can be resumed.
+
+	mutex    sync.Mutex
+	rooms    map[string]*Room
+	sessions map[string]*Connection
+}
+
+// NewLobby creates a lobby whose rooms start with a copy of cfg.
+func NewLobby(cfg *Config, options ...func(*Lobby)) *Lobby {
+	l := &Lobby{
+		cfg:         cfg.clone(),
+		gracePeriod: DefaultSessionGracePeriod,
+		rooms:       map[string]*Room{},
+		sessions:    map[string]*Connection{},
+	}
+	for _, option := range options {
+		option(l)
+	}
+
+	return l
+}
+
+// WithGracePeriod sets how long a disconnected session can be resumed.
+func WithGracePeriod(gracePeriod time.Duration) func(*Lobby) {
+	return func(l *Lobby) {
+		l.gracePeriod = gracePeriod
+	}
+}
+
+// newID generates a random hex ID of the given number of bytes.
+func newID(bytes int) string {
+	id := make([]byte, bytes)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+// newRoomID generates a random room ID.
+func newRoomID() string {
+	return newID(4)
+}
+
+// Connect creates a connection joining the room with the given ID (see join).
+func (l *Lobby) Connect(c MessageWriter, id string, seats []g.Player) *Connection {
+	conn := l.newSession(c)
+	conn.join(id, seats, false)
+
+	return conn
+}
+
+// Spectate creates a read-only connection watching the existing room with the given ID.
+func (l *Lobby) Spectate(c MessageWriter, id string) (*Connection, error) {
+	if l.Room(id) == nil {
+		return nil, fmt.Errorf("room %q does not exist", id)
+	}
+
+	conn := l.newSession(c)
+	conn.join(id, nil, true)
+
+	return conn, nil
+}
+
+// StartEngineGame starts a game where the engine plays all the seats. The room is kept open
+// without participants, so that spectators can come and go. A new ID is generated if id is empty.
+func (l *Lobby) StartEngineGame(id string) (*Room, error) {
+	l.mutex.Lock()
+	if id == "" {
+		id = l.newRoomIDLocked()
+	}
+	if l.rooms[id] != nil {
+		l.mutex.Unlock()
+		return nil, fmt.Errorf("room %q already exists", id)
+	}
+
+	room := newRoom(id, l.cfg)
+	room.engineGame = true
+	l.rooms[id] = room
+	l.mutex.Unlock()
+
+	room.playUntilPlayerMove()
+
+	return room, nil
+}
+
+// newRoomIDLocked generates an ID that is not taken. l.mutex must be held.
+func (l *Lobby) newRoomIDLocked() string {
+	id := newRoomID()
+	for l.rooms[id] != nil {
+		id = newRoomID()
+	}
+	return id
+}
+
+// join moves c to the room with the given ID (creating it if needed, or creating a room
+// with a new ID if id is empty) and claims the requested seats that are free.
+// A spectator joins without seats.
+func (l *Lobby) join(c *Connection, id string, seats []g.Player, spectate bool) *Room {
+	c.stopAnalysis()
+	c.leaveRoom()
+
+	l.mutex.Lock()
+	if id == "" {
+		id = l.newRoomIDLocked()
+	}
+
+	room, ok := l.rooms[id]
+	if !ok {
+		room = newRoom(id, l.cfg)
+		l.rooms[id] = room
+	}
+	if spectate {
+		seats = nil
+	}
+	c.room = room
+	c.spectator = spectate
+	room.addParticipant(c, seats)
+	l.mutex.Unlock()
+
+	return room
+}
+
+// Room returns the room with the given ID or nil if there is none.
+func (l *Lobby) Room(id string) *Room {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.rooms[id]
+}
+
+// CloseRoom stops the engine of the room with the given ID and removes the room.
+// Its participants stay connected, but cannot join it anymore.
+func (l *Lobby) CloseRoom(id string) error {
+	l.mutex.Lock()
+	room := l.rooms[id]
+	delete(l.rooms, id)
+	l.mutex.Unlock()
+
+	if room == nil {
+		return fmt.Errorf("room %q does not exist", id)
+	}
+
+	room.close()
+	return nil
+}
+
+// Rooms describes the open rooms, ordered by ID.
+func (l *Lobby) Rooms() []RoomSummary {
+	l.mutex.Lock()
+	rooms := make([]*Room, 0, len(l.rooms))
+	for _, room := range l.rooms {
+		rooms = append(rooms, room)
+	}
+	l.mutex.Unlock()
+
+	summaries := make([]RoomSummary, len(rooms))
+	for i, room := range rooms {
+		summaries[i] = room.summary()
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].RoomID < summaries[j].RoomID })
+
+	return summaries
+}
+
+// leave removes c from the room, and closes the room once it has no participants
+// (unless it is an engine game).
+func (l *Lobby) leave(c *Connection, room *Room) {
+	l.mutex.Lock()
+	empty := room.removeParticipant(c) && !room.engineGame
+	if empty {
+		delete(l.rooms, room.ID)
+	}
+	l.mutex.Unlock()
+
+	if empty {
+		room.close()
+		return
+	}
+
+	room.broadcastRoomState()
+	room.syncEngine()
+}
+
+// Shutdown stops the engines and analyses of all rooms, and closes the clients' websockets.
+// The rooms and their games are kept, e.g. for saving them.
+func (l *Lobby) Shutdown() {
+	l.mutex.Lock()
+	rooms := make([]*Room, 0, len(l.rooms))
+	for _, room := range l.rooms {
+		rooms = append(rooms, room)
+	}
+	sessions := make([]*Connection, 0, len(l.sessions))
+	for _, c := range l.sessions {
+		if c.expiry != nil {
+			c.expiry.Stop()
+		}
+		sessions = append(sessions, c)
+	}
+	l.sessions = map[string]*Connection{} // Nothing to resume after the shutdown.
+	l.mutex.Unlock()
+
+	for _, c := range sessions {
+		c.stopAnalysis()
+		c.closeWebsocket()
+	}
+	for _, room := range rooms {
+		room.shutdown()
+	}
+}
+
+// games returns the games of the rooms that have moves, by room ID.
+func (l *Lobby) games() map[string]*g.GameSession {
+	l.mutex.Lock()
+	rooms := make([]*Room, 0, len(l.rooms))
+	for _, room := range l.rooms {
+		rooms = append(rooms, room)
+	}
+	l.mutex.Unlock()
+
+	games := map[string]*g.GameSession{}
+	for _, room := range rooms {
+		if gs := room.snapshot(); len(gs.PastMoves) > 0 {
+			games[room.ID] = gs
+		}
+	}
+	return games
+}
+
+// counts returns the number of rooms and of open sessions.
+func (l *Lobby) counts() (rooms, sessions int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return len(l.rooms), len(l.sessions)
+}
@@ -0,0 +1,18 @@
+package play
+
+import "log/slog"
+
+// logger returns a logger with the connection's session and room. The connection's
+// goroutine owns them, so it must be called from there (or before starting another).
+func (c *Connection) logger() *slog.Logger {
+	logger := slog.With("session", c.ID)
+	if c.room != nil {
+		logger = logger.With("room", c.room.ID)
+	}
+	return logger
+}
+
+// logger returns a logger with the room's ID.
+func (r *Room) logger() *slog.Logger {
+	return slog.With("room", r.ID)
+}
@@ -0,0 +1,65 @@
+package play_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/play"
+)
+
+// captureLogs makes the default logger write JSON at the debug level to the returned buffer
+// until the test ends.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	return buf
+}
+
+func TestLogging(t *testing.T) {
+	logs := captureLogs(t)
+
+	conn := NewConnection(t, nil)
+	conn.ProcessMessage(play.MessageTypePlayerMove, play.PGNMove("h2-h3"))
+	conn.Connection.ProcessMessage(&play.Message{Type: play.MessageTypePlayerMove, ID: "7", Data: "h3-h5"})
+
+	records := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		record := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal([]byte(line), &record), line)
+		records = append(records, record)
+	}
+
+	var move, failure map[string]interface{}
+	for _, record := range records {
+		switch record["msg"] {
+		case "Player move":
+			move = record
+		case "Error processing message":
+			failure = record
+		}
+	}
+
+	require.NotNil(t, move)
+	require.Equal(t, "DEBUG", move["level"])
+	require.Equal(t, "h2-h3", move["move"])
+	require.Contains(t, move, "room")
+	require.Contains(t, move, "fen")
+
+	require.NotNil(t, failure)
+	require.Equal(t, "WARN", failure["level"])
+	require.Equal(t, string(play.MessageTypePlayerMove), failure["type"])
+	require.Equal(t, "7", failure["id"])
+	require.Equal(t, string(play.ErrorCodeInvalidMove), failure["code"])
+
+	require.NotContains(t, logs.String(), "\\u001b[", "no ANSI escapes in the logs")
+}
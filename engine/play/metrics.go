@@ -0,0 +1,132 @@
+package play
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/ai"
+)
+
+// messageCounter counts the messages received from the clients by type.
+type messageCounter struct {
+	mutex  sync.Mutex
+	counts map[MessageType]int
+}
+
+// add counts a message of the type. Types outside the protocol are counted as "unknown",
+// so that clients cannot add labels at will.
+func (mc *messageCounter) add(messageType MessageType) {
+	if _, ok := messageSpecs[messageType]; !ok {
+		messageType = "unknown"
+	}
+
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	if mc.counts == nil {
+		mc.counts = map[MessageType]int{}
+	}
+	mc.counts[messageType]++
+}
+
+// snapshot returns the counts, sorted by type.
+func (mc *messageCounter) snapshot() ([]MessageType, map[MessageType]int) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	types := make([]MessageType, 0, len(mc.counts))
+	counts := make(map[MessageType]int, len(mc.counts))
+	for messageType, count := range mc.counts {
+		types = append(types, messageType)
+		counts[messageType] = count
+	}
+	slices.Sort(types)
+	return types, counts
+}
+
+// handleMetrics serves the metrics of the server and its engines in the Prometheus text format.
+func (s *Server) handleMetrics(c *fiber.Ctx) error {
+	sb := strings.Builder{}
+	s.writeMetrics(&sb)
+
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	return c.SendString(sb.String())
+}
+
+func (s *Server) writeMetrics(w io.Writer) {
+	mw := metricsWriter{w}
+	rooms, sessions := s.lobby.counts()
+	stats := s.stats.Snapshot()
+
+	mw.metric("chess_websocket_connections", "gauge", "Open websocket connections.")
+	mw.sample("chess_websocket_connections", "", s.connections.Load())
+	mw.metric("chess_rooms", "gauge", "Rooms of the lobby.")
+	mw.sample("chess_rooms", "", rooms)
+	mw.metric("chess_sessions", "gauge", "Sessions of the lobby, including the disconnected ones that can be resumed.")
+	mw.sample("chess_sessions", "", sessions)
+
+	types, counts := s.messages.snapshot()
+	mw.metric("chess_messages_received_total", "counter", "Messages received from the clients by type.")
+	for _, messageType := range types {
+		mw.sample("chess_messages_received_total", fmt.Sprintf(`type=%q`, messageType), counts[messageType])
+	}
+
+	pool := s.pool.State()
+	mw.metric("chess_engine_pool_capacity", "gauge", "Searches the engine pool runs at once.")
+	mw.sample("chess_engine_pool_capacity", "", pool.Capacity)
+	mw.metric("chess_engine_pool_running", "gauge", "Searches holding a slot of the engine pool.")
+	mw.sample("chess_engine_pool_running", "", pool.Running)
+	mw.metric("chess_engine_pool_queued", "gauge", "Searches waiting for a slot of the engine pool.")
+	mw.sample("chess_engine_pool_queued", "", pool.Queued)
+
+	mw.metric("chess_searches_in_flight", "gauge", "Engine searches running.")
+	mw.sample("chess_searches_in_flight", "", stats.InFlight)
+	mw.metric("chess_searches_total", "counter", "Engine searches finished.")
+	mw.sample("chess_searches_total", "", stats.Searches)
+	mw.metric("chess_search_nodes_total", "counter", "Positions evaluated by the finished searches.")
+	mw.sample("chess_search_nodes_total", "", stats.Nodes)
+	mw.metric("chess_search_seconds_total", "counter", "Time spent in the finished searches.")
+	mw.sample("chess_search_seconds_total", "", stats.Elapsed.Seconds())
+	mw.metric("chess_search_nodes_per_second", "gauge", "Average nodes per second of the finished searches.")
+	mw.sample("chess_search_nodes_per_second", "", stats.NPS())
+
+	mw.metric("chess_search_depth_seconds", "histogram", "Time from the start of a search until it completed the depth.")
+	for _, ds := range stats.Depths {
+		for i, bound := range ai.SearchTimeBuckets {
+			mw.sample("chess_search_depth_seconds_bucket", fmt.Sprintf(`depth="%v",le="%v"`, ds.Depth, bound.Seconds()), ds.Buckets[i])
+		}
+		mw.sample("chess_search_depth_seconds_bucket", fmt.Sprintf(`depth="%v",le="+Inf"`, ds.Depth), ds.Count)
+		mw.sample("chess_search_depth_seconds_sum", fmt.Sprintf(`depth="%v"`, ds.Depth), ds.Sum.Seconds())
+		mw.sample("chess_search_depth_seconds_count", fmt.Sprintf(`depth="%v"`, ds.Depth), ds.Count)
+	}
+
+	mw.metric("chess_tt_probes_total", "counter", "Transposition table lookups.")
+	mw.sample("chess_tt_probes_total", "", stats.TTProbes)
+	mw.metric("chess_tt_hits_total", "counter", "Transposition table lookups that hit.")
+	mw.sample("chess_tt_hits_total", "", stats.TTHits)
+	mw.metric("chess_tt_hit_rate", "gauge", "Share of the transposition table lookups that hit.")
+	mw.sample("chess_tt_hit_rate", "", stats.TTHitRate())
+}
+
+// metricsWriter writes metrics in the Prometheus text format.
+type metricsWriter struct {
+	w io.Writer
+}
+
+// metric starts a metric with its type and help.
+func (mw metricsWriter) metric(name, kind, help string) {
+	fmt.Fprintf(mw.w, "# HELP %v %v\n# TYPE %v %v\n", name, help, name, kind)
+}
+
+// sample writes a sample of the metric, with the labels if any, e.g. `type="hint"`.
+func (mw metricsWriter) sample(name, labels string, value interface{}) {
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+	fmt.Fprintf(mw.w, "%v %v\n", name, value)
+}
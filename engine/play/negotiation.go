@@ -0,0 +1,309 @@
+package play
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/ai"
+	g "github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+const (
+	negotiationDepth = 2 // Depth of the engine's evaluation of an offer.
+
+	engineDrawAcceptScore     = 0.5 // The engine accepts a draw unless it is better by more than this.
+	engineTakebackAcceptScore = 2.0 // The engine accepts a takeback unless the move gave it more than this.
+)
+
+// negotiation is an agreement of the seats, e.g. to a draw. It lapses when the game changes.
+type negotiation struct {
+	position positionKey
+	agreed   [4]bool
+}
+
+// positionKey identifies the position of a game, as far as negotiations are concerned.
+type positionKey struct {
+	currentMove int
+	moves       int
+}
+
+func newPositionKey(gs *g.GameSession) positionKey {
+	return positionKey{currentMove: gs.CurrentMove, moves: len(gs.PastMoves)}
+}
+
+// agreedLocked returns the seats that agreed in the current position. r.mutex must be held.
+func (r *Room) agreedLocked(n *negotiation) []g.Player {
+	players := []g.Player{}
+	if n.position != newPositionKey(r.gs) {
+		return players
+	}
+	for player, agreed := range n.agreed {
+		if agreed {
+			players = append(players, g.Player(player))
+		}
+	}
+	return players
+}
+
+// ownsSeat returns whether c claimed the player's seat.
+func (r *Room) ownsSeat(c *Connection, player g.Player) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.seats[player] == c
+}
+
+// engineDecisions returns whether the engine accepts the connection's offer (of the request's type)
+// on behalf of each of its seats: it does if its evaluation of the game for the seat's team is at
+// most maxScore. The evaluation waits for the engine pool like the connection's other requests.
+func (c *Connection) engineDecisions(request MessageType, gs *g.GameSession, seats []g.Player, maxScore float64) (map[g.Player]bool, error) {
+	decisions := map[g.Player]bool{}
+	if len(seats) == 0 {
+		return decisions, nil
+	}
+
+	cfg := c.room.settings()
+	ctx, release, err := cfg.Pool.Acquire(context.Background(), c.poolOwner(), PriorityRequest, c.sendQueued(request))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	engine := ai.New(negotiationDepth, cfg.Spread, cfg.SpreadDrop, cfg.EvalLimit, cfg.engineOptions()...)
+	result, err := engine.GetBestMoveCtx(ctx, gs.Game, ai.Limits{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, player := range seats {
+		score := result.Score * float64(gs.ActivePlayer.Team()*player.Team())
+		decisions[player] = score <= maxScore
+	}
+	return decisions, nil
+}
+
+// engineSeatsLocked returns the seats of the team that nobody claimed. r.mutex must be held.
+func (r *Room) engineSeatsLocked(team g.Team) []g.Player {
+	players := []g.Player{}
+	for player := g.Player(0); player < 4; player++ {
+		if _, claimed := r.seats[player]; !claimed && player.Team() == team {
+			players = append(players, player)
+		}
+	}
+	return players
+}
+
+// processNegotiation handles a resignation, or an offer, acceptance or refusal of a draw or takeback.
+func (c *Connection) processNegotiation(messageType MessageType, req NegotiationRequest) error {
+	if req.Player > 3 {
+		return requestErrorf(ErrorCodeInvalidMessage, "invalid player %v", req.Player)
+	}
+
+	switch messageType {
+	case MessageTypeResign:
+		return c.processResign(req)
+	case MessageTypeOfferDraw, MessageTypeAcceptDraw:
+		return c.processAgreeDraw(messageType, req)
+	case MessageTypeDeclineDraw:
+		return c.processDeclineDraw(req)
+	case MessageTypeRequestTakeback, MessageTypeAcceptTakeback:
+		return c.agreeTakeback(messageType, req)
+	case MessageTypeDeclineTakeback:
+		return c.processDeclineTakeback(req)
+	}
+	return nil
+}
+
+// processResign ends the game: the team of the player's seat loses.
+func (c *Connection) processResign(req NegotiationRequest) error {
+	r := c.room
+
+	r.mutex.Lock()
+	if r.seats[req.Player] != c {
+		r.mutex.Unlock()
+		return requestErrorf(ErrorCodeForbidden, "cannot resign: the seat of %v is not the connection's", req.Player)
+	}
+	if err := r.gs.Resign(req.Player); err != nil {
+		r.mutex.Unlock()
+		return &RequestError{Code: ErrorCodeInvalidRequest, Err: err}
+	}
+	r.stopPlayingEngineMovesIfRunning(true)
+	r.resetClockTimerLocked()
+	gs := r.gs.Copy()
+	r.mutex.Unlock()
+
+	r.broadcast(MessageTypeGameEnded, NewGameEndedResponse(gs))
+	return nil
+}
+
+// processAgreeDraw records that the player agrees to a draw. The engine seats decide by their
+// evaluation. The game is drawn once all four seats agree; an offer lapses with the next move.
+func (c *Connection) processAgreeDraw(messageType MessageType, req NegotiationRequest) error {
+	r := c.room
+	if !r.ownsSeat(c, req.Player) {
+		return requestErrorf(ErrorCodeForbidden, "cannot offer a draw: the seat of %v is not the connection's", req.Player)
+	}
+
+	gs := r.snapshot()
+	if gs.HasEnded() {
+		return requestErrorf(ErrorCodeInvalidRequest, "cannot offer a draw: the game has ended")
+	}
+
+	// The engine seats of both teams decide before the offer is recorded.
+	r.mutex.Lock()
+	engineSeats := append(r.engineSeatsLocked(1), r.engineSeatsLocked(-1)...)
+	r.mutex.Unlock()
+	decisions, err := c.engineDecisions(messageType, gs, engineSeats, engineDrawAcceptScore)
+	if err != nil {
+		return fmt.Errorf("evaluating a draw offer: %w", err)
+	}
+
+	r.mutex.Lock()
+	if newPositionKey(r.gs) != newPositionKey(gs) || r.gs.HasEnded() {
+		r.mutex.Unlock()
+		return nil // Lapsed.
+	}
+	if r.draw.position != newPositionKey(gs) {
+		r.draw = negotiation{position: newPositionKey(gs)}
+	}
+	r.draw.agreed[req.Player] = true
+
+	for player, accepted := range decisions {
+		if _, claimed := r.seats[player]; claimed {
+			continue // Claimed in the meantime.
+		}
+		if !accepted {
+			r.draw = negotiation{}
+			r.mutex.Unlock()
+			r.broadcast(MessageTypeDrawDeclined, NegotiationResponse{Player: player, Agreed: []g.Player{}})
+			return nil
+		}
+		r.draw.agreed[player] = true
+	}
+
+	agreed := r.agreedLocked(&r.draw)
+	drawn := len(agreed) == 4
+	if drawn {
+		_ = r.gs.AgreeDraw()
+		r.stopPlayingEngineMovesIfRunning(true)
+		r.resetClockTimerLocked()
+	}
+	gs = r.gs.Copy()
+	r.mutex.Unlock()
+
+	if drawn {
+		r.broadcast(MessageTypeGameEnded, NewGameEndedResponse(gs))
+		return nil
+	}
+	r.broadcast(MessageTypeDrawOffer, NegotiationResponse{Player: req.Player, Agreed: agreed})
+	return nil
+}
+
+// processDeclineDraw withdraws or declines the pending draw offer.
+func (c *Connection) processDeclineDraw(req NegotiationRequest) error {
+	r := c.room
+
+	r.mutex.Lock()
+	if r.seats[req.Player] != c {
+		r.mutex.Unlock()
+		return requestErrorf(ErrorCodeForbidden, "cannot decline a draw: the seat of %v is not the connection's", req.Player)
+	}
+	r.draw = negotiation{}
+	r.mutex.Unlock()
+
+	r.broadcast(MessageTypeDrawDeclined, NegotiationResponse{Player: req.Player, Agreed: []g.Player{}})
+	return nil
+}
+
+// agreeTakeback records that the player requests or accepts taking back the last move.
+// Only the team that made the move can request it. The move is taken back once both seats
+// of the other team accept; the engine seats decide by their evaluation.
+func (c *Connection) agreeTakeback(messageType MessageType, req NegotiationRequest) error {
+	r := c.room
+	request := messageType == MessageTypeRequestTakeback
+	if !r.ownsSeat(c, req.Player) {
+		return requestErrorf(ErrorCodeForbidden, "cannot agree to a takeback: the seat of %v is not the connection's", req.Player)
+	}
+
+	gs := r.snapshot()
+	if gs.HasEnded() || gs.CurrentMove < 0 {
+		return requestErrorf(ErrorCodeInvalidRequest, "cannot agree to a takeback: there is no move to take back")
+	}
+	mover := g.Player(gs.CurrentMove % 4)
+	if request != (req.Player.Team() == mover.Team()) {
+		return requestErrorf(ErrorCodeInvalidRequest, "cannot agree to a takeback: only %v's team can request it, and the other team accept it", mover)
+	}
+
+	// The engine seats of the other team decide before the request is recorded.
+	r.mutex.Lock()
+	engineSeats := r.engineSeatsLocked(mover.Team().Opposite())
+	r.mutex.Unlock()
+	decisions, err := c.engineDecisions(messageType, gs, engineSeats, engineTakebackAcceptScore)
+	if err != nil {
+		return fmt.Errorf("evaluating a takeback request: %w", err)
+	}
+
+	r.mutex.Lock()
+	if newPositionKey(r.gs) != newPositionKey(gs) || r.gs.HasEnded() {
+		r.mutex.Unlock()
+		return nil // Lapsed.
+	}
+	if r.takeback.position != newPositionKey(gs) {
+		r.takeback = negotiation{position: newPositionKey(gs)}
+	}
+	r.takeback.agreed[req.Player] = true
+
+	for player, accepted := range decisions {
+		if _, claimed := r.seats[player]; claimed {
+			continue // Claimed in the meantime.
+		}
+		if !accepted {
+			r.takeback = negotiation{}
+			r.mutex.Unlock()
+			r.broadcast(MessageTypeTakebackDeclined, NegotiationResponse{Player: player, Agreed: []g.Player{}})
+			return nil
+		}
+		r.takeback.agreed[player] = true
+	}
+
+	agreed := r.agreedLocked(&r.takeback)
+	accepted := true
+	for player := g.Player(0); player < 4; player++ {
+		if player.Team() != mover.Team() && !r.takeback.agreed[player] {
+			accepted = false
+		}
+	}
+	if accepted {
+		r.stopPlayingEngineMovesIfRunning(true)
+		_ = r.gs.TakeBack()
+		r.takeback = negotiation{}
+		r.resetClockTimerLocked()
+	}
+	r.mutex.Unlock()
+
+	if !accepted {
+		r.broadcast(MessageTypeTakebackRequest, NegotiationResponse{Player: req.Player, Agreed: agreed})
+		return nil
+	}
+
+	r.moveMade()
+	r.broadcastGameState()
+	r.playUntilPlayerMove()
+	return nil
+}
+
+// processDeclineTakeback withdraws or declines the pending takeback request.
+func (c *Connection) processDeclineTakeback(req NegotiationRequest) error {
+	r := c.room
+
+	r.mutex.Lock()
+	if r.seats[req.Player] != c {
+		r.mutex.Unlock()
+		return requestErrorf(ErrorCodeForbidden, "cannot decline a takeback: the seat of %v is not the connection's", req.Player)
+	}
+	r.takeback = negotiation{}
+	r.mutex.Unlock()
+
+	r.broadcast(MessageTypeTakebackDeclined, NegotiationResponse{Player: req.Player, Agreed: []g.Player{}})
+	return nil
+}
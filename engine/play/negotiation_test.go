@@ -0,0 +1,99 @@
+package play_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+	"github.com/vpoliakov01/2v2ChessAI/engine/play"
+)
+
+func TestResign(t *testing.T) {
+	lobby := play.NewLobby(defaultTestConfig())
+	redYellow := ConnectToLobby(t, lobby, "room", playerRed, playerYellow)
+	blueGreen := ConnectToLobby(t, lobby, "room", playerBlue, playerGreen)
+
+	redYellow.ProcessMessage(play.MessageTypeResign, play.NegotiationRequest{Player: playerBlue})
+	require.Empty(t, blueGreen.MessagesOfType(play.MessageTypeGameEnded), "Blue's seat is not Red/Yellow's")
+
+	redYellow.ProcessMessage(play.MessageTypeResign, play.NegotiationRequest{Player: playerYellow})
+	ended := dataFromMessage[play.GameEndedResponse](t, requireSingleMessage(t, blueGreen, play.MessageTypeGameEnded))
+	require.Equal(t, play.GameEndedResponse{
+		King:   "Yellow",
+		Winner: game.Team(-1).String(),
+		Reason: string(game.TerminationResignation),
+		Result: game.ResultBlueGreen,
+	}, ended)
+
+	blueGreen.ProcessMessage(play.MessageTypeSaveGame, nil)
+	pgn := dataFromMessage[play.SaveGameResponse](t, requireSingleMessage(t, blueGreen, play.MessageTypeSaveGameResponse)).PGN
+	require.Contains(t, pgn, `[Result "0-1"]`)
+	require.Contains(t, pgn, `[Termination "resignation"]`)
+}
+
+func TestDrawNeedsAllSeats(t *testing.T) {
+	lobby := play.NewLobby(defaultTestConfig())
+	redYellow := ConnectToLobby(t, lobby, "room", playerRed, playerYellow)
+	blueGreen := ConnectToLobby(t, lobby, "room", playerBlue, playerGreen)
+
+	redYellow.ProcessMessage(play.MessageTypeOfferDraw, play.NegotiationRequest{Player: playerRed})
+	offer := dataFromMessage[play.NegotiationResponse](t, requireSingleMessage(t, blueGreen, play.MessageTypeDrawOffer))
+	require.Equal(t, []game.Player{playerRed}, offer.Agreed)
+
+	// The offer lapses with the next move.
+	redYellow.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+	blueGreen.ProcessMessage(play.MessageTypeAcceptDraw, play.NegotiationRequest{Player: playerBlue})
+	blueGreen.ProcessMessage(play.MessageTypeAcceptDraw, play.NegotiationRequest{Player: playerGreen})
+	offers := blueGreen.MessagesOfType(play.MessageTypeDrawOffer)
+	require.Equal(t, []game.Player{playerBlue, playerGreen}, dataFromMessage[play.NegotiationResponse](t, offers[len(offers)-1]).Agreed)
+
+	redYellow.ProcessMessage(play.MessageTypeAcceptDraw, play.NegotiationRequest{Player: playerRed})
+	require.Empty(t, blueGreen.MessagesOfType(play.MessageTypeGameEnded), "Yellow has yet to agree")
+
+	redYellow.ProcessMessage(play.MessageTypeAcceptDraw, play.NegotiationRequest{Player: playerYellow})
+	ended := dataFromMessage[play.GameEndedResponse](t, requireSingleMessage(t, blueGreen, play.MessageTypeGameEnded))
+	require.Equal(t, game.ResultDraw, ended.Result)
+	require.Equal(t, string(game.TerminationAgreement), ended.Reason)
+}
+
+func TestDeclineDraw(t *testing.T) {
+	lobby := play.NewLobby(defaultTestConfig())
+	redYellow := ConnectToLobby(t, lobby, "room", playerRed, playerYellow)
+	blueGreen := ConnectToLobby(t, lobby, "room", playerBlue, playerGreen)
+
+	redYellow.ProcessMessage(play.MessageTypeOfferDraw, play.NegotiationRequest{Player: playerRed})
+	blueGreen.ProcessMessage(play.MessageTypeDeclineDraw, play.NegotiationRequest{Player: playerBlue})
+	declined := dataFromMessage[play.NegotiationResponse](t, requireSingleMessage(t, redYellow, play.MessageTypeDrawDeclined))
+	require.Equal(t, playerBlue, declined.Player)
+
+	redYellow.ProcessMessage(play.MessageTypeOfferDraw, play.NegotiationRequest{Player: playerYellow})
+	offers := blueGreen.MessagesOfType(play.MessageTypeDrawOffer)
+	require.Equal(t, []game.Player{playerYellow}, dataFromMessage[play.NegotiationResponse](t, offers[len(offers)-1]).Agreed,
+		"the declined offer is gone")
+}
+
+func TestTakeback(t *testing.T) {
+	lobby := play.NewLobby(defaultTestConfig())
+	redYellow := ConnectToLobby(t, lobby, "room", playerRed, playerYellow)
+	blueGreen := ConnectToLobby(t, lobby, "room", playerBlue, playerGreen)
+
+	redYellow.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+	blueGreen.ProcessMessage(play.MessageTypeRequestTakeback, play.NegotiationRequest{Player: playerBlue})
+	require.Empty(t, redYellow.MessagesOfType(play.MessageTypeTakebackRequest), "only Red/Yellow can take back Red's move")
+
+	redYellow.ProcessMessage(play.MessageTypeRequestTakeback, play.NegotiationRequest{Player: playerRed})
+	request := dataFromMessage[play.NegotiationResponse](t, requireSingleMessage(t, blueGreen, play.MessageTypeTakebackRequest))
+	require.Equal(t, playerRed, request.Player)
+
+	blueGreen.ProcessMessage(play.MessageTypeAcceptTakeback, play.NegotiationRequest{Player: playerBlue})
+	require.Len(t, blueGreen.MessagesOfType(play.MessageTypeLoadGameResponse), 1, "Green has yet to accept")
+
+	blueGreen.ProcessMessage(play.MessageTypeAcceptTakeback, play.NegotiationRequest{Player: playerGreen})
+	games := blueGreen.MessagesOfType(play.MessageTypeLoadGameResponse)
+	require.Len(t, games, 2)
+	require.Empty(t, dataFromMessage[play.LoadGameResponse](t, games[1]).PastMoves)
+
+	redYellow.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+	require.Empty(t, redYellow.MessagesOfType(play.MessageTypeInvalidMove), "Red is to move again")
+}
@@ -0,0 +1,242 @@
+package play
+
+import (
+	"cmp"
+	"context"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// DefaultEngineConcurrency is the number of searches the engine pool of a server runs at once by default:
+// one per two CPUs, so that every search still runs on two threads (see EnginePool.Threads).
+var DefaultEngineConcurrency = max(runtime.NumCPU()/2, 1)
+
+// maxTrackedOwners bounds the owners whose turns EnginePool remembers while they have no searches.
+const maxTrackedOwners = 1024
+
+// Priority orders the searches waiting for the engine pool, the lowest first.
+type Priority int
+
+const (
+	PriorityMove       Priority = iota // An engine move that human players wait for.
+	PriorityRequest                    // A hint, an offer to the engine, or an analysis over the API.
+	PriorityEngineGame                 // An engine move of a game without human players, cut short for the searches above.
+	PriorityAnalysis                   // Background analysis, which gives way to the other searches.
+)
+
+// EnginePool runs the engine searches of a server within a concurrency budget. Waiting searches
+// are served by priority; within a priority, the owners (sessions or rooms) take turns, so that
+// the searches of one client cannot starve the others'.
+//
+// A nil pool runs every search at once.
+type EnginePool struct {
+	mutex    sync.Mutex // Guards the fields below.
+	capacity int
+	running  []*poolJob
+	queue    []*poolJob        // Sorted by the order they are served in.
+	turns    map[string]uint64 // The last turn of every owner.
+	turn     uint64
+	seq      uint64
+}
+
+// poolJob is a search waiting for a slot of the pool, or holding one.
+type poolJob struct {
+	owner    string
+	priority Priority
+	seq      uint64 // Order of arrival.
+
+	granted   chan struct{} // Closed when the job gets its slot.
+	preempt   context.CancelFunc
+	preempted bool
+	position  int // Last reported position in the queue; 0 if never queued behind others.
+	onQueued  func(position int)
+}
+
+// NewEnginePool creates a pool running at most capacity searches at once (at least 1).
+func NewEnginePool(capacity int) *EnginePool {
+	return &EnginePool{capacity: max(capacity, 1), turns: map[string]uint64{}}
+}
+
+// Threads returns the number of threads every search should use so that the searches of a full
+// pool share the CPUs (0, all CPUs, for a nil pool).
+func (p *EnginePool) Threads() int {
+	if p == nil {
+		return 0
+	}
+	return max(runtime.NumCPU()/p.capacity, 1)
+}
+
+// Acquire waits for a slot for a search of the owner, and returns the context to search with and
+// the function that releases the slot, which must be called once the search is done.
+//
+// While the search waits, onQueued (if not nil) is called with its position in the queue, from 1,
+// whenever the position changes, and with 0 once it gets its slot. The context of a search of
+// PriorityEngineGame or PriorityAnalysis is cancelled when a search of a higher priority waits
+// for its slot, the analyses first.
+// Acquire returns ctx's error if ctx is done before the search gets a slot.
+func (p *EnginePool) Acquire(ctx context.Context, owner string, priority Priority, onQueued func(position int)) (context.Context, func(), error) {
+	if p == nil {
+		return ctx, func() {}, ctx.Err()
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	job := &poolJob{
+		owner:    owner,
+		priority: priority,
+		granted:  make(chan struct{}),
+		preempt:  cancel,
+		onQueued: onQueued,
+	}
+
+	p.mutex.Lock()
+	p.seq++
+	job.seq = p.seq
+	p.queue = append(p.queue, job)
+	notify := p.scheduleLocked()
+	p.mutex.Unlock()
+	notify()
+
+	select {
+	case <-job.granted:
+		var once sync.Once
+		return jobCtx, func() { once.Do(func() { p.release(job) }) }, nil
+	case <-ctx.Done():
+	}
+
+	p.mutex.Lock()
+	if i := slices.Index(p.queue, job); i >= 0 {
+		p.queue = slices.Delete(p.queue, i, i+1)
+		notify = p.scheduleLocked()
+		p.mutex.Unlock()
+		notify()
+	} else { // Granted in the meantime.
+		p.mutex.Unlock()
+		p.release(job)
+	}
+	cancel()
+	return nil, nil, ctx.Err()
+}
+
+// release frees the job's slot for the next search.
+func (p *EnginePool) release(job *poolJob) {
+	job.preempt()
+
+	p.mutex.Lock()
+	p.running = slices.DeleteFunc(p.running, func(j *poolJob) bool { return j == job })
+	if len(p.turns) > maxTrackedOwners {
+		p.forgetIdleOwnersLocked()
+	}
+	notify := p.scheduleLocked()
+	p.mutex.Unlock()
+
+	notify()
+}
+
+// scheduleLocked grants the free slots to the first jobs of the queue, preempts the engine games
+// and the analyses that higher priority jobs wait for, and returns the function that reports the
+// changed positions of the jobs, to be called without p.mutex. p.mutex must be held.
+func (p *EnginePool) scheduleLocked() (notify func()) {
+	slices.SortFunc(p.queue, func(a, b *poolJob) int {
+		return cmp.Or(cmp.Compare(a.priority, b.priority), cmp.Compare(p.turns[a.owner], p.turns[b.owner]), cmp.Compare(a.seq, b.seq))
+	})
+
+	granted := []*poolJob{}
+	for len(p.running) < p.capacity && len(p.queue) > 0 {
+		job := p.queue[0]
+		p.queue = p.queue[1:]
+		p.turn++
+		p.turns[job.owner] = p.turn
+		p.running = append(p.running, job)
+		granted = append(granted, job)
+	}
+
+	freeing := 0 // Slots of the preempted jobs, which are about to be released.
+	for _, job := range p.running {
+		if job.preempted {
+			freeing++
+		}
+	}
+	preemptible := slices.Clone(p.running) // The lowest priority first.
+	slices.SortStableFunc(preemptible, func(a, b *poolJob) int { return cmp.Compare(b.priority, a.priority) })
+	for _, job := range preemptible {
+		if job.preempted {
+			continue
+		}
+		if job.priority < PriorityEngineGame {
+			break
+		}
+		waiting := 0 // Jobs of a higher priority than the job.
+		for _, queued := range p.queue {
+			if queued.priority < job.priority {
+				waiting++
+			}
+		}
+		if waiting <= freeing {
+			break
+		}
+		job.preempted = true
+		job.preempt()
+		freeing++
+	}
+
+	type report struct {
+		onQueued func(int)
+		position int
+	}
+	reports := []report{}
+	for _, job := range granted {
+		if job.onQueued != nil && job.position > 0 {
+			reports = append(reports, report{job.onQueued, 0})
+		}
+	}
+	for i, job := range p.queue {
+		if job.position != i+1 {
+			job.position = i + 1
+			if job.onQueued != nil {
+				reports = append(reports, report{job.onQueued, job.position})
+			}
+		}
+	}
+
+	return func() {
+		for _, job := range granted {
+			close(job.granted)
+		}
+		for _, r := range reports {
+			r.onQueued(r.position)
+		}
+	}
+}
+
+// forgetIdleOwnersLocked forgets the turns of the owners without searches. p.mutex must be held.
+func (p *EnginePool) forgetIdleOwnersLocked() {
+	busy := map[string]bool{}
+	for _, job := range slices.Concat(p.running, p.queue) {
+		busy[job.owner] = true
+	}
+	for owner := range p.turns {
+		if !busy[owner] {
+			delete(p.turns, owner)
+		}
+	}
+}
+
+// PoolState is the state of an engine pool at a point in time.
+type PoolState struct {
+	Capacity int
+	Running  int
+	Queued   int
+}
+
+// State returns the current state of the pool.
+func (p *EnginePool) State() PoolState {
+	if p == nil {
+		return PoolState{}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return PoolState{Capacity: p.capacity, Running: len(p.running), Queued: len(p.queue)}
+}
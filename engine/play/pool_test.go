@@ -0,0 +1,247 @@
+package play_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/ai"
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+	"github.com/vpoliakov01/2v2ChessAI/engine/play"
+)
+
+// queueSearch acquires a slot of the pool for the owner in the background once the pool has
+// queued the previous searches, and reports the owner on served when it gets the slot.
+// The slot is released at once.
+func queueSearch(t *testing.T, pool *play.EnginePool, owner string, priority play.Priority, served chan<- string) {
+	t.Helper()
+	queued := pool.State().Queued
+
+	go func() {
+		_, release, err := pool.Acquire(context.Background(), owner, priority, nil)
+		if err != nil {
+			served <- "error: " + err.Error()
+			return
+		}
+		served <- owner
+		release()
+	}()
+
+	require.Eventually(t, func() bool { return pool.State().Queued == queued+1 }, time.Second, time.Millisecond)
+}
+
+func TestEnginePoolPriorities(t *testing.T) {
+	pool := play.NewEnginePool(1)
+	_, release, err := pool.Acquire(context.Background(), "holder", play.PriorityMove, nil)
+	require.NoError(t, err)
+
+	served := make(chan string, 4)
+	queueSearch(t, pool, "analysis", play.PriorityAnalysis, served)
+	queueSearch(t, pool, "engineGame", play.PriorityEngineGame, served)
+	queueSearch(t, pool, "request", play.PriorityRequest, served)
+	queueSearch(t, pool, "move", play.PriorityMove, served)
+	release()
+
+	for _, owner := range []string{"move", "request", "engineGame", "analysis"} {
+		require.Equal(t, owner, <-served)
+	}
+	require.Equal(t, play.PoolState{Capacity: 1}, pool.State())
+}
+
+func TestEnginePoolFairness(t *testing.T) {
+	pool := play.NewEnginePool(1)
+	_, release, err := pool.Acquire(context.Background(), "a", play.PriorityMove, nil)
+	require.NoError(t, err)
+
+	// a was served last, so b goes first; then they take turns.
+	served := make(chan string, 4)
+	queueSearch(t, pool, "a", play.PriorityMove, served)
+	queueSearch(t, pool, "a", play.PriorityMove, served)
+	queueSearch(t, pool, "b", play.PriorityMove, served)
+	queueSearch(t, pool, "b", play.PriorityMove, served)
+	release()
+
+	for _, owner := range []string{"b", "a", "b", "a"} {
+		require.Equal(t, owner, <-served)
+	}
+}
+
+func TestEnginePoolPositions(t *testing.T) {
+	pool := play.NewEnginePool(1)
+	_, release, err := pool.Acquire(context.Background(), "holder", play.PriorityMove, nil)
+	require.NoError(t, err)
+
+	mu := sync.Mutex{}
+	positions := []int{}
+	granted := make(chan func())
+	go func() {
+		_, release, err := pool.Acquire(context.Background(), "a", play.PriorityEngineGame, func(position int) {
+			mu.Lock()
+			positions = append(positions, position)
+			mu.Unlock()
+		})
+		require.NoError(t, err)
+		granted <- release
+	}()
+	require.Eventually(t, func() bool { return pool.State().Queued == 1 }, time.Second, time.Millisecond)
+
+	// A search of a higher priority moves a back, and one that gives up moves it forward.
+	ctx, cancel := context.WithCancel(context.Background())
+	gaveUp := make(chan error)
+	go func() {
+		_, _, err := pool.Acquire(ctx, "b", play.PriorityMove, nil)
+		gaveUp <- err
+	}()
+	require.Eventually(t, func() bool { return pool.State().Queued == 2 }, time.Second, time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-gaveUp, context.Canceled)
+
+	release()
+	(<-granted)()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []int{1, 2, 1, 0}, positions)
+}
+
+func TestEnginePoolPreemptsAnalysis(t *testing.T) {
+	pool := play.NewEnginePool(1)
+	analysisCtx, releaseAnalysis, err := pool.Acquire(context.Background(), "a", play.PriorityAnalysis, nil)
+	require.NoError(t, err)
+
+	// Another analysis waits its turn.
+	served := make(chan string, 2)
+	queueSearch(t, pool, "b", play.PriorityAnalysis, served)
+	require.NoError(t, analysisCtx.Err())
+
+	queueSearch(t, pool, "c", play.PriorityRequest, served)
+	select {
+	case <-analysisCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the analysis should be preempted")
+	}
+
+	releaseAnalysis()
+	require.Equal(t, "c", <-served)
+	require.Equal(t, "b", <-served)
+}
+
+func TestEnginePoolNil(t *testing.T) {
+	var pool *play.EnginePool
+	ctx, release, err := pool.Acquire(context.Background(), "a", play.PriorityMove, nil)
+	require.NoError(t, err)
+	require.NoError(t, ctx.Err())
+	release()
+	require.Zero(t, pool.Threads())
+}
+
+// TestRoomEngineQueued checks that the participants of a room learn the position of the
+// engine's move in the queue of the pool while it waits.
+func TestRoomEngineQueued(t *testing.T) {
+	pool := play.NewEnginePool(1)
+	_, release, err := pool.Acquire(context.Background(), "other", play.PriorityMove, nil)
+	require.NoError(t, err)
+
+	cfg := defaultTestConfig()
+	cfg.HumanPlayers = []game.Player{playerRed, playerYellow}
+	cfg.Pool = pool
+	conn := NewConnection(t, cfg)
+	conn.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+
+	require.Eventually(t, func() bool { return len(conn.MessagesOfType(play.MessageTypeEngineQueued)) == 1 }, time.Second, time.Millisecond)
+	queued := dataFromMessage[play.EngineQueuedResponse](t, conn.MessagesOfType(play.MessageTypeEngineQueued)[0])
+	require.Equal(t, play.EngineQueuedResponse{Request: play.MessageTypeEngineMove, Position: 1}, queued)
+	require.Empty(t, conn.MessagesOfType(play.MessageTypeEngineMove))
+
+	release()
+	require.Eventually(t, func() bool { return len(conn.MessagesOfType(play.MessageTypeEngineMove)) == 1 }, 5*time.Second, time.Millisecond)
+	queued = dataFromMessage[play.EngineQueuedResponse](t, conn.MessagesOfType(play.MessageTypeEngineQueued)[1])
+	require.Zero(t, queued.Position)
+}
+
+// TestAnalysisGivesWay checks that a running analysis gives its slot of the pool to a hint,
+// and resumes once the hint is done.
+func TestAnalysisGivesWay(t *testing.T) {
+	cfg := defaultTestConfig()
+	cfg.Pool = play.NewEnginePool(1)
+	conn := NewConnection(t, cfg)
+
+	conn.ProcessMessage(play.MessageTypeAnalyze, play.AnalyzeRequest{})
+	conn.WaitForMessagesOfType(play.MessageTypeAnalysisInfo, 1)
+	conn.ProcessMessage(play.MessageTypeHint, nil)
+	conn.WaitForMessagesOfType(play.MessageTypeHintResponse, 1)
+
+	// The hint waits for the analysis to give way, and then the analysis waits for the hint.
+	require.Eventually(t, func() bool { return len(conn.MessagesOfType(play.MessageTypeEngineQueued)) == 4 }, time.Second, time.Millisecond, "the analysis should resume")
+	queued := []play.EngineQueuedResponse{}
+	for _, msg := range conn.MessagesOfType(play.MessageTypeEngineQueued) {
+		queued = append(queued, dataFromMessage[play.EngineQueuedResponse](t, msg))
+	}
+	require.Equal(t, []play.EngineQueuedResponse{
+		{Request: play.MessageTypeHint, Position: 1},
+		{Request: play.MessageTypeHint, Position: 0},
+		{Request: play.MessageTypeAnalyze, Position: 1},
+		{Request: play.MessageTypeAnalyze, Position: 0},
+	}, queued)
+
+	for _, info := range conn.MessagesOfType(play.MessageTypeAnalysisInfo) {
+		require.False(t, dataFromMessage[play.SearchInfoResponse](t, info).Final, "the analysis was not stopped")
+	}
+
+	conn.ProcessMessage(play.MessageTypeStopAnalysis, nil)
+	infos := conn.MessagesOfType(play.MessageTypeAnalysisInfo)
+	require.True(t, dataFromMessage[play.SearchInfoResponse](t, infos[len(infos)-1]).Final)
+	require.Equal(t, play.PoolState{Capacity: 1}, cfg.Pool.State())
+}
+
+// TestEngineDecisionQueued checks that the engine's evaluation of an offer waits for the engine pool.
+func TestEngineDecisionQueued(t *testing.T) {
+	pool := play.NewEnginePool(1)
+	_, release, err := pool.Acquire(context.Background(), "other", play.PriorityMove, nil)
+	require.NoError(t, err)
+
+	cfg := defaultTestConfig()
+	cfg.HumanPlayers = []game.Player{playerRed}
+	cfg.Pool = pool
+	conn := NewConnection(t, cfg)
+	go conn.ProcessMessage(play.MessageTypeOfferDraw, play.NegotiationRequest{Player: playerRed})
+
+	require.Eventually(t, func() bool { return len(conn.MessagesOfType(play.MessageTypeEngineQueued)) == 1 }, time.Second, time.Millisecond)
+	queued := dataFromMessage[play.EngineQueuedResponse](t, conn.MessagesOfType(play.MessageTypeEngineQueued)[0])
+	require.Equal(t, play.EngineQueuedResponse{Request: play.MessageTypeOfferDraw, Position: 1}, queued)
+	require.Empty(t, conn.MessagesOfType(play.MessageTypeGameEnded))
+
+	// The engine seats accept a draw of the starting position.
+	release()
+	require.Eventually(t, func() bool { return len(conn.MessagesOfType(play.MessageTypeGameEnded)) == 1 }, 5*time.Second, time.Millisecond)
+}
+
+// TestRoomEngineMoveNotStarved checks that the engine move of a game with human players doesn't
+// wait for the search of an engine game, however long it is.
+func TestRoomEngineMoveNotStarved(t *testing.T) {
+	pool := play.NewEnginePool(1)
+	engineGameCfg := defaultTestConfig()
+	engineGameCfg.HumanPlayers = []game.Player{}
+	engineGameCfg.Depth = ai.MaxDepth
+	engineGameCfg.EvalLimit = 0
+	engineGameCfg.Pool = pool
+	lobby := play.NewLobby(engineGameCfg)
+	room, err := lobby.StartEngineGame("")
+	require.NoError(t, err)
+	defer lobby.Shutdown()
+	require.Eventually(t, func() bool { return pool.State().Running == 1 }, time.Second, time.Millisecond)
+
+	cfg := defaultTestConfig()
+	cfg.HumanPlayers = []game.Player{playerRed, playerYellow}
+	cfg.Pool = pool
+	conn := NewConnection(t, cfg)
+	conn.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+	conn.WaitForMessagesOfType(play.MessageTypeEngineMove, 1)
+
+	// The engine game played the best move it found, and goes on.
+	require.Eventually(t, func() bool { return lobby.Rooms()[0].MoveNumber == 2 }, time.Second, time.Millisecond)
+	require.Equal(t, room.ID, lobby.Rooms()[0].RoomID)
+}
@@ -1,11 +1,6 @@
 package play
 
 import (
-	"context"
-	"fmt"
-	"log"
-	"math"
-	"runtime/debug"
 	"slices"
 	"time"
 
@@ -13,65 +8,160 @@ import (
 	g "github.com/vpoliakov01/2v2ChessAI/engine/game"
 )
 
+// spectatorMessageTypes are the messages a spectator may send. They don't change the game.
+var spectatorMessageTypes = []MessageType{
+	MessageTypeGetAvailableMoves,
+	MessageTypeSaveGame,
+	MessageTypeJoinRoom,
+	MessageTypeListRooms,
+	MessageTypeAnalyze,
+	MessageTypeStopAnalysis,
+	MessageTypeHint,
+	MessageTypeResume,
+	MessageTypeVersion,
+}
+
+// ownGameMessageTypes are the messages that replace or rewind the game. In a room shared with
+// other players, the game is only taken back by agreement (see agreeTakeback).
+var ownGameMessageTypes = []MessageType{
+	MessageTypeLoadGame,
+	MessageTypeNewGame,
+	MessageTypeSetCurrentMove,
+}
+
+// ProcessMessage handles a message of the client. A request that fails is answered with
+// an error message; the failure of a move is answered with an invalidMove message as well.
 func (c *Connection) ProcessMessage(msg *Message) {
-	log.Printf("Processing message: %v", msg)
+	logger := c.logger().With("type", msg.Type, "id", msg.ID)
+	logger.Debug("Processing message", "data", msg.Data)
+	if c.room == nil {
+		logger.Debug("Dropped message of a closed connection")
+		return
+	}
+	defer c.recoverRequest(msg)
+
+	if err := c.processMessage(msg); err != nil {
+		logger.Warn("Error processing message", "code", errorCode(err), "error", err)
+		if msg.Type == MessageTypePlayerMove {
+			c.SendMessage(MessageTypeInvalidMove, err.Error())
+		}
+		c.SendError(msg, err)
+	}
+}
+
+func (c *Connection) processMessage(msg *Message) error {
+	if c.spectator && !slices.Contains(spectatorMessageTypes, msg.Type) {
+		if msg.Type == MessageTypePlayerMove {
+			return requestErrorf(ErrorCodeForbidden, "spectators cannot move")
+		}
+		return requestErrorf(ErrorCodeForbidden, "spectators cannot send %s messages", msg.Type)
+	}
+	if slices.Contains(ownGameMessageTypes, msg.Type) && c.room.hasOtherPlayers(c) {
+		return requestErrorf(ErrorCodeForbidden, "cannot send %s messages in a room shared with other players", msg.Type)
+	}
+
 	switch msg.Type {
-	case MessageTypeSetSettings:
-		cfg, err := CastData[Config](msg.Data)
+	case MessageTypeVersion:
+		req, err := decodeData[VersionRequest](msg)
 		if err != nil {
-			log.Printf("Error casting settings: %v", err)
-			return
+			return err
 		}
-		c.processSetSettings(cfg)
+		return c.processVersion(req)
+	case MessageTypeSetSettings:
+		return c.processSetSettings(msg)
 	case MessageTypeGetAvailableMoves:
 		c.processGetAvailableMoves()
 	case MessageTypePlayerMove:
-		move, err := CastData[PGNMove](msg.Data)
+		move, err := decodeData[PGNMove](msg)
 		if err != nil {
-			log.Printf("Error casting move: %v", err)
-			return
+			return err
 		}
-		c.processPlayerMove(move)
+		return c.processPlayerMove(move)
 	case MessageTypeSaveGame:
 		c.processSaveGame()
 	case MessageTypeLoadGame:
-		c.processLoadGame(msg.Data.(string))
+		pgn, err := decodeData[string](msg)
+		if err != nil {
+			return err
+		}
+		return c.processLoadGame(pgn)
 	case MessageTypeNewGame:
 		c.processNewGame()
 	case MessageTypeSetCurrentMove:
-		c.processSetCurrentMove(int(msg.Data.(float64)))
+		moveIndex, err := decodeData[int](msg)
+		if err != nil {
+			return err
+		}
+		return c.processSetCurrentMove(moveIndex)
+	case MessageTypeJoinRoom:
+		req, err := decodeData[JoinRoomRequest](msg)
+		if err != nil {
+			return err
+		}
+		return c.processJoinRoom(req)
+	case MessageTypeListRooms:
+		c.processListRooms()
+	case MessageTypeAnalyze:
+		req, err := decodeData[AnalyzeRequest](msg)
+		if err != nil {
+			return err
+		}
+		c.processAnalyze(req)
+	case MessageTypeStopAnalysis:
+		c.stopAnalysis()
+	case MessageTypeHint:
+		c.processHint(*msg)
+	case MessageTypeResign, MessageTypeOfferDraw, MessageTypeAcceptDraw, MessageTypeDeclineDraw,
+		MessageTypeRequestTakeback, MessageTypeAcceptTakeback, MessageTypeDeclineTakeback:
+		req, err := decodeData[NegotiationRequest](msg)
+		if err != nil {
+			return err
+		}
+		return c.processNegotiation(msg.Type, req)
+	case MessageTypeResume:
+		id, err := decodeData[string](msg)
+		if err != nil {
+			return err
+		}
+		return c.processResume(id)
 	default:
-		log.Printf("Unknown message type: %s", msg.Type)
+		return requestErrorf(ErrorCodeUnknownMessage, "unknown message type %q", msg.Type)
 	}
+	return nil
 }
 
-func (c *Connection) processSetSettings(cfg Config) {
-	humanPlayersChanged := !AreHumanPlayersEqual(c.cfg.HumanPlayers, cfg.HumanPlayers)
-	if humanPlayersChanged {
-		c.stopPlayingEngineMovesIfRunning(slices.Contains(cfg.HumanPlayers, c.gs.ActivePlayer))
-		c.cfg.HumanPlayers = cfg.HumanPlayers
-	}
-
-	c.cfg = &cfg
-	c.engine.Depth = cfg.Depth
-	c.engine.Spread = cfg.Spread
-	c.engine.SpreadDrop = cfg.SpreadDrop
+// processSetSettings applies the settings of the message. The settings it leaves out keep their values.
+func (c *Connection) processSetSettings(msg *Message) error {
+	r := c.room
 
-	if cfg.EvalLimit == 0 {
-		c.engine.EvalLimit = ai.MaxEvalLimit
-	} else {
-		c.engine.EvalLimit = cfg.EvalLimit
+	humanPlayersChanged, err := r.updateSettings(c, func(cfg *Config) error {
+		if err := decodeDataOnto(msg, cfg); err != nil {
+			return err
+		}
+		if _, err := ai.ParseAlgorithm(cfg.Algorithm); err != nil {
+			return requestErrorf(ErrorCodeInvalidRequest, "%v", err)
+		}
+		if _, err := ai.ParsePruning(cfg.Pruning); err != nil {
+			return requestErrorf(ErrorCodeInvalidRequest, "%v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	if humanPlayersChanged && !slices.Contains(cfg.HumanPlayers, c.gs.ActivePlayer) {
-		c.playUntilPlayerMove()
-	} else {
-		c.processGetAvailableMoves()
+	if humanPlayersChanged {
+		r.broadcastRoomState()
+		if r.syncEngine() {
+			return nil
+		}
 	}
+	c.processGetAvailableMoves()
+	return nil
 }
 
 func (c *Connection) processGetAvailableMoves() {
-	gameMoves := c.gs.GetMoves(nil)
+	gameMoves := c.room.snapshot().GetMoves(nil)
 	moves := make([]PGNMove, len(gameMoves))
 	for i, gameMove := range gameMoves {
 		moves[i] = PGNMoveFromGameMove(gameMove)
@@ -79,175 +169,146 @@ func (c *Connection) processGetAvailableMoves() {
 	c.SendMessage(MessageTypeAvailableMoves, moves)
 }
 
-func (c *Connection) processPlayerMove(move PGNMove) {
-	c.stopPlayingEngineMovesIfRunning(true)
-	game := c.gs
+func (c *Connection) processPlayerMove(move PGNMove) error {
+	r := c.room
+	gameMove, err := g.ParseMove(string(move))
+	if err != nil {
+		return requestErrorf(ErrorCodeInvalidMove, "invalid move %q", move)
+	}
 
-	gameMove := GameMoveFromPGN(move)
-	if err := game.ValidateMove(&gameMove); err != nil {
-		c.SendMessage(MessageTypeInvalidMove, err.Error())
-		return
+	r.mutex.Lock()
+	game := r.gs
+	player := game.ActivePlayer
+	if r.seats[player] != c {
+		r.mutex.Unlock()
+		return requestErrorf(ErrorCodeInvalidMove, "it is %v's turn, and the seat is not yours", player)
 	}
 
-	game.Play(gameMove)
-	game.Board.Draw()
+	r.stopPlayingEngineMovesIfRunning(true)
+	now := time.Now()
+	if r.checkTimeLocked(now) {
+		gs := game.Copy()
+		r.mutex.Unlock()
+		r.broadcast(MessageTypeGameEnded, NewGameEndedResponse(gs))
+		return nil
+	}
+	if err := game.ValidateMove(gameMove); err != nil {
+		r.mutex.Unlock()
+		return &RequestError{Code: ErrorCodeInvalidMove, Err: err}
+	}
 
-	c.playUntilPlayerMove()
+	moveNumber := game.MoveNumber
+	game.PlayAt(*gameMove, now)
+	c.logger().Debug("Player move", "moveNumber", moveNumber, "player", player, "move", move, "fen", game.FEN())
+	r.resetClockTimerLocked()
+	clock := NewClockResponse(game, now)
+	r.mutex.Unlock()
+
+	r.moveMade()
+	r.broadcast(MessageTypeMovePlayed, MovePlayedResponse{
+		MoveNumber: moveNumber,
+		Player:     player,
+		Move:       PGNMoveFromGameMove(*gameMove),
+		Clock:      clock,
+	})
+	r.playUntilPlayerMove()
+	return nil
 }
 
 func (c *Connection) processSaveGame() {
 	c.SendMessage(MessageTypeSaveGameResponse, SaveGameResponse{
-		PGN: c.gs.PGN(),
+		PGN: c.room.snapshot().PGN(),
 	})
 }
 
-func (c *Connection) processLoadGame(data string) {
-	c.stopPlayingEngineMovesIfRunning(true)
+func (c *Connection) processLoadGame(data string) error {
+	r := c.room
 
 	game, err := g.LoadPGN(data)
 	if err != nil {
-		log.Printf("Error loading game: %v", err)
-		return
+		return &RequestError{Code: ErrorCodeInvalidGame, Err: err}
 	}
-	c.gs = game
+	r.stopPlayingEngineMovesIfRunning(true)
 
-	c.SendMessage(MessageTypeLoadGameResponse, LoadGameResponse{
-		PastMoves:   PGNMovesFromGameMoves(c.gs.PastMoves),
-		CurrentMove: c.gs.CurrentMove,
-	})
-	c.playUntilPlayerMove()
+	r.mutex.Lock()
+	if game.Clock == nil {
+		game.SetTimeControl(r.cfg.timeControl(), time.Now())
+	}
+	r.gs = game
+	r.resetClockTimerLocked()
+	r.mutex.Unlock()
+
+	r.moveMade()
+	r.broadcastGameState()
+	r.playUntilPlayerMove()
+	return nil
 }
 
 func (c *Connection) processNewGame() {
-	c.stopPlayingEngineMovesIfRunning(true)
+	r := c.room
+	r.stopPlayingEngineMovesIfRunning(true)
 
-	c.gs = g.NewGameSession()
-	c.SendMessage(MessageTypeLoadGameResponse, LoadGameResponse{
-		PastMoves:   PGNMovesFromGameMoves(c.gs.PastMoves),
-		CurrentMove: c.gs.CurrentMove,
-	})
-	c.playUntilPlayerMove()
+	r.mutex.Lock()
+	r.gs = r.newGameSessionLocked()
+	r.resetClockTimerLocked()
+	r.mutex.Unlock()
+
+	r.moveMade()
+	r.broadcastGameState()
+	r.playUntilPlayerMove()
 }
 
-func (c *Connection) processSetCurrentMove(moveIndex int) {
-	c.stopPlayingEngineMovesIfRunning(true)
+func (c *Connection) processSetCurrentMove(moveIndex int) error {
+	r := c.room
+	r.stopPlayingEngineMovesIfRunning(true)
 
-	err := c.gs.SetCurrentMove(moveIndex)
+	r.mutex.Lock()
+	err := r.gs.SetCurrentMove(moveIndex)
+	r.resetClockTimerLocked()
+	r.mutex.Unlock()
 	if err != nil {
-		log.Printf("Error setting current move: %v", err)
-		return
+		return &RequestError{Code: ErrorCodeInvalidRequest, Err: err}
 	}
-	c.SendMessage(MessageTypeLoadGameResponse, LoadGameResponse{
-		PastMoves:   PGNMovesFromGameMoves(c.gs.PastMoves),
-		CurrentMove: c.gs.CurrentMove,
-	})
-	c.processGetAvailableMoves()
+
+	r.moveMade()
+	r.broadcastGameState()
+	r.broadcastAvailableMoves()
+	return nil
 }
 
-// playUntilPlayerMove proceeds until the active player is a human player.
-func (c *Connection) playUntilPlayerMove() {
-	snapshot := c.gs.Copy()
-
-	ctx, cancel := context.WithCancel(context.Background())
-	c.engineMutex.Lock()
-	c.engineCancel = cancel
-	c.engineMutex.Unlock()
-
-	go func() {
-		defer cancel()
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("panic in playUntilPlayerMove goroutine: %v\n%s", r, debug.Stack())
-			}
-		}()
-		c.playEngineMoves(ctx, snapshot)
-
-		if ctx.Err() != nil {
-			return
-		}
+// processJoinRoom moves the connection to another room and sends it the room's game.
+func (c *Connection) processJoinRoom(req JoinRoomRequest) error {
+	if c.lobby == nil {
+		return requestErrorf(ErrorCodeInvalidRequest, "cannot join room %q: the connection has a private room", req.RoomID)
+	}
 
-		if c.gs.HasEnded() {
-			winningTeam := c.gs.Winner
-			losingKing := g.Player(0)
-			for player := range c.gs.Board.PieceSquares {
-				if !c.gs.HasKing(player) {
-					losingKing = player
-					break
-				}
-			}
-
-			c.SendMessage(MessageTypeGameEnded, GameEndedResponse{
-				King:   losingKing.String(),
-				Winner: winningTeam.String(),
-			})
-			return
-		}
+	if req.Spectate && c.lobby.Room(req.RoomID) == nil {
+		return requestErrorf(ErrorCodeNotFound, "cannot spectate room %q: the room does not exist", req.RoomID)
+	}
 
-		c.processGetAvailableMoves()
-	}()
+	c.join(req.RoomID, req.Seats, req.Spectate)
+	return nil
 }
 
-// stopPlayingEngineMovesIfRunning cancels the currently running engine-moves
-// goroutine (if any) when the active player is not a human player.
-func (c *Connection) stopPlayingEngineMovesIfRunning(condition bool) {
-	if !condition {
+// processListRooms sends the open rooms, e.g. for picking a game to watch.
+func (c *Connection) processListRooms() {
+	if c.lobby == nil {
+		c.SendMessage(MessageTypeRoomList, []RoomSummary{})
 		return
 	}
-
-	c.engineMutex.Lock()
-	cancel := c.engineCancel
-	c.engineCancel = nil
-	c.engineMutex.Unlock()
-
-	if cancel != nil {
-		cancel()
-	}
-	c.engine.Stop()
+	c.SendMessage(MessageTypeRoomList, c.lobby.Rooms())
 }
 
-// playEngineMoves plays engine moves until the active player is a human player
-// or the context is cancelled.
-func (c *Connection) playEngineMoves(ctx context.Context, game *g.GameSession) {
-	for !slices.Contains(c.cfg.HumanPlayers, game.ActivePlayer) {
-		if ctx.Err() != nil {
-			c.SendMessage(MessageTypeStoppedProcessing, nil)
-			return
-		}
-
-		c.SendMessage(MessageTypeProcessing, nil)
-		now := time.Now()
-		moveNumber := game.MoveNumber
-		continuation, score, err := c.engine.GetBestMove(game.Game)
-		if err != nil {
-			log.Printf("Error getting best move: %v", err)
-			c.SendMessage(MessageTypeStoppedProcessing, nil)
-			return
-		}
+// join joins the room and sends the connection the room's game. The engine takes over
+// or gives up the seats of the player to move as needed.
+func (c *Connection) join(roomID string, seats []g.Player, spectate bool) {
+	r := c.lobby.join(c, roomID, seats, spectate)
 
-		if ctx.Err() != nil {
-			c.SendMessage(MessageTypeStoppedProcessing, nil)
-			return
-		}
+	gs := r.snapshot()
+	c.SendMessage(MessageTypeLoadGameResponse, NewLoadGameResponse(gs))
+	r.broadcastRoomState()
 
-		bestMove := continuation[0]
-		elapsed := time.Since(now)
-
-		c.SendMessage(MessageTypeEngineMove, BestMoveResponse{
-			Continuation: PGNMovesFromGameMoves(continuation),
-			MoveNumber:   moveNumber,
-			Score:        math.Round(score*float64(game.ActivePlayer.Team())*100) / 100,
-			Time:         math.Round(elapsed.Seconds()*100) / 100,
-			Evaluations:  c.engine.EvalsCount,
-		})
-
-		game.Play(bestMove)
-		c.gs = game.Copy()
-
-		fmt.Println("Move number:", game.MoveNumber)
-		fmt.Println("Active player:", game.ActivePlayer)
-		fmt.Println("Score:", score)
-		fmt.Println("Time:", elapsed)
-		fmt.Println("Evaluations:", c.engine.EvalsCount)
-		game.Board.Draw()
+	if !r.syncEngine() {
+		c.processGetAvailableMoves()
 	}
 }
@@ -2,10 +2,12 @@ package play_test
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/vpoliakov01/2v2ChessAI/engine/ai"
 	"github.com/vpoliakov01/2v2ChessAI/engine/game"
 	"github.com/vpoliakov01/2v2ChessAI/engine/play"
 )
@@ -35,6 +37,20 @@ func TestProcessPlayerMoveValid(t *testing.T) {
 	require.NotEmpty(t, moves, "expected available moves for the next player after a valid move")
 }
 
+// With no engine seat to play, the moves of the next player are sent before ProcessMessage returns.
+func TestProcessPlayerMoveSynchronous(t *testing.T) {
+	conn := NewConnection(t, nil)
+
+	for i, move := range []play.PGNMove{"h2-h3", "b7-c7", "g13-g12", "m8-l8"} {
+		conn.ProcessMessage(play.MessageTypePlayerMove, move)
+		require.Len(t, conn.MessagesOfType(play.MessageTypeAvailableMoves), i+1, "after %v", move)
+	}
+
+	conn.ProcessMessage(play.MessageTypeLoadGame, "1. h2-h3")
+	require.Len(t, conn.MessagesOfType(play.MessageTypeLoadGameResponse), 1)
+	require.Len(t, conn.MessagesOfType(play.MessageTypeAvailableMoves), 5)
+}
+
 func TestProcessPlayerMoveInvalid(t *testing.T) {
 	conn := NewConnection(t, nil)
 
@@ -48,6 +64,39 @@ func TestProcessPlayerMoveInvalid(t *testing.T) {
 		"invalid move should not advance the game (no new availableMoves)")
 }
 
+func TestProcessErrors(t *testing.T) {
+	tests := []struct {
+		msgType play.MessageType
+		data    interface{}
+		code    play.ErrorCode
+	}{
+		{play.MessageTypeLoadGame, 42, play.ErrorCodeInvalidMessage},
+		{play.MessageTypeSetCurrentMove, "first", play.ErrorCodeInvalidMessage},
+		{play.MessageTypeSetSettings, "fast", play.ErrorCodeInvalidMessage},
+		{play.MessageTypeSetSettings, play.Config{Algorithm: "minimax"}, play.ErrorCodeInvalidRequest},
+		{play.MessageTypeSetSettings, play.Config{Pruning: "alphabeta"}, play.ErrorCodeInvalidRequest},
+		{play.MessageTypeLoadGame, `[TimeControl "5m"]`, play.ErrorCodeInvalidGame},
+		{play.MessageTypeSetCurrentMove, 99, play.ErrorCodeInvalidRequest},
+		{play.MessageTypePlayerMove, "zz", play.ErrorCodeInvalidMove},
+		{play.MessageTypeResign, play.NegotiationRequest{Player: 7}, play.ErrorCodeInvalidMessage},
+		{"bogus", nil, play.ErrorCodeUnknownMessage},
+	}
+
+	for i, test := range tests {
+		conn := NewConnection(t, nil)
+		id := fmt.Sprint(i)
+
+		conn.Connection.ProcessMessage(&play.Message{Type: test.msgType, ID: id, Data: test.data})
+
+		msg := requireSingleMessage(t, conn, play.MessageTypeError)
+		require.Equal(t, id, msg.Parsed.ID, "the error carries the request's ID")
+		resp := dataFromMessage[play.ErrorResponse](t, msg)
+		require.Equal(t, test.code, resp.Code, "%s %v", test.msgType, test.data)
+		require.Equal(t, test.msgType, resp.Request)
+		require.NotEmpty(t, resp.Error)
+	}
+}
+
 func TestProcessSaveGame(t *testing.T) {
 	conn := NewConnection(t, nil)
 
@@ -178,3 +227,239 @@ func TestProcessSetSettingsSameHumanPlayers(t *testing.T) {
 		availableMovesFromMessage(t, requireSingleMessage(t, conn, play.MessageTypeAvailableMoves)),
 		"setSettings should trigger a fresh availableMoves response")
 }
+
+func TestProcessEngineMoveSearchInfo(t *testing.T) {
+	cfg := defaultTestConfig()
+	cfg.Depth = 3
+	cfg.EvalLimit = 0
+	cfg.HumanPlayers = []game.Player{playerRed, playerYellow, playerGreen}
+	conn := NewConnection(t, cfg)
+
+	conn.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+
+	engineMove := dataFromMessage[play.BestMoveResponse](t, conn.WaitForMessagesOfType(play.MessageTypeEngineMove, 1)[0])
+
+	infos := conn.MessagesOfType(play.MessageTypeSearchInfo)
+	require.NotEmpty(t, infos, "the engine search should be reported before the engine move")
+	info := dataFromMessage[play.SearchInfoResponse](t, infos[len(infos)-1])
+
+	require.True(t, info.Final, "the last report should be final")
+	require.Equal(t, engineMove.MoveNumber, info.MoveNumber)
+	require.Equal(t, engineMove.Continuation, info.Continuation)
+	require.Equal(t, engineMove.Score, info.Score)
+	require.Equal(t, 3, info.Depth)
+}
+
+func TestProcessEngineMoveMultiPV(t *testing.T) {
+	cfg := defaultTestConfig()
+	cfg.Depth = 2
+	cfg.EvalLimit = 0
+	cfg.MultiPV = 3
+	cfg.HumanPlayers = []game.Player{playerRed, playerYellow, playerGreen}
+	conn := NewConnection(t, cfg)
+
+	conn.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+
+	engineMove := dataFromMessage[play.BestMoveResponse](t, conn.WaitForMessagesOfType(play.MessageTypeEngineMove, 1)[0])
+
+	require.Len(t, engineMove.Lines, 3)
+	require.Equal(t, engineMove.Continuation, engineMove.Lines[0].Continuation)
+	require.Equal(t, engineMove.Score, engineMove.Lines[0].Score)
+}
+
+func TestProcessAnalyze(t *testing.T) {
+	conn := NewConnection(t, nil)
+
+	conn.ProcessMessage(play.MessageTypeAnalyze, play.AnalyzeRequest{Depth: 2, MultiPV: 2})
+
+	infos := conn.WaitForMessagesOfType(play.MessageTypeAnalysisInfo, 1)
+	for !dataFromMessage[play.SearchInfoResponse](t, infos[0]).Final {
+		infos = conn.WaitForMessagesOfType(play.MessageTypeAnalysisInfo, 1)
+	}
+	info := dataFromMessage[play.SearchInfoResponse](t, infos[0])
+	require.Equal(t, 2, info.Depth)
+	require.Len(t, info.Lines, 2)
+
+	conn.ProcessMessage(play.MessageTypeSaveGame, nil)
+	resp := dataFromMessage[play.SaveGameResponse](t, requireSingleMessage(t, conn, play.MessageTypeSaveGameResponse))
+	require.Empty(t, resp.PGN, "the analysis must not play the move")
+	require.Empty(t, conn.MessagesOfType(play.MessageTypeEngineMove))
+}
+
+func TestProcessAnalyzeStops(t *testing.T) {
+	conn := NewConnection(t, nil)
+
+	// An analysis without limits runs until it is stopped.
+	conn.ProcessMessage(play.MessageTypeAnalyze, play.AnalyzeRequest{})
+	conn.ProcessMessage(play.MessageTypeStopAnalysis, nil)
+
+	infos := conn.MessagesOfType(play.MessageTypeAnalysisInfo)
+	require.NotEmpty(t, infos)
+	require.True(t, dataFromMessage[play.SearchInfoResponse](t, infos[len(infos)-1]).Final)
+
+	// Making a move stops the analysis of the previous position.
+	conn.ProcessMessage(play.MessageTypeAnalyze, play.AnalyzeRequest{})
+	conn.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+
+	infos = conn.MessagesOfType(play.MessageTypeAnalysisInfo)
+	last := dataFromMessage[play.SearchInfoResponse](t, infos[len(infos)-1])
+	require.True(t, last.Final)
+	require.Equal(t, 1, last.MoveNumber)
+}
+
+func TestProcessHint(t *testing.T) {
+	conn := NewConnection(t, nil)
+
+	conn.ProcessMessage(play.MessageTypeHint, nil)
+
+	hint := dataFromMessage[play.HintResponse](t, conn.WaitForMessagesOfType(play.MessageTypeHintResponse, 1)[0])
+	require.Equal(t, 1, hint.MoveNumber)
+
+	g := game.New()
+	move := play.GameMoveFromPGN(hint.Move)
+	require.NoError(t, g.ValidateMove(&move))
+	require.Empty(t, conn.MessagesOfType(play.MessageTypeMovePlayed), "a hint must not play the move")
+}
+
+func TestProcessHintCancelledByMove(t *testing.T) {
+	cfg := defaultTestConfig()
+	cfg.Depth, cfg.EvalLimit = ai.MaxDepth, 0 // Searches until cancelled.
+	conn := NewConnection(t, cfg)
+
+	conn.ProcessMessage(play.MessageTypeHint, nil)
+	conn.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+
+	resp := dataFromMessage[play.ErrorResponse](t, conn.WaitForMessagesOfType(play.MessageTypeError, 1)[0])
+	require.Equal(t, play.MessageTypeHint, resp.Request)
+	require.Contains(t, resp.Error, "the position changed")
+	require.Empty(t, conn.MessagesOfType(play.MessageTypeHintResponse))
+}
+
+// finalSearchInfos returns the final searchInfo of every engine move so far.
+func finalSearchInfos(t *testing.T, conn *testConnection) []play.SearchInfoResponse {
+	t.Helper()
+	finals := []play.SearchInfoResponse{}
+	for _, msg := range conn.MessagesOfType(play.MessageTypeSearchInfo) {
+		if info := dataFromMessage[play.SearchInfoResponse](t, msg); info.Final {
+			finals = append(finals, info)
+		}
+	}
+	return finals
+}
+
+func TestProcessSetSettingsDoesNotShareConfig(t *testing.T) {
+	cfg := defaultTestConfig()
+	conn := NewConnection(t, cfg)
+
+	updated := *defaultTestConfig()
+	updated.Depth = 2
+	updated.HumanPlayers = []game.Player{playerRed}
+	conn.ProcessMessage(play.MessageTypeSetSettings, updated)
+
+	require.Equal(t, defaultTestConfig(), cfg, "the settings of a connection must not leak into the config it was created with")
+
+	lobby := play.NewLobby(defaultTestConfig())
+	first := ConnectToLobby(t, lobby, "first", playerRed)
+	second := ConnectToLobby(t, lobby, "second", playerRed)
+
+	first.ProcessMessage(play.MessageTypeSetSettings, play.Config{Depth: 2, HumanPlayers: []game.Player{playerRed}})
+	for _, conn := range []*testConnection{first, second} {
+		conn.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+		conn.WaitForMessagesOfType(play.MessageTypeAvailableMoves, 2)
+	}
+
+	for _, info := range finalSearchInfos(t, first) {
+		require.Equal(t, 2, info.Depth)
+	}
+	for _, info := range finalSearchInfos(t, second) {
+		require.Equal(t, 1, info.Depth, "the settings of a room must not leak into other rooms")
+	}
+}
+
+// The settings a message leaves out keep their values: the UI sends only the engine settings and
+// the seats, while the time control comes from the server's flags.
+func TestProcessSetSettingsPartial(t *testing.T) {
+	cfg := defaultTestConfig()
+	cfg.TimeControl = "60+1"
+	cfg.HumanPlayers = []game.Player{playerRed}
+	conn := NewConnection(t, cfg)
+
+	conn.ProcessMessage(play.MessageTypeSetSettings, map[string]interface{}{"depth": 2, "evalLimit": 0, "multiPV": 2})
+	require.Empty(t, conn.MessagesOfType(play.MessageTypeError))
+	conn.ProcessMessage(play.MessageTypeNewGame, nil)
+
+	newGame := dataFromMessage[play.LoadGameResponse](t, requireSingleMessage(t, conn, play.MessageTypeLoadGameResponse))
+	require.NotNil(t, newGame.Clock, "the time control is kept")
+	require.Equal(t, "60+1", newGame.Clock.TimeControl)
+
+	conn.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+	require.Len(t, conn.MessagesOfType(play.MessageTypeMovePlayed), 1, "the seats are kept")
+	conn.WaitForMessagesOfType(play.MessageTypeEngineMove, 1)
+	for _, info := range finalSearchInfos(t, conn) {
+		require.Equal(t, 2, info.Depth)
+		require.Len(t, info.Lines, 2)
+	}
+}
+
+// The engine settings take effect from the next engine move on, and the search in flight
+// completes with the settings it started with.
+func TestProcessSetSettingsMidSearch(t *testing.T) {
+	cfg := defaultTestConfig()
+	cfg.Depth = 4
+	cfg.EvalLimit = 0
+	cfg.HumanPlayers = []game.Player{playerRed}
+	conn := NewConnection(t, cfg)
+
+	conn.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+	conn.WaitForMessagesOfType(play.MessageTypeProcessing, 1)
+
+	updated := *cfg
+	updated.Depth = 1
+	conn.ProcessMessage(play.MessageTypeSetSettings, updated)
+
+	// The engine plays for Blue, Yellow and Green.
+	for len(finalSearchInfos(t, conn)) < 3 {
+		conn.WaitForMessagesOfType(play.MessageTypeEngineMove, 1)
+	}
+	finals := finalSearchInfos(t, conn)
+	require.Equal(t, 4, finals[0].Depth, "the search in flight keeps its settings")
+	require.Equal(t, 1, finals[2].Depth, "the next searches use the new settings")
+}
+
+// Run with -race: settings changes of several participants race with the engine.
+func TestProcessSetSettingsConcurrent(t *testing.T) {
+	cfg := defaultTestConfig()
+	cfg.HumanPlayers = []game.Player{}
+	lobby := play.NewLobby(cfg)
+	redYellow := ConnectToLobby(t, lobby, "room")
+	blueGreen := ConnectToLobby(t, lobby, "room")
+
+	var wg sync.WaitGroup
+	for i, conn := range []*testConnection{redYellow, blueGreen} {
+		seats := []game.Player{game.Player(i), game.Player(i + 2)}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 20 {
+				settings := *cfg
+				settings.Depth = 1 + j%2
+				settings.MultiPV = 1 + j%3
+				if j%2 == 1 {
+					settings.HumanPlayers = seats
+				}
+				conn.ProcessMessage(play.MessageTypeSetSettings, settings)
+				// Keep the message buffers from filling up.
+				for len(conn.NewMessageCh) > 0 {
+					<-conn.NewMessageCh
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Both ended up claiming their seats.
+	rooms := lobby.Rooms()
+	require.Len(t, rooms, 1)
+	require.Equal(t, []game.Player{playerRed, playerBlue, playerYellow, playerGreen}, rooms[0].HumanPlayers)
+	require.NoError(t, lobby.CloseRoom("room"))
+}
@@ -0,0 +1,221 @@
+package play
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ProtocolVersion is the version of the websocket protocol: its message types and their data.
+// Bump it with every change of them; TestProtocolSchema fails otherwise.
+const ProtocolVersion = 3
+
+// MessageDirection tells which side sends a message type.
+type MessageDirection string
+
+const (
+	DirectionClient MessageDirection = "client"
+	DirectionServer MessageDirection = "server"
+)
+
+// messageSpec describes a message type: who sends it, and a value of its data's type
+// (nil if the message has no data).
+type messageSpec struct {
+	direction MessageDirection
+	data      interface{}
+}
+
+// messageSpecs describe every message type of the protocol.
+var messageSpecs = map[MessageType]messageSpec{
+	MessageTypeVersion:             {DirectionClient, VersionRequest{}},
+	MessageTypeVersionResponse:     {DirectionServer, VersionResponse{}},
+	MessageTypeSetSettings:         {DirectionClient, Config{}},
+	MessageTypeSetSettingsResponse: {DirectionServer, Config{}},
+	MessageTypeGetAvailableMoves:   {DirectionClient, nil},
+	MessageTypeAvailableMoves:      {DirectionServer, []PGNMove{}},
+	MessageTypePlayerMove:          {DirectionClient, PGNMove("")},
+	MessageTypeEngineMove:          {DirectionServer, BestMoveResponse{}},
+	MessageTypeInvalidMove:         {DirectionServer, ""},
+	MessageTypeSaveGame:            {DirectionClient, nil},
+	MessageTypeSaveGameResponse:    {DirectionServer, SaveGameResponse{}},
+	MessageTypeLoadGame:            {DirectionClient, ""}, // PGN.
+	MessageTypeLoadGameResponse:    {DirectionServer, LoadGameResponse{}},
+	MessageTypeNewGame:             {DirectionClient, nil},
+	MessageTypeSetCurrentMove:      {DirectionClient, 0}, // Index of the move, -1 for the start.
+	MessageTypeGameEnded:           {DirectionServer, GameEndedResponse{}},
+	MessageTypeProcessing:          {DirectionServer, nil},
+	MessageTypeStoppedProcessing:   {DirectionServer, nil},
+	MessageTypeSearchInfo:          {DirectionServer, SearchInfoResponse{}},
+	MessageTypeMovePlayed:          {DirectionServer, MovePlayedResponse{}},
+	MessageTypeJoinRoom:            {DirectionClient, JoinRoomRequest{}},
+	MessageTypeRoomState:           {DirectionServer, RoomStateResponse{}},
+	MessageTypeListRooms:           {DirectionClient, nil},
+	MessageTypeRoomList:            {DirectionServer, []RoomSummary{}},
+	MessageTypeAnalyze:             {DirectionClient, AnalyzeRequest{}},
+	MessageTypeStopAnalysis:        {DirectionClient, nil},
+	MessageTypeAnalysisInfo:        {DirectionServer, SearchInfoResponse{}},
+	MessageTypeHint:                {DirectionClient, nil},
+	MessageTypeHintResponse:        {DirectionServer, HintResponse{}},
+	MessageTypeSession:             {DirectionServer, SessionResponse{}},
+	MessageTypeResume:              {DirectionClient, ""}, // Session ID.
+	MessageTypeResign:              {DirectionClient, NegotiationRequest{}},
+	MessageTypeOfferDraw:           {DirectionClient, NegotiationRequest{}},
+	MessageTypeAcceptDraw:          {DirectionClient, NegotiationRequest{}},
+	MessageTypeDeclineDraw:         {DirectionClient, NegotiationRequest{}},
+	MessageTypeDrawOffer:           {DirectionServer, NegotiationResponse{}},
+	MessageTypeDrawDeclined:        {DirectionServer, NegotiationResponse{}},
+	MessageTypeRequestTakeback:     {DirectionClient, NegotiationRequest{}},
+	MessageTypeAcceptTakeback:      {DirectionClient, NegotiationRequest{}},
+	MessageTypeDeclineTakeback:     {DirectionClient, NegotiationRequest{}},
+	MessageTypeTakebackRequest:     {DirectionServer, NegotiationResponse{}},
+	MessageTypeTakebackDeclined:    {DirectionServer, NegotiationResponse{}},
+	MessageTypeEngineQueued:        {DirectionServer, EngineQueuedResponse{}},
+	MessageTypeError:               {DirectionServer, ErrorResponse{}},
+}
+
+// processVersion answers the client's handshake with the server's protocol version.
+// A client of another version is told so with an error as well.
+func (c *Connection) processVersion(req VersionRequest) error {
+	compatible := req.ProtocolVersion == ProtocolVersion
+	c.SendMessage(MessageTypeVersionResponse, VersionResponse{ProtocolVersion: ProtocolVersion, Compatible: compatible})
+	if !compatible {
+		return requestErrorf(ErrorCodeIncompatibleVersion, "protocol version %v is not supported, the server speaks %v",
+			req.ProtocolVersion, ProtocolVersion)
+	}
+	return nil
+}
+
+// MessageTypes returns the message types of the protocol, sorted.
+func MessageTypes() []MessageType {
+	types := make([]MessageType, 0, len(messageSpecs))
+	for messageType := range messageSpecs {
+		types = append(types, messageType)
+	}
+	slices.Sort(types)
+	return types
+}
+
+// ProtocolSchema returns a JSON Schema of the websocket messages, generated from their Go types.
+// It validates any message; each message type is described by one of its oneOf branches,
+// annotated with its direction. The "version" keyword is the ProtocolVersion.
+func ProtocolSchema() ([]byte, error) {
+	sg := schemaGenerator{defs: map[string]interface{}{}}
+
+	messages := []interface{}{}
+	for _, messageType := range MessageTypes() {
+		spec := messageSpecs[messageType]
+
+		data := map[string]interface{}{"type": "null"}
+		if spec.data != nil {
+			data = sg.schema(reflect.TypeOf(spec.data))
+		}
+
+		messages = append(messages, map[string]interface{}{
+			"title":     string(messageType),
+			"direction": spec.direction,
+			"type":      "object",
+			"properties": map[string]interface{}{
+				"type": map[string]interface{}{"const": messageType},
+				"id":   map[string]interface{}{"type": "string"},
+				"data": data,
+			},
+			"required": []string{"type"},
+		})
+	}
+
+	return json.MarshalIndent(map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   "2v2ChessAI websocket protocol",
+		"version": ProtocolVersion,
+		"oneOf":   messages,
+		"$defs":   sg.defs,
+	}, "", "  ")
+}
+
+// schemaGenerator generates the JSON Schemas of Go types as encoding/json encodes them.
+// Named structs are defined once in defs and referenced.
+type schemaGenerator struct {
+	defs map[string]interface{}
+}
+
+func (sg *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return map[string]interface{}{"anyOf": []interface{}{sg.schema(t.Elem()), map[string]interface{}{"type": "null"}}}
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": sg.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": sg.schema(t.Elem())}
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		if t.Name() == "" {
+			return sg.structSchema(t)
+		}
+		if _, ok := sg.defs[t.Name()]; !ok {
+			sg.defs[t.Name()] = nil // Defined while it is being generated, in case it refers to itself.
+			sg.defs[t.Name()] = sg.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	default:
+		panic("unsupported message data type " + t.String())
+	}
+}
+
+func (sg *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	sg.addFields(t, properties, &required)
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+// addFields adds the fields of the struct type to the properties, flattening the embedded
+// structs, and the ones without omitempty to required.
+func (sg *schemaGenerator) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				sg.addFields(embedded, properties, required)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = sg.schema(field.Type)
+		if !slices.Contains(strings.Split(options, ","), "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
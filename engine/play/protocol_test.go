@@ -0,0 +1,80 @@
+package play_test
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/play"
+)
+
+var updateSchema = flag.Bool("update-schema", false, "write the schema of a new protocol version to testdata")
+
+// wsTSFile mirrors the message types in the UI.
+const wsTSFile = "../../ui/src/utils/ws.ts"
+
+// TestProtocolSchema fails when the messages change without a bump of play.ProtocolVersion.
+// The schema of every version is kept in testdata; run with -update-schema after the bump
+// to record the new version's.
+func TestProtocolSchema(t *testing.T) {
+	schema, err := play.ProtocolSchema()
+	require.NoError(t, err)
+	require.True(t, json.Valid(schema))
+
+	golden := filepath.Join("testdata", "protocol", fmt.Sprintf("v%v.json", play.ProtocolVersion))
+	expected, err := os.ReadFile(golden)
+	if os.IsNotExist(err) && *updateSchema {
+		require.NoError(t, os.MkdirAll(filepath.Dir(golden), 0o755))
+		require.NoError(t, os.WriteFile(golden, append(schema, '\n'), 0o644))
+		return
+	}
+	require.NoError(t, err, "no schema of protocol version %v: run the test with -update-schema", play.ProtocolVersion)
+
+	require.JSONEq(t, string(expected), string(schema),
+		"the websocket messages changed: bump play.ProtocolVersion and run the test with -update-schema")
+}
+
+// TestProtocolUI fails when the message types or protocol version of the UI drift from the server's.
+func TestProtocolUI(t *testing.T) {
+	ts, err := os.ReadFile(wsTSFile)
+	if os.IsNotExist(err) {
+		t.Skip("the UI is not checked out")
+	}
+	require.NoError(t, err)
+
+	enum := regexp.MustCompile(`(?s)export enum MessageType \{(.*?)\}`).FindSubmatch(ts)
+	require.NotNil(t, enum, "no MessageType enum in %v", wsTSFile)
+
+	uiTypes := []play.MessageType{}
+	for _, match := range regexp.MustCompile(`\w+ = '(\w+)'`).FindAllSubmatch(enum[1], -1) {
+		uiTypes = append(uiTypes, play.MessageType(match[1]))
+	}
+	slices.Sort(uiTypes)
+	require.Equal(t, play.MessageTypes(), uiTypes)
+
+	version := regexp.MustCompile(`PROTOCOL_VERSION = (\d+)`).FindSubmatch(ts)
+	require.NotNil(t, version, "no PROTOCOL_VERSION in %v", wsTSFile)
+	require.Equal(t, fmt.Sprint(play.ProtocolVersion), string(version[1]))
+}
+
+func TestVersionHandshake(t *testing.T) {
+	conn := NewConnection(t, nil)
+
+	conn.ProcessMessage(play.MessageTypeVersion, play.VersionRequest{ProtocolVersion: play.ProtocolVersion})
+	resp := dataFromMessage[play.VersionResponse](t, requireOnlyMessage(t, conn, play.MessageTypeVersionResponse))
+	require.Equal(t, play.VersionResponse{ProtocolVersion: play.ProtocolVersion, Compatible: true}, resp)
+
+	conn = NewConnection(t, nil)
+	conn.ProcessMessage(play.MessageTypeVersion, play.VersionRequest{ProtocolVersion: play.ProtocolVersion + 1})
+	resp = dataFromMessage[play.VersionResponse](t, requireSingleMessage(t, conn, play.MessageTypeVersionResponse))
+	require.False(t, resp.Compatible)
+	errResp := dataFromMessage[play.ErrorResponse](t, requireSingleMessage(t, conn, play.MessageTypeError))
+	require.Equal(t, play.ErrorCodeIncompatibleVersion, errResp.Code)
+}
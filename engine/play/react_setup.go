@@ -2,7 +2,7 @@ package play
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -10,7 +10,8 @@ import (
 	"time"
 )
 
-func openBrowser(url string) error {
+// OpenBrowser opens the URL in the default browser.
+func OpenBrowser(url string) error {
 	var cmd *exec.Cmd
 	switch runtime.GOOS {
 	case "darwin":
@@ -54,8 +55,8 @@ func StartReactApp(projectRoot string) error {
 	time.Sleep(3 * time.Second)
 
 	// Open the browser
-	if err := openBrowser("http://localhost:3000"); err != nil {
-		log.Printf("Failed to open browser: %v", err)
+	if err := OpenBrowser("http://localhost:3000"); err != nil {
+		slog.Warn("Failed to open browser", "error", err)
 	}
 
 	// Don't wait for the process to finish - let it run in background
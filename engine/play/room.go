@@ -0,0 +1,525 @@
+package play
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/ai"
+	g "github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+// Room is a game shared by its participants. Every participant claims some of the seats,
+// and the engine plays the unclaimed ones. State changes are broadcast to all participants.
+type Room struct {
+	ID string
+
+	mutex        sync.Mutex // Guards the fields below.
+	cfg          Config     // cfg.HumanPlayers mirrors the claimed seats.
+	gs           *g.GameSession
+	seats        map[g.Player]*Connection // Seat owners; unclaimed seats are missing.
+	participants []*Connection
+	engine       *ai.AI              // Replaced rather than reconfigured, so that a search in flight keeps its settings.
+	searchInfo   *SearchInfoResponse // Last progress report of the engine's current search.
+	clockTimer   *time.Timer         // Fires when the active player's time runs out; nil for untimed games.
+	draw         negotiation         // Seats that agreed to a draw.
+	takeback     negotiation         // Seats that agreed to take back the last move.
+
+	engineGame bool // Started by the server: the engine plays all the seats, and the room stays open without participants.
+
+	engineCancel context.CancelFunc
+	engineDone   chan struct{} // Identifies the running engine goroutine; nil while idle or stopping.
+	engineMutex  sync.Mutex
+	engines      sync.WaitGroup // The engine goroutines, including the stopping ones.
+}
+
+// newRoom creates a room with a new game set up according to cfg.
+func newRoom(id string, cfg Config) *Room {
+	cfg.HumanPlayers = []g.Player{}
+
+	r := &Room{
+		ID:    id,
+		cfg:   cfg,
+		gs:    g.SetupBoard(cfg.Load),
+		seats: map[g.Player]*Connection{},
+	}
+	r.engine = r.newEngine(cfg)
+	if r.gs.Clock == nil {
+		r.gs.SetTimeControl(cfg.timeControl(), time.Now())
+	}
+	r.resetClockTimerLocked()
+
+	return r
+}
+
+// newEngine creates an engine configured by cfg that reports its progress to the room.
+func (r *Room) newEngine(cfg Config) *ai.AI {
+	return ai.New(cfg.Depth, cfg.Spread, cfg.SpreadDrop, cfg.EvalLimit,
+		cfg.engineOptions(ai.WithProgress(searchInfoInterval, r.broadcastSearchInfo))...)
+}
+
+// updateSettings applies the settings sent by c, and c's claims of cfg.HumanPlayers. The settings are
+// changed by update on a copy of the room's ones; if it fails, they are left as they are.
+//
+// The seats take effect immediately (see syncEngine), while the engine settings take effect
+// from the next engine move on: a search in flight completes with the settings it started with.
+// The time control takes effect from the next game on, or immediately if no move has been played.
+func (r *Room) updateSettings(c *Connection, update func(cfg *Config) error) (humanPlayersChanged bool, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	previous := r.cfg
+	cfg := previous.clone()
+	if err := update(&cfg); err != nil {
+		return false, err
+	}
+
+	r.claimSeatsLocked(c, cfg.HumanPlayers)
+	cfg.HumanPlayers = r.cfg.HumanPlayers
+	cfg.Metrics, cfg.Pool = previous.Metrics, previous.Pool
+	r.cfg = cfg
+
+	if cfg.engineChanged(previous) {
+		r.engine = r.newEngine(cfg)
+	}
+
+	if cfg.TimeControl != previous.TimeControl && len(r.gs.PastMoves) == 0 {
+		r.gs.SetTimeControl(cfg.timeControl(), time.Now())
+		r.resetClockTimerLocked()
+	}
+
+	return !AreHumanPlayersEqual(previous.HumanPlayers, cfg.HumanPlayers), nil
+}
+
+// settings returns a copy of the room's config.
+func (r *Room) settings() Config {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.cfg.clone()
+}
+
+// addParticipant adds c to the room, claiming the requested seats that are free.
+func (r *Room) addParticipant(c *Connection, seats []g.Player) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.participants = append(r.participants, c)
+	r.claimSeatsLocked(c, seats)
+}
+
+// replaceParticipant makes c take the place of old, including its seats.
+func (r *Room) replaceParticipant(old, c *Connection) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if i := slices.Index(r.participants, old); i >= 0 {
+		r.participants[i] = c
+	}
+	for player, owner := range r.seats {
+		if owner == old {
+			r.seats[player] = c
+		}
+	}
+}
+
+// removeParticipant removes c and frees its seats. Returns whether the room is empty.
+func (r *Room) removeParticipant(c *Connection) (empty bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.participants = slices.DeleteFunc(r.participants, func(p *Connection) bool { return p == c })
+	r.claimSeatsLocked(c, nil)
+
+	return len(r.participants) == 0
+}
+
+// claimSeatsLocked makes the free seats among the given ones c's only seats.
+// Seats claimed by other participants are left to them. r.mutex must be held.
+func (r *Room) claimSeatsLocked(c *Connection, seats []g.Player) {
+	for player, owner := range r.seats {
+		if owner == c {
+			delete(r.seats, player)
+		}
+	}
+
+	for _, player := range seats {
+		if player < 0 || player > 3 || r.engineGame {
+			continue
+		}
+		if _, claimed := r.seats[player]; !claimed {
+			r.seats[player] = c
+		}
+	}
+
+	r.cfg.HumanPlayers = r.humanPlayersLocked()
+}
+
+// humanPlayersLocked returns the claimed seats in order. r.mutex must be held.
+func (r *Room) humanPlayersLocked() []g.Player {
+	players := []g.Player{}
+	for player := g.Player(0); player < 4; player++ {
+		if _, claimed := r.seats[player]; claimed {
+			players = append(players, player)
+		}
+	}
+	return players
+}
+
+// isHuman returns whether a participant claimed the player's seat.
+func (r *Room) isHuman(player g.Player) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	_, claimed := r.seats[player]
+	return claimed
+}
+
+// hasOtherPlayers returns whether a participant other than c plays in the room, spectators aside.
+func (r *Room) hasOtherPlayers(c *Connection) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return slices.ContainsFunc(r.participants, func(p *Connection) bool { return p != c && !p.spectator })
+}
+
+// snapshot returns a copy of the room's game.
+func (r *Room) snapshot() *g.GameSession {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.gs.Copy()
+}
+
+// broadcast sends the message to all participants.
+func (r *Room) broadcast(messageType MessageType, data interface{}) {
+	r.mutex.Lock()
+	participants := slices.Clone(r.participants)
+	r.mutex.Unlock()
+
+	for _, c := range participants {
+		c.SendMessage(messageType, data)
+	}
+}
+
+// broadcastAvailableMoves sends the moves of the active player to all participants.
+func (r *Room) broadcastAvailableMoves() {
+	gs := r.snapshot()
+	r.broadcast(MessageTypeAvailableMoves, PGNMovesFromGameMoves(gs.GetMoves(nil)))
+}
+
+// broadcastGameState sends the moves of the game to all participants.
+func (r *Room) broadcastGameState() {
+	gs := r.snapshot()
+	r.broadcast(MessageTypeLoadGameResponse, NewLoadGameResponse(gs))
+}
+
+// broadcastRoomState sends every participant the seats and which of them are theirs.
+func (r *Room) broadcastRoomState() {
+	r.mutex.Lock()
+	participants := slices.Clone(r.participants)
+	responses := make([]RoomStateResponse, len(participants))
+	for i, c := range participants {
+		responses[i] = r.roomStateLocked(c)
+	}
+	r.mutex.Unlock()
+
+	for i, c := range participants {
+		c.SendMessage(MessageTypeRoomState, responses[i])
+	}
+}
+
+// roomStateLocked describes the room as seen by c. r.mutex must be held.
+func (r *Room) roomStateLocked(c *Connection) RoomStateResponse {
+	resp := RoomStateResponse{
+		RoomID:       r.ID,
+		Participants: len(r.participants),
+		Spectators:   r.spectatorsLocked(),
+		Spectating:   c.spectator,
+		EngineGame:   r.engineGame,
+		Seats:        make([]SeatState, 4),
+	}
+	for player := g.Player(0); player < 4; player++ {
+		owner, claimed := r.seats[player]
+		resp.Seats[player] = SeatState{Player: player, Claimed: claimed, Yours: claimed && owner == c}
+	}
+	return resp
+}
+
+// spectatorsLocked returns the number of spectators. r.mutex must be held.
+func (r *Room) spectatorsLocked() int {
+	spectators := 0
+	for _, c := range r.participants {
+		if c.spectator {
+			spectators++
+		}
+	}
+	return spectators
+}
+
+// summary describes the room for the list of rooms.
+func (r *Room) summary() RoomSummary {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return RoomSummary{
+		RoomID:       r.ID,
+		Participants: len(r.participants),
+		Spectators:   r.spectatorsLocked(),
+		HumanPlayers: r.humanPlayersLocked(),
+		MoveNumber:   r.gs.MoveNumber,
+		EngineGame:   r.engineGame,
+		Ended:        r.gs.HasEnded(),
+	}
+}
+
+// broadcastSearchInfo forwards the engine's search progress to all participants.
+func (r *Room) broadcastSearchInfo(info ai.SearchInfo) {
+	resp := NewSearchInfoResponse(info)
+
+	r.mutex.Lock()
+	r.searchInfo = &resp
+	r.mutex.Unlock()
+
+	r.broadcast(MessageTypeSearchInfo, resp)
+}
+
+// engineSearch returns whether the engine is playing, and the last progress report of its search.
+func (r *Room) engineSearch() (running bool, info *SearchInfoResponse) {
+	r.engineMutex.Lock()
+	running = r.engineDone != nil
+	r.engineMutex.Unlock()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return running, r.searchInfo
+}
+
+// moveMade stops the analyses and the hints of the previous position.
+func (r *Room) moveMade() {
+	r.mutex.Lock()
+	participants := slices.Clone(r.participants)
+	r.mutex.Unlock()
+
+	for _, c := range participants {
+		c.stopAnalysis()
+		c.stopHints()
+	}
+}
+
+// syncEngine starts the engine if it is to move and idle, and stops it if a human is to move,
+// e.g. after the seats changed. Returns whether the engine is to move.
+func (r *Room) syncEngine() (engineTurn bool) {
+	r.mutex.Lock()
+	_, claimed := r.seats[r.gs.ActivePlayer]
+	engineTurn = !claimed && !r.gs.HasEnded()
+	r.mutex.Unlock()
+
+	if !engineTurn {
+		r.stopPlayingEngineMovesIfRunning(true)
+		return false
+	}
+
+	r.engineMutex.Lock()
+	running := r.engineDone != nil
+	r.engineMutex.Unlock()
+
+	if !running {
+		r.playUntilPlayerMove()
+	}
+	return true
+}
+
+// playUntilPlayerMove proceeds until the active player is a human player.
+func (r *Room) playUntilPlayerMove() {
+	snapshot := r.snapshot()
+
+	// Nothing for the engine to play, so answer synchronously.
+	if !snapshot.HasEnded() && r.isHuman(snapshot.ActivePlayer) {
+		r.broadcastAvailableMoves()
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	r.engineMutex.Lock()
+	r.engineCancel = cancel
+	r.engineDone = done
+	r.engineMutex.Unlock()
+
+	r.engines.Add(1)
+	go func() {
+		defer r.engines.Done()
+		defer func() {
+			r.engineMutex.Lock()
+			if r.engineDone == done {
+				r.engineCancel, r.engineDone = nil, nil
+			}
+			r.engineMutex.Unlock()
+			cancel()
+		}()
+		defer func() {
+			if rec := recover(); rec != nil {
+				r.logger().Error("Panic playing engine moves", "panic", rec, "stack", string(debug.Stack()))
+			}
+		}()
+		r.playEngineMoves(ctx, snapshot)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		gs := r.snapshot()
+		if gs.HasEnded() {
+			r.broadcast(MessageTypeGameEnded, NewGameEndedResponse(gs))
+			return
+		}
+
+		r.broadcastAvailableMoves()
+	}()
+}
+
+// close stops the engine and the clocks of a room that is no longer used.
+func (r *Room) close() {
+	r.stopPlayingEngineMovesIfRunning(true)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.clockTimer != nil {
+		r.clockTimer.Stop()
+		r.clockTimer = nil
+	}
+}
+
+// shutdown closes the room, and waits until its engine stopped.
+func (r *Room) shutdown() {
+	r.close()
+	r.engines.Wait()
+}
+
+// stopPlayingEngineMovesIfRunning cancels the currently running engine-moves
+// goroutine (if any) when the active player is not a human player.
+func (r *Room) stopPlayingEngineMovesIfRunning(condition bool) {
+	if !condition {
+		return
+	}
+
+	r.engineMutex.Lock()
+	cancel := r.engineCancel
+	r.engineCancel, r.engineDone = nil, nil
+	r.engineMutex.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// acquireEngine waits for the engine pool to run the search of an engine move, reporting the
+// room's position in the queue to the participants. The moves of games with human players go first,
+// and cut short the search of a game without them, which plays the best move found so far.
+func (r *Room) acquireEngine(ctx context.Context) (context.Context, func(), error) {
+	r.mutex.Lock()
+	pool := r.cfg.Pool
+	priority := PriorityEngineGame
+	if len(r.seats) > 0 {
+		priority = PriorityMove
+	}
+	r.mutex.Unlock()
+
+	return pool.Acquire(ctx, r.poolOwner(), priority, func(position int) {
+		r.broadcast(MessageTypeEngineQueued, EngineQueuedResponse{Request: MessageTypeEngineMove, Position: position})
+	})
+}
+
+// poolOwner identifies the room's searches to the engine pool.
+func (r *Room) poolOwner() string {
+	if r.ID == "" { // A private room.
+		return fmt.Sprintf("room:%p", r)
+	}
+	return "room:" + r.ID
+}
+
+// playEngineMoves plays engine moves until the active player is a human player
+// or the context is cancelled.
+func (r *Room) playEngineMoves(ctx context.Context, game *g.GameSession) {
+	for !r.isHuman(game.ActivePlayer) {
+		if ctx.Err() != nil {
+			r.broadcast(MessageTypeStoppedProcessing, nil)
+			return
+		}
+
+		r.broadcast(MessageTypeProcessing, nil)
+		moveNumber := game.MoveNumber
+		player := game.ActivePlayer
+
+		searchCtx, release, err := r.acquireEngine(ctx)
+		if err != nil { // Cancelled while queued.
+			r.broadcast(MessageTypeStoppedProcessing, nil)
+			return
+		}
+		now := time.Now()
+
+		// The settings of the move are fixed here; changes apply from the next move on.
+		r.mutex.Lock()
+		engine := r.engine
+		limits := ai.Limits{MultiPV: r.cfg.MultiPV, Clock: engineClock(r.gs, time.Now())}
+		r.searchInfo = nil
+		r.mutex.Unlock()
+
+		result, err := engine.GetBestMoveCtx(searchCtx, game.Game, limits)
+		release()
+		if err != nil {
+			r.logger().Warn("Error getting best move", "error", err)
+			r.broadcast(MessageTypeStoppedProcessing, nil)
+			return
+		}
+
+		bestMove := result.Continuation[0]
+		elapsed := time.Since(now)
+
+		// Commit the move unless the search was cancelled or the seat claimed in the meantime,
+		// atomically with respect to human moves.
+		r.mutex.Lock()
+		_, claimed := r.seats[player]
+		cancelled := ctx.Err() != nil || claimed
+		flagged := !cancelled && r.checkTimeLocked(time.Now())
+		if !cancelled && !flagged {
+			game.PlayAt(bestMove, time.Now())
+			r.gs = game.Copy()
+			r.resetClockTimerLocked()
+		}
+		gs := r.gs.Copy()
+		r.mutex.Unlock()
+
+		if cancelled {
+			r.broadcast(MessageTypeStoppedProcessing, nil)
+			return
+		}
+		if flagged { // The game has ended; see playUntilPlayerMove.
+			r.broadcast(MessageTypeStoppedProcessing, nil)
+			r.broadcast(MessageTypeGameEnded, NewGameEndedResponse(gs))
+			return
+		}
+
+		r.moveMade()
+		r.broadcast(MessageTypeEngineMove, BestMoveResponse{
+			Continuation: PGNMovesFromGameMoves(result.Continuation),
+			MoveNumber:   moveNumber,
+			Score:        math.Round(result.Score*float64(player.Team())*100) / 100,
+			Lines:        PGNLinesFromLines(result.Lines, player),
+			Time:         math.Round(elapsed.Seconds()*100) / 100,
+			Evaluations:  result.Nodes,
+			Clock:        NewClockResponse(gs, time.Now()),
+		})
+		r.logger().Info("Engine move", "moveNumber", moveNumber, "player", player,
+			"move", PGNMoveFromGameMove(bestMove), "score", result.Score, "depth", result.Depth,
+			"elapsed", elapsed, "nodes", result.Nodes)
+		r.logger().Debug("Position", "fen", game.FEN())
+	}
+}
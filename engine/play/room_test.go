@@ -0,0 +1,170 @@
+package play_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+	"github.com/vpoliakov01/2v2ChessAI/engine/play"
+)
+
+func lastRoomState(t *testing.T, conn *testConnection) play.RoomStateResponse {
+	t.Helper()
+	states := conn.MessagesOfType(play.MessageTypeRoomState)
+	require.NotEmpty(t, states)
+	return dataFromMessage[play.RoomStateResponse](t, states[len(states)-1])
+}
+
+func TestRoomSharedGame(t *testing.T) {
+	lobby := play.NewLobby(defaultTestConfig())
+	redYellow := ConnectToLobby(t, lobby, "room", playerRed, playerYellow)
+	blueGreen := ConnectToLobby(t, lobby, "room", playerBlue, playerGreen)
+
+	state := lastRoomState(t, redYellow)
+	require.Equal(t, "room", state.RoomID)
+	require.Equal(t, 2, state.Participants)
+	for _, seat := range state.Seats {
+		require.True(t, seat.Claimed)
+		require.Equal(t, seat.Player.Team() == game.Player(playerRed).Team(), seat.Yours)
+	}
+
+	blueGreen.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+	require.Len(t, blueGreen.MessagesOfType(play.MessageTypeInvalidMove), 1, "Red's seat is not Blue's")
+
+	redYellow.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+	for _, conn := range []*testConnection{redYellow, blueGreen} {
+		moves := conn.MessagesOfType(play.MessageTypeMovePlayed)
+		require.Len(t, moves, 1, "the move should be broadcast to all participants")
+		moved := dataFromMessage[play.MovePlayedResponse](t, moves[0])
+		require.Equal(t, validFirstMove, moved.Move)
+		require.Equal(t, playerRed, moved.Player)
+	}
+
+	redYellow.ProcessMessage(play.MessageTypePlayerMove, "b7-c7")
+	require.Len(t, redYellow.MessagesOfType(play.MessageTypeInvalidMove), 1, "Blue's seat is not Red's")
+
+	blueGreen.ProcessMessage(play.MessageTypePlayerMove, "b7-c7")
+	require.Len(t, blueGreen.MessagesOfType(play.MessageTypeInvalidMove), 1)
+	require.Len(t, redYellow.MessagesOfType(play.MessageTypeMovePlayed), 2)
+}
+
+func TestRoomSharedGameIsNotReplaced(t *testing.T) {
+	lobby := play.NewLobby(defaultTestConfig())
+	redYellow := ConnectToLobby(t, lobby, "room", playerRed, playerYellow)
+	blueGreen := ConnectToLobby(t, lobby, "room", playerBlue, playerGreen)
+	redYellow.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+
+	blueGreen.ProcessMessage(play.MessageTypeNewGame, nil)
+	blueGreen.ProcessMessage(play.MessageTypeSetCurrentMove, 0)
+	blueGreen.ProcessMessage(play.MessageTypeLoadGame, "")
+	errors := blueGreen.MessagesOfType(play.MessageTypeError)
+	require.Len(t, errors, 3, "the game is only taken back by agreement")
+	for _, msg := range errors {
+		require.Equal(t, play.ErrorCodeForbidden, dataFromMessage[play.ErrorResponse](t, msg).Code)
+	}
+	redYellow.ProcessMessage(play.MessageTypeSaveGame, nil)
+	resp := dataFromMessage[play.SaveGameResponse](t, requireSingleMessage(t, redYellow, play.MessageTypeSaveGameResponse))
+	require.Contains(t, resp.PGN, string(validFirstMove))
+
+	blueGreen.Close()
+	redYellow.ProcessMessage(play.MessageTypeSetCurrentMove, 0)
+	require.Empty(t, redYellow.MessagesOfType(play.MessageTypeError), "the room is no longer shared")
+}
+
+func TestRoomSeatsAreClaimedOnce(t *testing.T) {
+	lobby := play.NewLobby(defaultTestConfig())
+	first := ConnectToLobby(t, lobby, "room", playerRed)
+	second := ConnectToLobby(t, lobby, "room", playerRed, playerBlue)
+
+	seats := lastRoomState(t, second).Seats
+	require.False(t, seats[playerRed].Yours, "Red is already claimed")
+	require.True(t, seats[playerBlue].Yours)
+	require.False(t, seats[playerYellow].Claimed)
+
+	require.True(t, lastRoomState(t, first).Seats[playerRed].Yours)
+	require.Same(t, lobby.Room("room"), lobby.Room("room"))
+}
+
+func TestRoomEngineTakesOverFreedSeat(t *testing.T) {
+	lobby := play.NewLobby(defaultTestConfig())
+	red := ConnectToLobby(t, lobby, "room", playerRed, playerYellow)
+	blue := ConnectToLobby(t, lobby, "room", playerBlue, playerGreen)
+
+	red.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+	require.Empty(t, red.MessagesOfType(play.MessageTypeEngineMove))
+
+	// Blue is to move, so the engine has to play for Blue (and Green) once they leave.
+	blue.Close()
+
+	engineMove := dataFromMessage[play.BestMoveResponse](t, red.WaitForMessagesOfType(play.MessageTypeEngineMove, 1)[0])
+	require.Equal(t, 2, engineMove.MoveNumber, "Blue plays the second move")
+
+	seats := lastRoomState(t, red).Seats
+	require.False(t, seats[playerBlue].Claimed)
+	require.Equal(t, 1, lastRoomState(t, red).Participants)
+
+	red.Close()
+	require.Nil(t, lobby.Room("room"), "the room should be closed when everyone leaves")
+}
+
+func TestRoomSpectator(t *testing.T) {
+	lobby := play.NewLobby(defaultTestConfig())
+	_, err := lobby.Spectate(newTestConnection(t), "room")
+	require.Error(t, err, "only existing rooms can be watched")
+
+	player := ConnectToLobby(t, lobby, "room", playerRed, playerBlue, playerYellow, playerGreen)
+	spectator := SpectateInLobby(t, lobby, "room")
+
+	state := lastRoomState(t, spectator)
+	require.True(t, state.Spectating)
+	require.Equal(t, 1, state.Spectators)
+	for _, seat := range state.Seats {
+		require.False(t, seat.Yours)
+	}
+
+	spectator.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+	require.Len(t, spectator.MessagesOfType(play.MessageTypeInvalidMove), 1, "spectators cannot move")
+	spectator.ProcessMessage(play.MessageTypeNewGame, nil)
+	require.Empty(t, player.MessagesOfType(play.MessageTypeMovePlayed))
+	require.Len(t, player.MessagesOfType(play.MessageTypeLoadGameResponse), 1, "spectators cannot start a new game")
+
+	player.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+	require.Len(t, spectator.MessagesOfType(play.MessageTypeMovePlayed), 1)
+
+	spectator.ProcessMessage(play.MessageTypeSaveGame, nil)
+	resp := dataFromMessage[play.SaveGameResponse](t, requireSingleMessage(t, spectator, play.MessageTypeSaveGameResponse))
+	require.Contains(t, resp.PGN, string(validFirstMove))
+}
+
+func TestRoomEngineGame(t *testing.T) {
+	cfg := defaultTestConfig()
+	cfg.HumanPlayers = []game.Player{}
+	lobby := play.NewLobby(cfg)
+
+	room, err := lobby.StartEngineGame("")
+	require.NoError(t, err)
+	_, err = lobby.StartEngineGame(room.ID)
+	require.Error(t, err, "room IDs are unique")
+
+	spectator := SpectateInLobby(t, lobby, room.ID)
+	require.True(t, lastRoomState(t, spectator).EngineGame)
+	spectator.WaitForMessagesOfType(play.MessageTypeEngineMove, 3)
+
+	spectator.ProcessMessage(play.MessageTypeListRooms, nil)
+	rooms := dataFromMessage[[]play.RoomSummary](t, spectator.WaitForMessagesOfType(play.MessageTypeRoomList, 1)[0])
+	require.Len(t, rooms, 1)
+	require.Equal(t, room.ID, rooms[0].RoomID)
+	require.Empty(t, rooms[0].HumanPlayers)
+	require.True(t, rooms[0].EngineGame)
+
+	spectator.Close()
+	require.NotNil(t, lobby.Room(room.ID), "engine games stay open without spectators")
+
+	// Nobody can take a seat from the engine.
+	player := ConnectToLobby(t, lobby, room.ID, playerRed)
+	require.False(t, lastRoomState(t, player).Seats[playerRed].Claimed)
+
+	require.NoError(t, lobby.CloseRoom(room.ID))
+	require.Nil(t, lobby.Room(room.ID))
+}
@@ -2,23 +2,31 @@ package play
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 
 	"github.com/gofiber/websocket/v2"
 )
 
 func (c *Connection) SendMessage(messageType MessageType, data interface{}) {
-	msg := Message{Type: messageType, Data: data}
+	c.sendMessage(Message{Type: messageType, Data: data})
+}
+
+func (c *Connection) sendMessage(msg Message) {
 	bytes, err := json.Marshal(msg)
 	if err != nil {
-		log.Fatalf("error marshalling message: %v", err)
+		slog.Error("Error marshalling message", "session", c.ID, "type", msg.Type, "error", err)
+		return
 	}
 
 	c.writeLock.Lock()
+	if c.conn == nil { // Detached: the client reconnects with a new connection.
+		c.writeLock.Unlock()
+		return
+	}
 	err = c.conn.WriteMessage(websocket.TextMessage, bytes)
 	c.writeLock.Unlock()
 	if err != nil {
-		log.Println("write:", err)
+		slog.Warn("Error writing message", "session", c.ID, "type", msg.Type, "error", err)
 		return
 	}
 }
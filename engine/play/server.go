@@ -1,29 +1,111 @@
 package play
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/websocket/v2"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/ai"
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
 )
 
+// DefaultAddress is the address the server listens on by default.
+const DefaultAddress = ":8080"
+
+// ShutdownTimeout bounds the graceful shutdown of Serve.
+const ShutdownTimeout = 10 * time.Second
+
 type Server struct {
-	app *fiber.App
-	cfg *Config
+	app          *fiber.App
+	cfg          *Config
+	lobby        *Lobby
+	games        *gameStore // Stored through the API.
+	ui           fs.FS      // Served at /, if set (see WithUI).
+	address      string
+	certFile     string // Serves HTTPS if set, with keyFile.
+	keyFile      string
+	gamesFile    string // Persists the stored games, if set (see WithGamesFile).
+	pool         *EnginePool
+	shuttingDown atomic.Bool
+
+	stats       *ai.Stats // Of the engines of the server.
+	connections atomic.Int64
+	messages    messageCounter // Received from the clients.
+}
+
+// WithAddress makes the server listen on the address, e.g. "localhost:8443".
+func WithAddress(address string) func(*Server) {
+	return func(s *Server) {
+		s.address = address
+	}
+}
+
+// WithTLS makes the server serve HTTPS (and WSS) with the certificate and key of the files.
+func WithTLS(certFile, keyFile string) func(*Server) {
+	return func(s *Server) {
+		s.certFile = certFile
+		s.keyFile = keyFile
+	}
+}
+
+// WithGamesFile persists the games stored through the API in the file: they are loaded
+// from it when the server starts, and written to it on shutdown, along with the games
+// of the rooms.
+func WithGamesFile(file string) func(*Server) {
+	return func(s *Server) {
+		s.gamesFile = file
+	}
+}
+
+// WithEngineConcurrency makes the engines of the server run at most n searches at once
+// (DefaultEngineConcurrency by default). The searches share the CPUs.
+func WithEngineConcurrency(n int) func(*Server) {
+	return func(s *Server) {
+		s.pool = NewEnginePool(n)
+	}
 }
 
-func NewServer(cfg *Config) *Server {
-	app := fiber.New()
+// NewServer creates a server whose rooms start with a copy of cfg. The engines of the server
+// publish their telemetry to its stats, which are served at /metrics, and run their searches
+// in its engine pool (cfg.Metrics and cfg.Pool are ignored).
+func NewServer(cfg *Config, options ...func(*Server)) *Server {
+	app := fiber.New(fiber.Config{ErrorHandler: handleError})
 	server := &Server{
-		app: app,
-		cfg: cfg,
+		app:     app,
+		games:   newGameStore(),
+		address: DefaultAddress,
+		pool:    NewEnginePool(DefaultEngineConcurrency),
+		stats:   ai.NewStats(),
 	}
+	for _, option := range options {
+		option(server)
+	}
+
+	serverCfg := cfg.clone()
+	serverCfg.Metrics = server.stats
+	serverCfg.Pool = server.pool
+	server.cfg = &serverCfg
+	server.lobby = NewLobby(&serverCfg)
 
 	app.Use(cors.New())
 
 	app.Use("/ws", func(c *fiber.Ctx) error {
+		if server.shuttingDown.Load() {
+			return fiber.NewError(fiber.StatusServiceUnavailable, "server shutting down")
+		}
 		if websocket.IsWebSocketUpgrade(c) {
 			c.Locals("allowed", true)
 			return c.Next()
@@ -31,39 +113,192 @@ func NewServer(cfg *Config) *Server {
 		return fiber.ErrUpgradeRequired
 	})
 
+	app.Get("/healthz", server.handleHealth)
+	app.Get("/metrics", server.handleMetrics)
 	app.Get("/ws", server.HandleWebsocket())
+	server.registerAPI()
+	if server.ui != nil {
+		server.serveUI()
+	}
 
 	return server
 }
 
-func (s *Server) Run() {
-	log.Fatal(s.app.Listen(":8080"))
+// Lobby returns the rooms of the server.
+func (s *Server) Lobby() *Lobby {
+	return s.lobby
+}
+
+// App returns the fiber app of the server.
+func (s *Server) App() *fiber.App {
+	return s.app
+}
+
+// Serve serves until the context is done, then shuts the server down (see Shutdown).
+func (s *Server) Serve(ctx context.Context) error {
+	if s.gamesFile != "" {
+		if err := s.games.load(s.gamesFile); err != nil {
+			return err
+		}
+	}
+
+	ln, err := s.listen()
+	if err != nil {
+		return err
+	}
+	slog.Info("Listening", "address", ln.Addr().String(), "tls", s.certFile != "")
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.app.Listener(ln)
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	err = s.Shutdown(shutdownCtx)
+	ln.Close() // In case the app did not serve it yet, so it had nothing to shut down.
+	if servedErr := <-served; !errors.Is(servedErr, net.ErrClosed) {
+		err = errors.Join(err, servedErr)
+	}
+	return err
+}
+
+// listen listens on the server's address, with TLS if configured.
+func (s *Server) listen() (net.Listener, error) {
+	ln, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return nil, err
+	}
+	if s.certFile == "" {
+		return ln, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("error loading TLS certificate: %w", err)
+	}
+	return tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{cert}}), nil
+}
+
+// Shutdown stops the engines and analyses, closes the websockets, stores the games of
+// the rooms, writes the stored games to the games file, and stops the server once its
+// requests are done or the context is.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.shuttingDown.Swap(true) {
+		return nil
+	}
+
+	s.lobby.Shutdown()
+
+	var err error
+	if s.gamesFile != "" {
+		for roomID, gs := range s.lobby.games() {
+			stored := s.games.add(gs)
+			slog.Info("Stored the game of a room", "room", roomID, "game", stored.ID)
+		}
+		if err = s.games.save(s.gamesFile); err != nil {
+			err = fmt.Errorf("error saving games: %w", err)
+		}
+	}
+
+	return errors.Join(err, s.app.ShutdownWithContext(ctx))
+}
+
+// HealthResponse is the response of the health endpoint.
+type HealthResponse struct {
+	Status   string `json:"status"` // "ok", or "shuttingDown".
+	Rooms    int    `json:"rooms"`
+	Sessions int    `json:"sessions"`
+}
+
+// handleHealth answers 200 while the server is up, and 503 once it is shutting down.
+func (s *Server) handleHealth(c *fiber.Ctx) error {
+	rooms, sessions := s.lobby.counts()
+	if s.shuttingDown.Load() {
+		return c.Status(fiber.StatusServiceUnavailable).
+			JSON(HealthResponse{Status: "shuttingDown", Rooms: rooms, Sessions: sessions})
+	}
+	return c.JSON(HealthResponse{Status: "ok", Rooms: rooms, Sessions: sessions})
 }
 
+// HandleWebsocket serves a client of the room given by the "room" query parameter
+// (a new room if missing), claiming the seats given by the "seats" parameter, e.g. "0,2"
+// (cfg.HumanPlayers if missing). With "spectate=true", the client watches the room instead.
+// With "session", the client resumes its session if it is still open (see Lobby.Resume).
 func (s *Server) HandleWebsocket() fiber.Handler {
 	return websocket.New(func(c *websocket.Conn) {
-		log.Println("Websocket connection established")
-		defer log.Println("Websocket connection closed")
+		logger := slog.With("remote", c.RemoteAddr().String())
+		logger.Info("Websocket connection established")
+		defer logger.Info("Websocket connection closed")
+		s.connections.Add(1)
+		defer s.connections.Add(-1)
 
-		conn := NewConnection(c, s.cfg)
+		seats := s.cfg.HumanPlayers
+		if seatsStr := c.Query("seats"); seatsStr != "" {
+			var err error
+			if seats, err = parseSeats(seatsStr); err != nil {
+				logger.Warn("Invalid seats", "seats", seatsStr, "error", err)
+				return
+			}
+		}
 
-		conn.playUntilPlayerMove()
+		var conn *Connection
+		if session := c.Query("session"); session != "" {
+			var err error
+			if conn, err = s.lobby.Resume(c, session); err != nil {
+				logger.Warn("Error resuming session", "session", session, "error", err)
+			}
+		}
+		if conn == nil && c.Query("spectate") == "true" {
+			var err error
+			if conn, err = s.lobby.Spectate(c, c.Query("room")); err != nil {
+				logger.Warn("Error spectating", "room", c.Query("room"), "error", err)
+				return
+			}
+		} else if conn == nil {
+			conn = s.lobby.Connect(c, c.Query("room"), seats)
+		}
+		// The session outlives the websocket for a while, so that the client can resume it.
+		defer s.lobby.Disconnect(conn)
 
 		for {
 			_, msg, err := c.ReadMessage()
 			if err != nil {
-				log.Println("read:", err)
+				conn.logger().Debug("Error reading message", "error", err)
 				break
 			}
 
 			message := Message{}
 			err = json.Unmarshal(msg, &message)
 			if err != nil {
-				log.Println("unmarshal:", err)
-				break
+				conn.logger().Warn("Invalid message", "error", err)
+				conn.SendError(&message, requestErrorf(ErrorCodeInvalidMessage, "invalid message: %v", err))
+				continue
 			}
 
+			s.messages.add(message.Type)
 			conn.ProcessMessage(&message)
 		}
 	})
 }
+
+// parseSeats parses a comma separated list of players, e.g. "0,2".
+func parseSeats(s string) ([]game.Player, error) {
+	seats := []game.Player{}
+	for _, field := range strings.Split(s, ",") {
+		player, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || player < 0 || player > 3 {
+			return nil, fmt.Errorf("invalid player %q", field)
+		}
+		seats = append(seats, game.Player(player))
+	}
+	return seats, nil
+}
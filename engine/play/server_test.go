@@ -0,0 +1,134 @@
+package play_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/ai"
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+	"github.com/vpoliakov01/2v2ChessAI/engine/play"
+)
+
+func TestHealth(t *testing.T) {
+	server := play.NewServer(defaultTestConfig())
+
+	resp := play.HealthResponse{}
+	status := apiRequest(t, server, http.MethodGet, "/healthz", "", &resp)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "ok", resp.Status)
+
+	require.NoError(t, server.Shutdown(context.Background()))
+	status = apiRequest(t, server, http.MethodGet, "/healthz", "", &resp)
+	require.Equal(t, http.StatusServiceUnavailable, status)
+	require.Equal(t, "shuttingDown", resp.Status)
+}
+
+// TestShutdown shuts the server down while the engine searches: the search is stopped,
+// the client's websocket is closed, and the room's game is saved.
+func TestShutdown(t *testing.T) {
+	cfg := defaultTestConfig()
+	cfg.Depth = 100
+	cfg.Spread = ai.DefaultSpread // With no spread, the engine searches a single line, which takes no time.
+	cfg.EvalLimit = 0
+	cfg.HumanPlayers = []game.Player{playerRed}
+	gamesFile := filepath.Join(t.TempDir(), "games.json")
+	server := play.NewServer(cfg, play.WithGamesFile(gamesFile))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	served := make(chan error, 1)
+	go func() {
+		served <- server.App().Listener(ln)
+	}()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/ws?seats=0", nil)
+	require.NoError(t, err)
+	defer ws.Close()
+
+	move, err := json.Marshal(play.Message{Type: play.MessageTypePlayerMove, Data: "h2-h3"})
+	require.NoError(t, err)
+	require.NoError(t, ws.WriteMessage(websocket.TextMessage, move))
+	readUntil(t, ws, play.MessageTypeProcessing) // The engine searches for blue.
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, server.Shutdown(ctx))
+	require.NoError(t, <-served)
+
+	for {
+		_, _, err = ws.ReadMessage()
+		if err != nil {
+			break
+		}
+	}
+	require.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "unexpected error: %v", err)
+
+	bytes, err := os.ReadFile(gamesFile)
+	require.NoError(t, err)
+	games := []play.APIGameResponse{}
+	require.NoError(t, json.Unmarshal(bytes, &games))
+	require.Len(t, games, 1)
+	require.Equal(t, "1. h2-h3", games[0].PGN)
+
+	// The saved games are stored again by a new server.
+	server = play.NewServer(cfg, play.WithAddress("127.0.0.1:0"), play.WithGamesFile(gamesFile))
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, server.Serve(ctx))
+	stored := []play.APIGameResponse{}
+	apiRequest(t, server, http.MethodGet, "/api/games", "", &stored)
+	require.Len(t, stored, 1)
+}
+
+// readUntil reads the websocket's messages until one of the type.
+func readUntil(t *testing.T, ws *websocket.Conn, msgType play.MessageType) {
+	t.Helper()
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for {
+		_, raw, err := ws.ReadMessage()
+		require.NoError(t, err)
+		msg := play.Message{}
+		require.NoError(t, json.Unmarshal(raw, &msg))
+		if msg.Type == msgType {
+			return
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	cfg := defaultTestConfig()
+	cfg.EvalLimit = 0
+	server := play.NewServer(cfg)
+
+	resp := play.APIAnalyzeResponse{}
+	status := apiRequest(t, server, http.MethodPost, "/api/analyze", `{"depth": 2}`, &resp)
+	require.Equal(t, http.StatusOK, status)
+
+	res, err := server.App().Test(httptest.NewRequest(http.MethodGet, "/metrics", nil), -1)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Contains(t, res.Header.Get("Content-Type"), "text/plain")
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	metrics := string(body)
+	require.Contains(t, metrics, "# TYPE chess_search_depth_seconds histogram\n")
+	require.Contains(t, metrics, "chess_searches_total 1\n")
+	require.Contains(t, metrics, "chess_searches_in_flight 0\n")
+	require.Contains(t, metrics, fmt.Sprintf("chess_search_nodes_total %v\n", resp.Evaluations))
+	require.Contains(t, metrics, `chess_search_depth_seconds_count{depth="2"} 1`)
+	require.Contains(t, metrics, "chess_rooms 0\n")
+}
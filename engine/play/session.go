@@ -0,0 +1,178 @@
+package play
+
+import (
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+// DefaultSessionGracePeriod is how long a disconnected session can be resumed by default.
+const DefaultSessionGracePeriod = 30 * time.Second
+
+// newSession creates a connection with a new session ID. It is not in any room yet.
+func (l *Lobby) newSession(c MessageWriter) *Connection {
+	conn := newConnection(c, &l.cfg)
+	conn.lobby = l
+
+	l.mutex.Lock()
+	conn.ID = newID(16)
+	l.sessions[conn.ID] = conn
+	l.mutex.Unlock()
+
+	conn.SendMessage(MessageTypeSession, SessionResponse{SessionID: conn.ID})
+	return conn
+}
+
+// Resume creates a connection resuming the session with the given ID (see resume).
+func (l *Lobby) Resume(c MessageWriter, id string) (*Connection, error) {
+	conn := newConnection(c, &l.cfg)
+	conn.lobby = l
+
+	if err := conn.resume(id); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Disconnect detaches the connection from its client. The session keeps its room and seats
+// for the grace period, so that the client can resume it; it is closed afterwards.
+func (l *Lobby) Disconnect(c *Connection) {
+	c.stopAnalysis()
+	c.detach()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.sessions[c.ID] == c {
+		c.expiry = time.AfterFunc(l.gracePeriod, func() { l.expire(c) })
+	}
+}
+
+// endSession forgets the session of c, unless another connection resumed it.
+func (l *Lobby) endSession(c *Connection) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.sessions[c.ID] == c {
+		delete(l.sessions, c.ID)
+	}
+}
+
+// expire closes the session of c unless it was resumed in the meantime.
+func (l *Lobby) expire(c *Connection) {
+	l.mutex.Lock()
+	current := l.sessions[c.ID] == c
+	if current {
+		delete(l.sessions, c.ID)
+	}
+	l.mutex.Unlock()
+
+	if current {
+		slog.Info("Session expired", "session", c.ID)
+		c.Close()
+	}
+}
+
+// resume makes c take over the session with the given ID: its ID, room, seats, and role.
+// The engine is not interrupted. c leaves its own room (if any), and gets the full state of the session.
+func (c *Connection) resume(id string) error {
+	l := c.lobby
+	if l == nil {
+		return requestErrorf(ErrorCodeInvalidRequest, "the connection has a private room")
+	}
+
+	l.mutex.Lock()
+	old := l.sessions[id]
+	if old == nil || old == c {
+		l.mutex.Unlock()
+		return requestErrorf(ErrorCodeNotFound, "session %q does not exist or has expired", id)
+	}
+	if old.expiry != nil {
+		old.expiry.Stop()
+	}
+	if c.ID != "" {
+		delete(l.sessions, c.ID)
+	}
+	c.ID = id
+	l.sessions[id] = c
+	l.mutex.Unlock()
+
+	old.stopAnalysis()
+	old.detach()
+	c.stopAnalysis()
+	c.leaveRoom()
+
+	room := old.room
+	old.room = nil
+	c.room = room
+	c.spectator = old.spectator
+	room.replaceParticipant(old, c)
+
+	c.sendState()
+	return nil
+}
+
+// processResume resumes the session with the given ID. If it can't, the connection keeps
+// its own session, and is told so.
+func (c *Connection) processResume(id string) error {
+	if err := c.resume(id); err != nil {
+		c.SendMessage(MessageTypeSession, SessionResponse{SessionID: c.ID})
+		return err
+	}
+	return nil
+}
+
+// sendState sends the full state of a resumed session: the session ID, the room's settings,
+// seats and game, and the engine's search in progress or the moves available.
+func (c *Connection) sendState() {
+	r := c.room
+	c.SendMessage(MessageTypeSession, SessionResponse{SessionID: c.ID, Resumed: true})
+	c.SendMessage(MessageTypeSetSettingsResponse, r.settings())
+
+	gs := r.snapshot()
+	c.SendMessage(MessageTypeLoadGameResponse, NewLoadGameResponse(gs))
+	r.broadcastRoomState()
+
+	if searching, info := r.engineSearch(); searching {
+		c.SendMessage(MessageTypeProcessing, nil)
+		if info != nil {
+			c.SendMessage(MessageTypeSearchInfo, *info)
+		}
+		return
+	}
+
+	if gs.HasEnded() {
+		c.SendMessage(MessageTypeGameEnded, NewGameEndedResponse(gs))
+		return
+	}
+	c.processGetAvailableMoves()
+}
+
+// detach stops sending messages to the client.
+func (c *Connection) detach() {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	c.conn = nil
+}
+
+// closeWebsocket tells the client that the server is going away and closes its websocket.
+// The connection is detached.
+func (c *Connection) closeWebsocket() {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	if c.conn == nil {
+		return
+	}
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	if err := c.conn.WriteMessage(websocket.CloseMessage, msg); err != nil {
+		slog.Warn("Error closing websocket", "session", c.ID, "error", err)
+	}
+	if closer, ok := c.conn.(io.Closer); ok {
+		closer.Close()
+	}
+	c.conn = nil
+}
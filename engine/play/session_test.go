@@ -0,0 +1,89 @@
+package play_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/play"
+)
+
+func sessionFromMessages(t *testing.T, conn *testConnection) play.SessionResponse {
+	t.Helper()
+	sessions := conn.MessagesOfType(play.MessageTypeSession)
+	require.NotEmpty(t, sessions)
+	return dataFromMessage[play.SessionResponse](t, sessions[len(sessions)-1])
+}
+
+func TestSessionResume(t *testing.T) {
+	lobby := play.NewLobby(defaultTestConfig())
+	red := ConnectToLobby(t, lobby, "room", playerRed, playerYellow)
+	blue := ConnectToLobby(t, lobby, "room", playerBlue, playerGreen)
+
+	session := sessionFromMessages(t, red)
+	require.NotEmpty(t, session.SessionID)
+	require.False(t, session.Resumed)
+	require.NotEqual(t, session.SessionID, sessionFromMessages(t, blue).SessionID)
+
+	red.ProcessMessage(play.MessageTypePlayerMove, validFirstMove)
+	lobby.Disconnect(red.Connection)
+
+	// The seats stay Red's while it is away, so the engine doesn't play for it.
+	blue.ProcessMessage(play.MessageTypePlayerMove, "b7-c7")
+	require.Empty(t, blue.MessagesOfType(play.MessageTypeEngineMove))
+	require.Len(t, red.MessagesOfType(play.MessageTypeMovePlayed), 1, "a detached connection gets no messages")
+
+	resumed := ResumeInLobby(t, lobby, session.SessionID)
+	require.Equal(t, play.SessionResponse{SessionID: session.SessionID, Resumed: true}, sessionFromMessages(t, resumed))
+
+	game := dataFromMessage[play.LoadGameResponse](t, requireSingleMessage(t, resumed, play.MessageTypeLoadGameResponse))
+	require.Equal(t, []play.PGNMove{validFirstMove, "b7-c7"}, game.PastMoves)
+	requireSingleMessage(t, resumed, play.MessageTypeAvailableMoves)
+
+	state := lastRoomState(t, resumed)
+	require.Equal(t, 2, state.Participants)
+	require.True(t, state.Seats[playerRed].Yours)
+	require.True(t, state.Seats[playerYellow].Yours)
+
+	resumed.ProcessMessage(play.MessageTypePlayerMove, "g13-g12")
+	require.Empty(t, resumed.MessagesOfType(play.MessageTypeInvalidMove), "Yellow's seat is still Red's")
+	require.Len(t, blue.MessagesOfType(play.MessageTypeMovePlayed), 3)
+
+	_, err := lobby.Resume(newTestConnection(t), "unknown")
+	require.Error(t, err)
+}
+
+func TestSessionExpires(t *testing.T) {
+	lobby := play.NewLobby(defaultTestConfig(), play.WithGracePeriod(10*time.Millisecond))
+	red := ConnectToLobby(t, lobby, "room", playerRed)
+	blue := ConnectToLobby(t, lobby, "room", playerBlue, playerYellow, playerGreen)
+
+	lobby.Disconnect(red.Connection)
+
+	// Red is to move, so the engine takes over once the session expires.
+	engineMove := dataFromMessage[play.BestMoveResponse](t, blue.WaitForMessagesOfType(play.MessageTypeEngineMove, 1)[0])
+	require.Equal(t, 1, engineMove.MoveNumber)
+	require.False(t, lastRoomState(t, blue).Seats[playerRed].Claimed)
+
+	_, err := lobby.Resume(newTestConnection(t), sessionFromMessages(t, red).SessionID)
+	require.Error(t, err, "an expired session cannot be resumed")
+}
+
+func TestSessionResumeMessage(t *testing.T) {
+	lobby := play.NewLobby(defaultTestConfig())
+	red := ConnectToLobby(t, lobby, "room", playerRed)
+	session := sessionFromMessages(t, red)
+	lobby.Disconnect(red.Connection)
+
+	other := ConnectToLobby(t, lobby, "other")
+	own := sessionFromMessages(t, other)
+	other.ProcessMessage(play.MessageTypeResume, "unknown")
+	require.Len(t, other.MessagesOfType(play.MessageTypeSession), 2)
+	require.Equal(t, own, sessionFromMessages(t, other), "the connection keeps its own session")
+
+	other.ProcessMessage(play.MessageTypeResume, session.SessionID)
+	require.Equal(t, play.SessionResponse{SessionID: session.SessionID, Resumed: true}, sessionFromMessages(t, other))
+	require.True(t, lastRoomState(t, other).Seats[playerRed].Yours)
+	require.Nil(t, lobby.Room("other"), "the room left behind is closed")
+}
@@ -57,14 +57,28 @@ func NewConnection(t *testing.T, cfg *play.Config) *testConnection {
 		cfg = defaultTestConfig()
 	}
 
-	conn := &testConnection{
+	conn := newTestConnection(t)
+	conn.Connection = play.NewConnection(conn, cfg)
+	return conn
+}
+
+// ConnectToLobby builds a testConnection that joins the lobby's room with the given ID
+// and claims the given seats.
+func ConnectToLobby(t *testing.T, lobby *play.Lobby, roomID string, seats ...game.Player) *testConnection {
+	t.Helper()
+
+	conn := newTestConnection(t)
+	conn.Connection = lobby.Connect(conn, roomID, seats)
+	return conn
+}
+
+func newTestConnection(t *testing.T) *testConnection {
+	return &testConnection{
 		t:            t,
 		NewMessageCh: make(chan Message, 100),
 		messages:     make([]Message, 0),
 		mu:           sync.Mutex{},
 	}
-	conn.Connection = play.NewConnection(conn, cfg)
-	return conn
 }
 
 // WriteMessage satisfies play.MessageWriter and stores the raw + parsed payload.
@@ -177,3 +191,29 @@ func requireOnlyMessage(t *testing.T, conn *testConnection, msgType play.Message
 	}
 	return msgs[0]
 }
+
+// SpectateInLobby builds a testConnection that watches the lobby's room with the given ID.
+func SpectateInLobby(t *testing.T, lobby *play.Lobby, roomID string) *testConnection {
+	t.Helper()
+
+	conn := newTestConnection(t)
+	var err error
+	conn.Connection, err = lobby.Spectate(conn, roomID)
+	if err != nil {
+		t.Fatalf("failed to spectate room %q: %v", roomID, err)
+	}
+	return conn
+}
+
+// ResumeInLobby builds a testConnection that resumes the lobby's session with the given ID.
+func ResumeInLobby(t *testing.T, lobby *play.Lobby, sessionID string) *testConnection {
+	t.Helper()
+
+	conn := newTestConnection(t)
+	var err error
+	conn.Connection, err = lobby.Resume(conn, sessionID)
+	if err != nil {
+		t.Fatalf("failed to resume session %q: %v", sessionID, err)
+	}
+	return conn
+}
@@ -1,6 +1,10 @@
 package play
 
 import (
+	"math"
+	"time"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/ai"
 	"github.com/vpoliakov01/2v2ChessAI/engine/game"
 )
 
@@ -23,21 +27,136 @@ const (
 	MessageTypeGameEnded           MessageType = "gameEnded"
 	MessageTypeProcessing          MessageType = "processing"
 	MessageTypeStoppedProcessing   MessageType = "stoppedProcessing"
+	MessageTypeSearchInfo          MessageType = "searchInfo"
+	MessageTypeMovePlayed          MessageType = "movePlayed"
+	MessageTypeJoinRoom            MessageType = "joinRoom"
+	MessageTypeRoomState           MessageType = "roomState"
+	MessageTypeListRooms           MessageType = "listRooms"
+	MessageTypeRoomList            MessageType = "roomList"
+	MessageTypeAnalyze             MessageType = "analyze"
+	MessageTypeStopAnalysis        MessageType = "stopAnalysis"
+	MessageTypeAnalysisInfo        MessageType = "analysisInfo"
+	MessageTypeHint                MessageType = "hint"
+	MessageTypeHintResponse        MessageType = "hintResponse"
+	MessageTypeSession             MessageType = "session"
+	MessageTypeResume              MessageType = "resume"
+	MessageTypeResign              MessageType = "resign"
+	MessageTypeOfferDraw           MessageType = "offerDraw"
+	MessageTypeAcceptDraw          MessageType = "acceptDraw"
+	MessageTypeDeclineDraw         MessageType = "declineDraw"
+	MessageTypeDrawOffer           MessageType = "drawOffer"
+	MessageTypeDrawDeclined        MessageType = "drawDeclined"
+	MessageTypeRequestTakeback     MessageType = "requestTakeback"
+	MessageTypeAcceptTakeback      MessageType = "acceptTakeback"
+	MessageTypeDeclineTakeback     MessageType = "declineTakeback"
+	MessageTypeTakebackRequest     MessageType = "takebackRequest"
+	MessageTypeTakebackDeclined    MessageType = "takebackDeclined"
+	MessageTypeError               MessageType = "error"
+	MessageTypeVersion             MessageType = "version"
+	MessageTypeVersionResponse     MessageType = "versionResponse"
+	MessageTypeEngineQueued        MessageType = "engineQueued"
 )
 
 type Message struct {
 	Type MessageType `json:"type"`
+	ID   string      `json:"id,omitempty"` // Set by the client to match the error of a failed request to it.
 	Data interface{} `json:"data"`
 }
 
 type PGNMove string
 
 type BestMoveResponse struct {
+	Continuation []PGNMove      `json:"continuation"`
+	MoveNumber   int            `json:"moveNumber"`
+	Score        float64        `json:"score"`
+	Lines        []PGNLine      `json:"lines"` // Best lines (see Config.MultiPV), best first.
+	Time         float64        `json:"time"`
+	Evaluations  int            `json:"evaluations"`
+	Clock        *ClockResponse `json:"clock,omitempty"` // As of the move.
+}
+
+// PGNLine is a candidate move with its continuation and score.
+type PGNLine struct {
 	Continuation []PGNMove `json:"continuation"`
+	Score        float64   `json:"score"`
+}
+
+// SearchInfoResponse reports the progress of a running engine search.
+type SearchInfoResponse struct {
 	MoveNumber   int       `json:"moveNumber"`
+	Depth        int       `json:"depth"`
+	Continuation []PGNMove `json:"continuation"` // Best line so far.
 	Score        float64   `json:"score"`
-	Time         float64   `json:"time"`
+	Lines        []PGNLine `json:"lines"` // Best lines of the last completed depth.
 	Evaluations  int       `json:"evaluations"`
+	NPS          int       `json:"nps"`
+	Time         float64   `json:"time"`
+	Final        bool      `json:"final"`
+}
+
+// MovePlayedResponse announces a move of a human player to the participants of the room.
+type MovePlayedResponse struct {
+	MoveNumber int            `json:"moveNumber"`
+	Player     game.Player    `json:"player"`
+	Move       PGNMove        `json:"move"`
+	Clock      *ClockResponse `json:"clock,omitempty"` // As of the move.
+}
+
+// JoinRoomRequest asks to join the room with the given ID (or a new room if empty)
+// and to claim the seats that are free, or to watch an existing room as a spectator.
+type JoinRoomRequest struct {
+	RoomID   string        `json:"roomId"`
+	Seats    []game.Player `json:"seats"`
+	Spectate bool          `json:"spectate"`
+}
+
+// RoomStateResponse describes the room to one of its participants.
+type RoomStateResponse struct {
+	RoomID       string      `json:"roomId"`
+	Participants int         `json:"participants"` // Including the spectators.
+	Spectators   int         `json:"spectators"`
+	Spectating   bool        `json:"spectating"` // Whether the recipient is a spectator.
+	EngineGame   bool        `json:"engineGame"`
+	Seats        []SeatState `json:"seats"` // Indexed by player.
+}
+
+// RoomSummary describes a room in the list of rooms.
+type RoomSummary struct {
+	RoomID       string        `json:"roomId"`
+	Participants int           `json:"participants"` // Including the spectators.
+	Spectators   int           `json:"spectators"`
+	HumanPlayers []game.Player `json:"humanPlayers"`
+	MoveNumber   int           `json:"moveNumber"`
+	EngineGame   bool          `json:"engineGame"`
+	Ended        bool          `json:"ended"`
+}
+
+// SeatState tells whether a seat is claimed by a participant or played by the engine.
+type SeatState struct {
+	Player  game.Player `json:"player"`
+	Claimed bool        `json:"claimed"`
+	Yours   bool        `json:"yours"`
+}
+
+// AnalyzeRequest starts analysing the current position. Without limits, the analysis
+// runs until stopAnalysis or a move is made.
+type AnalyzeRequest struct {
+	Depth    int `json:"depth"`
+	MoveTime int `json:"moveTime"` // Milliseconds.
+	MultiPV  int `json:"multiPV"`
+}
+
+// HintResponse suggests a move for the player to move.
+type HintResponse struct {
+	MoveNumber int     `json:"moveNumber"`
+	Move       PGNMove `json:"move"`
+	Score      float64 `json:"score"`
+}
+
+// EngineQueuedResponse tells the position of a search in the queue of the server's engines.
+type EngineQueuedResponse struct {
+	Request  MessageType `json:"request"`  // The search's request: engineMove for the room's engine, analyze or hint.
+	Position int         `json:"position"` // From 1; 0 once the search runs.
 }
 
 type SaveGameResponse struct {
@@ -45,13 +164,118 @@ type SaveGameResponse struct {
 }
 
 type LoadGameResponse struct {
-	PastMoves   []PGNMove `json:"pastMoves"`
-	CurrentMove int       `json:"currentMove"`
+	PastMoves   []PGNMove      `json:"pastMoves"`
+	CurrentMove int            `json:"currentMove"`
+	Clock       *ClockResponse `json:"clock,omitempty"`
+}
+
+// NewLoadGameResponse describes the moves of the game, and its clocks as of now.
+func NewLoadGameResponse(gs *game.GameSession) LoadGameResponse {
+	return LoadGameResponse{
+		PastMoves:   PGNMovesFromGameMoves(gs.PastMoves),
+		CurrentMove: gs.CurrentMove,
+		Clock:       NewClockResponse(gs, time.Now()),
+	}
+}
+
+// ClockResponse is the state of the clocks of a timed game.
+type ClockResponse struct {
+	TimeControl  string      `json:"timeControl"`
+	Remaining    []int64     `json:"remaining"`    // Milliseconds each player has left, as of the message.
+	ActivePlayer game.Player `json:"activePlayer"` // Whose clock is running, unless the game has ended.
+	Running      bool        `json:"running"`
+	Flagged      bool        `json:"flagged"` // Whether the active player ran out of time.
+}
+
+// NewClockResponse describes the clocks of the game at the given time, or returns nil if it is untimed.
+func NewClockResponse(gs *game.GameSession, now time.Time) *ClockResponse {
+	if gs.Clock == nil {
+		return nil
+	}
+
+	resp := &ClockResponse{
+		TimeControl:  gs.Clock.TimeControl.String(),
+		Remaining:    make([]int64, 4),
+		ActivePlayer: gs.ActivePlayer,
+		Running:      !gs.HasEnded(),
+		Flagged:      gs.Clock.Flagged,
+	}
+	for player := game.Player(0); player < 4; player++ {
+		left := gs.Clock.Remaining[player]
+		if resp.Running {
+			left = gs.Clock.Left(player, gs.ActivePlayer, now)
+		}
+		resp.Remaining[player] = max(left, 0).Milliseconds()
+	}
+	return resp
 }
 
 type GameEndedResponse struct {
-	King   string `json:"king"`
-	Winner string `json:"winner"`
+	King   string `json:"king"`   // The player who lost their king, ran out of time or resigned; empty for a draw.
+	Winner string `json:"winner"` // Empty for a draw.
+	Reason string `json:"reason"` // See game.Termination.
+	Result string `json:"result"` // In the PGN notation, e.g. "1-0" for a Red/Yellow win.
+}
+
+// NewGameEndedResponse describes the end of the game: how it ended, who lost, and the winning team.
+func NewGameEndedResponse(gs *game.GameSession) GameEndedResponse {
+	if gs.Drawn {
+		return GameEndedResponse{Reason: string(gs.Termination), Result: gs.Result()}
+	}
+
+	loser := gs.Loser
+	if gs.Termination == "" { // E.g. a position without a king.
+		for player := range gs.Board.PieceSquares {
+			if !gs.HasKing(player) {
+				loser = player
+				break
+			}
+		}
+	}
+
+	return GameEndedResponse{
+		King:   loser.String(),
+		Winner: gs.Winner.String(),
+		Reason: string(gs.Termination),
+		Result: gs.Result(),
+	}
+}
+
+// NegotiationRequest is a resignation, or an offer, acceptance or refusal of a draw or takeback
+// on behalf of the player, whose seat the connection must have claimed.
+type NegotiationRequest struct {
+	Player game.Player `json:"player"`
+}
+
+// NegotiationResponse tells the participants about an offer, or its refusal.
+type NegotiationResponse struct {
+	Player game.Player   `json:"player"` // Who offered, accepted or declined.
+	Agreed []game.Player `json:"agreed"` // Seats that agreed so far.
+}
+
+// VersionRequest starts the handshake: the client tells the protocol version it speaks.
+type VersionRequest struct {
+	ProtocolVersion int `json:"protocolVersion"`
+}
+
+// VersionResponse tells the protocol version of the server, and whether the client's is the same.
+type VersionResponse struct {
+	ProtocolVersion int  `json:"protocolVersion"`
+	Compatible      bool `json:"compatible"`
+}
+
+// ErrorResponse tells why a request failed, over the websocket (as an error message) or the API.
+type ErrorResponse struct {
+	Code    ErrorCode   `json:"code"`
+	Error   string      `json:"error"`
+	Request MessageType `json:"request,omitempty"` // The type of the failed message.
+}
+
+// SessionResponse identifies the session of the connection, so that a client can resume it
+// after reconnecting (see Lobby.Resume).
+type SessionResponse struct {
+	SessionID string `json:"sessionId"`
+	Resumed   bool   `json:"resumed"` // Whether the connection resumed an existing session.
 }
 
 func GameMoveFromPGN(pgn PGNMove) game.Move {
@@ -69,3 +293,30 @@ func PGNMovesFromGameMoves(gameMoves []game.Move) []PGNMove {
 	}
 	return moves
 }
+
+// PGNLinesFromLines converts the engine lines of player's search, making the scores absolute.
+func PGNLinesFromLines(lines []ai.Line, player game.Player) []PGNLine {
+	pgnLines := make([]PGNLine, len(lines))
+	for i, line := range lines {
+		pgnLines[i] = PGNLine{
+			Continuation: PGNMovesFromGameMoves(line.Continuation),
+			Score:        math.Round(line.Score*float64(player.Team())*100) / 100,
+		}
+	}
+	return pgnLines
+}
+
+// NewSearchInfoResponse describes the engine's search progress, with absolute scores.
+func NewSearchInfoResponse(info ai.SearchInfo) SearchInfoResponse {
+	return SearchInfoResponse{
+		MoveNumber:   info.MoveNumber,
+		Depth:        info.Depth,
+		Continuation: PGNMovesFromGameMoves(info.Continuation),
+		Score:        math.Round(info.Score*float64(info.Player.Team())*100) / 100,
+		Lines:        PGNLinesFromLines(info.Lines, info.Player),
+		Evaluations:  info.Nodes,
+		NPS:          info.NPS,
+		Time:         math.Round(info.Elapsed.Seconds()*100) / 100,
+		Final:        info.Final,
+	}
+}
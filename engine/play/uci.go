@@ -0,0 +1,466 @@
+package play
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/ai"
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+)
+
+// The text protocol is modelled on UCI and extended for 4 players:
+//
+//	uci                                   -> id / option lines, then uciok
+//	isready                               -> readyok, once the options set are applied
+//	ucinewgame                            resets the position to the starting one
+//	setoption name <Name> value <Value>   Depth, Spread, SpreadDrop, EvalLimit, MultiPV, Algorithm,
+//	                                      Pruning; applied by the next isready or go
+//	position startpos [moves m1 m2 ...]
+//	position fen <fen> [moves m1 m2 ...]  see game.LoadFEN for the 4 player FEN
+//	go [depth N] [movetime MS] [nodes N] [infinite]
+//	   [rtime MS] [btime MS] [ytime MS] [gtime MS] [rinc MS] [binc MS] [yinc MS] [ginc MS]
+//	                                      the clocks of the 4 players; the engine manages its
+//	                                      time by the clock of the player to move. A go sent while
+//	                                      searching starts after a bounded search and stops an infinite one
+//	stop                                  stops the search, bestmove is still sent; drops the go commands
+//	                                      waiting to start
+//	quit
+//
+// The commands are read while searching; the position and the options set only apply to the next go.
+//
+// While searching, the engine streams one line per completed depth:
+//
+//	info depth <D> [multipv <I>] score cp <CP>|mate <±plies> nodes <N> nps <N> time <MS> pv <m1> <m2> ...
+//	bestmove <move> [ponder <move>]
+//
+// With MultiPV above 1, there is one info line per candidate move, best first.
+//
+// Moves use the "h2-h3" notation. Scores are from the point of view of the team
+// to move, and since 4 players alternate, mate distances are counted in plies.
+
+const uciMateScore = 1000 // Scores above uciMateScore-ai.MaxDepth are forced king captures.
+
+type uciSession struct {
+	cfg       Config
+	engine    *ai.AI
+	engineCfg Config // The config the engine was created with; see updateEngine.
+	game      *game.Game
+
+	out       io.Writer
+	writeLock sync.Mutex
+
+	searchDone chan struct{}      // Closed when the running search finishes; nil while idle.
+	stopSearch context.CancelFunc // Stops the running search.
+	infinite   bool               // Whether the running search is infinite.
+	queue      []uciSearch        // The searches to start after the running one, in order.
+}
+
+// uciSearch is a search requested by go, with the engine and the position at the time.
+type uciSearch struct {
+	engine *ai.AI
+	game   *game.Game
+	limits ai.Limits
+}
+
+// RunUCI runs the engine over the text protocol until "quit" or the end of the input.
+func RunUCI(cfg *Config, in io.Reader, out io.Writer) {
+	s := &uciSession{
+		cfg:  *cfg,
+		game: game.New(),
+		out:  out,
+	}
+	s.updateEngine()
+
+	// The input is read in the background, so that stop, isready and quit are handled while searching.
+	lines := make(chan string)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				// Let the bounded searches finish so that piped scripts get their bestmove.
+				if s.infinite {
+					s.stop()
+				}
+				s.wait()
+				return
+			}
+			if quit := s.handle(line); quit {
+				s.stop()
+				s.wait()
+				return
+			}
+		case <-s.searchDone: // Never ready while idle, as the channel is nil.
+			s.next()
+		}
+	}
+}
+
+// handle executes a single command and returns true if the session should end.
+func (s *uciSession) handle(line string) (quit bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+
+	switch fields[0] {
+	case "uci":
+		s.printf("id name 2v2ChessAI")
+		s.printf("id author vpoliakov01")
+		s.printf("option name Depth type spin default %v min 1 max %v", s.cfg.Depth, ai.MaxDepth)
+		s.printf("option name Spread type spin default %v min 1 max %v", s.cfg.Spread, ai.MovesUpperBound)
+		s.printf("option name SpreadDrop type spin default %v min 0 max %v", s.cfg.SpreadDrop, ai.MovesUpperBound)
+		s.printf("option name MultiPV type spin default %v min 1 max %v", max(s.cfg.MultiPV, 1), ai.MovesUpperBound)
+		s.printf("option name EvalLimit type spin default %v min 0 max %v", s.cfg.EvalLimit, ai.MaxEvalLimit)
+		algorithm, _ := ai.ParseAlgorithm(s.cfg.Algorithm)
+		vars := ""
+		for _, a := range ai.Algorithms {
+			vars += " var " + string(a)
+		}
+		s.printf("option name Algorithm type combo default %v%v", algorithm, vars)
+		pruning, _ := ai.ParsePruning(s.cfg.Pruning)
+		vars = ""
+		for _, p := range ai.Prunings {
+			vars += " var " + string(p)
+		}
+		s.printf("option name Pruning type combo default %v%v", pruning, vars)
+		s.printf("uciok")
+	case "isready":
+		s.updateEngine()
+		s.printf("readyok")
+	case "ucinewgame":
+		s.game = game.New()
+	case "setoption":
+		if err := s.setOption(fields[1:]); err != nil {
+			s.printf("info string %v", err)
+		}
+	case "position":
+		if err := s.setPosition(fields[1:]); err != nil {
+			s.printf("info string %v", err)
+		}
+	case "go":
+		limits, err := parseUCILimits(fields[1:], s.game)
+		if err != nil {
+			s.printf("info string %v", err)
+			return false
+		}
+		limits.MultiPV = s.cfg.MultiPV
+		s.updateEngine()
+		s.queue = append(s.queue, uciSearch{engine: s.engine, game: s.game.Copy(), limits: limits})
+		s.next()
+	case "stop":
+		s.stop()
+		s.wait()
+	case "quit":
+		return true
+	default:
+		s.printf("info string unknown command %q", fields[0])
+	}
+
+	return false
+}
+
+// setOption handles "setoption name <Name> value <Value>".
+func (s *uciSession) setOption(args []string) error {
+	if len(args) != 4 || args[0] != "name" || args[2] != "value" {
+		return fmt.Errorf("expected: setoption name <Name> value <Value>")
+	}
+
+	if strings.EqualFold(args[1], "algorithm") {
+		algorithm, err := ai.ParseAlgorithm(args[3])
+		if err != nil {
+			return err
+		}
+		s.cfg.Algorithm = string(algorithm)
+		return nil
+	}
+	if strings.EqualFold(args[1], "pruning") {
+		pruning, err := ai.ParsePruning(args[3])
+		if err != nil {
+			return err
+		}
+		s.cfg.Pruning = string(pruning)
+		return nil
+	}
+
+	value, err := strconv.Atoi(args[3])
+	if err != nil {
+		return fmt.Errorf("option %v: invalid value %q", args[1], args[3])
+	}
+
+	switch strings.ToLower(args[1]) {
+	case "depth":
+		if value < 1 || value > ai.MaxDepth {
+			return fmt.Errorf("depth must be in [1, %v]", ai.MaxDepth)
+		}
+		s.cfg.Depth = value
+	case "spread":
+		if value < 1 {
+			return fmt.Errorf("spread must be positive")
+		}
+		s.cfg.Spread = value
+	case "spreaddrop":
+		if value < 0 {
+			return fmt.Errorf("spread drop must not be negative")
+		}
+		s.cfg.SpreadDrop = value
+	case "evallimit":
+		if value < 0 {
+			return fmt.Errorf("eval limit must not be negative")
+		}
+		s.cfg.EvalLimit = value
+	case "multipv":
+		if value < 1 {
+			return fmt.Errorf("multipv must be positive")
+		}
+		s.cfg.MultiPV = value
+	default:
+		return fmt.Errorf("unknown option %q", args[1])
+	}
+
+	return nil
+}
+
+// updateEngine re-creates the engine if the options set changed its config. Setting the options
+// doesn't, so that a batch of them doesn't throw away the engine's tables once per option.
+// A running search keeps the engine it started with.
+func (s *uciSession) updateEngine() {
+	if s.engine == nil || s.cfg.engineChanged(s.engineCfg) {
+		s.engine = ai.New(s.cfg.Depth, s.cfg.Spread, s.cfg.SpreadDrop, s.cfg.EvalLimit, s.cfg.engineOptions()...)
+		s.engineCfg = s.cfg
+	}
+}
+
+// setPosition handles "position startpos|fen <fen> [moves ...]".
+func (s *uciSession) setPosition(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected: position startpos|fen <fen> [moves ...]")
+	}
+
+	movesAt := len(args)
+	for i, arg := range args {
+		if arg == "moves" {
+			movesAt = i
+			break
+		}
+	}
+
+	var g *game.Game
+	switch args[0] {
+	case "startpos":
+		g = game.New()
+	case "fen":
+		loaded, err := game.LoadFEN(strings.Join(args[1:movesAt], " "))
+		if err != nil {
+			return err
+		}
+		g = loaded
+	default:
+		return fmt.Errorf("unknown position type %q", args[0])
+	}
+
+	if movesAt < len(args) {
+		for _, moveStr := range args[movesAt+1:] {
+			move, err := game.ParseMove(moveStr)
+			if err != nil {
+				return err
+			}
+			if err := g.ValidateMove(move); err != nil {
+				return err
+			}
+			g.Play(*move)
+		}
+	}
+
+	s.game = g
+	return nil
+}
+
+// parseUCILimits parses the arguments of "go" for a search of g.
+func parseUCILimits(args []string, g *game.Game) (ai.Limits, error) {
+	limits := ai.Limits{}
+	var clock *ai.Clock
+
+	for i := 0; i < len(args); i++ {
+		if args[i] == "infinite" {
+			limits.Infinite = true
+			continue
+		}
+
+		if i+1 >= len(args) {
+			return limits, fmt.Errorf("go %v: missing value", args[i])
+		}
+		value, err := strconv.Atoi(args[i+1])
+		if err != nil || value < 0 {
+			return limits, fmt.Errorf("go %v: invalid value %q", args[i], args[i+1])
+		}
+		i++
+
+		switch args[i-1] {
+		case "depth":
+			limits.Depth = min(value, ai.MaxDepth)
+		case "movetime":
+			limits.MoveTime = time.Duration(value) * time.Millisecond
+		case "nodes":
+			limits.Nodes = value
+		case "rtime", "btime", "ytime", "gtime", "rinc", "binc", "yinc", "ginc":
+			if args[i-1][0] != "rbyg"[g.ActivePlayer] {
+				continue // Another player's clock.
+			}
+			if clock == nil {
+				clock = &ai.Clock{MovesPlayed: (g.MoveNumber - 1) / 4}
+			}
+			if strings.HasSuffix(args[i-1], "time") {
+				clock.Remaining = time.Duration(value) * time.Millisecond
+			} else {
+				clock.Increment = time.Duration(value) * time.Millisecond
+			}
+		default:
+			return limits, fmt.Errorf("go: unknown limit %q", args[i-1])
+		}
+	}
+
+	if clock != nil && clock.Remaining > 0 {
+		limits.Clock = clock
+	}
+	if limits.Depth == 0 && (limits.MoveTime > 0 || limits.Clock != nil) {
+		limits.Depth = ai.MaxDepth
+	}
+
+	return limits, nil
+}
+
+// next starts the first queued search in the background once the running one finishes.
+// A running infinite search is stopped, as it would only end with stop.
+func (s *uciSession) next() {
+	if s.searchDone != nil {
+		select {
+		case <-s.searchDone:
+			s.searchDone = nil
+			s.infinite = false
+		default: // Still running.
+		}
+	}
+
+	if s.searchDone == nil && len(s.queue) > 0 {
+		search := s.queue[0]
+		s.queue = s.queue[1:]
+
+		ctx, cancel := context.WithCancel(context.Background())
+		s.searchDone = make(chan struct{})
+		s.stopSearch = cancel
+		s.infinite = search.limits.Infinite
+		go s.search(ctx, search, s.searchDone)
+	}
+
+	if s.infinite && len(s.queue) > 0 {
+		s.stopSearch()
+	}
+}
+
+// search runs an iterative deepening search and sends its bestmove.
+func (s *uciSession) search(ctx context.Context, search uciSearch, done chan struct{}) {
+	defer close(done)
+	limits := search.limits
+
+	limits.OnIteration = func(info ai.SearchInfo) {
+		for i, line := range info.Lines {
+			multiPV := ""
+			if limits.MultiPV > 1 {
+				multiPV = fmt.Sprintf(" multipv %v", i+1)
+			}
+			s.printf(
+				"info depth %v%v score %v nodes %v nps %v time %v pv %v",
+				info.Depth,
+				multiPV,
+				uciScore(line.Score),
+				info.Nodes,
+				info.NPS,
+				info.Elapsed.Milliseconds(),
+				uciMoves(line.Continuation),
+			)
+		}
+	}
+
+	result, err := search.engine.GetBestMoveCtx(ctx, search.game, limits)
+	if err != nil {
+		s.printf("info string %v", err)
+	}
+
+	// In infinite mode, bestmove is only sent after "stop".
+	if limits.Infinite {
+		<-ctx.Done()
+	}
+
+	best := result.Continuation
+	switch {
+	case len(best) == 0:
+		s.printf("bestmove (none)")
+	case len(best) == 1:
+		s.printf("bestmove %v", best[0])
+	default:
+		s.printf("bestmove %v ponder %v", best[0], best[1])
+	}
+}
+
+// stop stops the running search, if any, and drops the queued ones.
+func (s *uciSession) stop() {
+	s.queue = nil
+	if s.searchDone != nil {
+		s.stopSearch()
+	}
+}
+
+// wait blocks until the running search and the queued ones finish.
+func (s *uciSession) wait() {
+	for s.searchDone != nil {
+		<-s.searchDone
+		s.next()
+	}
+}
+
+func (s *uciSession) printf(format string, args ...interface{}) {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	fmt.Fprintf(s.out, format+"\n", args...)
+}
+
+// uciScore formats the score as "cp <centipawns>" or "mate <plies>".
+func uciScore(score float64) string {
+	if math.Abs(score) >= float64(uciMateScore-ai.MaxDepth) {
+		plies := uciMateScore - int(math.Abs(score))
+		if score < 0 {
+			plies = -plies
+		}
+		return fmt.Sprintf("mate %v", plies)
+	}
+	return fmt.Sprintf("cp %v", int(math.Round(score*100)))
+}
+
+func uciMoves(moves []game.Move) string {
+	strs := make([]string, len(moves))
+	for i, move := range moves {
+		strs[i] = move.String()
+	}
+	return strings.Join(strs, " ")
+}
@@ -0,0 +1,168 @@
+package play_test
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/ai"
+	"github.com/vpoliakov01/2v2ChessAI/engine/game"
+	"github.com/vpoliakov01/2v2ChessAI/engine/play"
+)
+
+// runUCI feeds the commands to the text protocol and returns the output lines.
+func runUCI(t *testing.T, commands ...string) []string {
+	t.Helper()
+	cfg := &play.Config{Depth: 2, Spread: ai.DefaultSpread, SpreadDrop: ai.DefaultSpreadDrop}
+
+	out := &bytes.Buffer{}
+	play.RunUCI(cfg, strings.NewReader(strings.Join(commands, "\n")+"\n"), out)
+
+	return strings.Split(strings.TrimSpace(out.String()), "\n")
+}
+
+func linesWithPrefix(lines []string, prefix string) []string {
+	out := []string{}
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+func TestUCIHandshake(t *testing.T) {
+	lines := runUCI(t, "uci", "isready")
+
+	require.Equal(t, "id name 2v2ChessAI", lines[0])
+	require.NotEmpty(t, linesWithPrefix(lines, "option name Spread"))
+	require.Equal(t, []string{"uciok", "readyok"}, lines[len(lines)-2:])
+}
+
+func TestUCIGoDepth(t *testing.T) {
+	lines := runUCI(t, "position startpos moves h2-h3", "go depth 3")
+
+	infos := linesWithPrefix(lines, "info depth")
+	require.Len(t, infos, 3, "expected one info line per depth")
+	require.Contains(t, infos[2], " pv ")
+
+	bestMoves := linesWithPrefix(lines, "bestmove")
+	require.Len(t, bestMoves, 1)
+
+	// Blue is to move after h2-h3.
+	g := game.New()
+	g.Play(game.MoveFromPGN("h2-h3"))
+	move, err := game.ParseMove(strings.Fields(bestMoves[0])[1])
+	require.NoError(t, err)
+	require.NoError(t, g.ValidateMove(move))
+}
+
+func TestUCIInfiniteStop(t *testing.T) {
+	lines := runUCI(t, "go infinite", "stop")
+
+	require.Len(t, linesWithPrefix(lines, "bestmove"), 1)
+}
+
+func TestUCIReadsWhileSearching(t *testing.T) {
+	startTime := time.Now()
+	lines := runUCI(t, "go depth 20", "position startpos moves h2-h3", "setoption name Depth value 1", "isready", "stop")
+
+	require.Less(t, time.Since(startTime), 5*time.Second, "stop is read during a bounded search")
+	require.Len(t, linesWithPrefix(lines, "bestmove"), 1)
+	require.Less(t, slices.Index(lines, "readyok"), slices.IndexFunc(lines, func(line string) bool {
+		return strings.HasPrefix(line, "bestmove")
+	}), "isready is answered while searching")
+}
+
+func TestUCIGoWhileSearching(t *testing.T) {
+	lines := runUCI(t, "go depth 2", "position startpos moves h2-h3", "go depth 2", "go infinite", "go depth 1")
+
+	bestMoves := linesWithPrefix(lines, "bestmove")
+	require.Len(t, bestMoves, 4, "every go is searched in turn, and the infinite one is stopped by the next go")
+
+	// The second search is of the position set during the first.
+	g := game.New()
+	g.Play(game.MoveFromPGN("h2-h3"))
+	move, err := game.ParseMove(strings.Fields(bestMoves[1])[1])
+	require.NoError(t, err)
+	require.NoError(t, g.ValidateMove(move))
+}
+
+func TestUCIPositionFEN(t *testing.T) {
+	g := game.New()
+	g.Play(game.MoveFromPGN("h2-h3"))
+
+	lines := runUCI(t, "setoption name Depth value 1", "position fen "+g.FEN(), "go")
+
+	bestMoves := linesWithPrefix(lines, "bestmove")
+	require.Len(t, bestMoves, 1)
+	move, err := game.ParseMove(strings.Fields(bestMoves[0])[1])
+	require.NoError(t, err)
+	require.NoError(t, g.ValidateMove(move))
+}
+
+func TestUCIInvalidInput(t *testing.T) {
+	lines := runUCI(t, "position startpos moves a1-a2", "setoption name Nope value 1", "go depth x", "foo")
+
+	require.Len(t, linesWithPrefix(lines, "info string"), 4)
+	require.Empty(t, linesWithPrefix(lines, "bestmove"))
+}
+
+func TestUCIMultiPV(t *testing.T) {
+	lines := runUCI(t, "setoption name MultiPV value 3", "go depth 2")
+
+	infos := linesWithPrefix(lines, "info depth 2 multipv")
+	require.Len(t, infos, 3)
+	for i, info := range infos {
+		require.Contains(t, info, fmt.Sprintf(" multipv %v ", i+1))
+	}
+	require.Len(t, linesWithPrefix(lines, "bestmove"), 1)
+}
+
+func TestUCIOptionsKeepEngine(t *testing.T) {
+	cfg := &play.Config{Depth: 2, Spread: ai.DefaultSpread, SpreadDrop: ai.DefaultSpreadDrop}
+	engines := play.UCIEngines(cfg,
+		"setoption name Depth value 3", "setoption name Spread value 7", "isready", // 0-2
+		"setoption name MultiPV value 2", "setoption name Depth value 3", "isready", // 3-5
+		"setoption name Depth value 4", "setoption name Depth value 3", "go depth 1", // 6-8
+		"setoption name Pruning value spread", "go depth 1", // 9-10
+	)
+
+	require.Same(t, engines[0], engines[1], "the options are applied together")
+	require.NotSame(t, engines[1], engines[2], "isready applies the options")
+	require.Same(t, engines[2], engines[5], "the engine settings didn't change")
+	require.Same(t, engines[5], engines[8], "the engine settings changed back")
+	require.NotSame(t, engines[9], engines[10], "go applies the options")
+}
+
+func TestUCIAlgorithm(t *testing.T) {
+	lines := runUCI(t, "uci", "setoption name Algorithm value brs", "go depth 2", "setoption name Algorithm value minimax")
+
+	require.Equal(t, []string{"option name Algorithm type combo default negamax var negamax var paranoid var maxn var brs"},
+		linesWithPrefix(lines, "option name Algorithm"))
+	require.Len(t, linesWithPrefix(lines, "bestmove"), 1)
+	require.Len(t, linesWithPrefix(lines, "info string"), 1, "minimax is unknown")
+}
+
+func TestUCIPruning(t *testing.T) {
+	lines := runUCI(t, "uci", "setoption name Pruning value spread", "go depth 3", "setoption name Pruning value alphabeta")
+
+	require.Equal(t, []string{"option name Pruning type combo default selective var selective var spread"},
+		linesWithPrefix(lines, "option name Pruning"))
+	require.Len(t, linesWithPrefix(lines, "bestmove"), 1)
+	require.Len(t, linesWithPrefix(lines, "info string"), 1, "alphabeta is unknown")
+}
+
+func TestUCIGoClock(t *testing.T) {
+	startTime := time.Now()
+	// Blue is to move, with 2 seconds left; Red's clock doesn't matter.
+	lines := runUCI(t, "position startpos moves h2-h3", "go rtime 1 btime 2000 binc 100")
+
+	require.Len(t, linesWithPrefix(lines, "bestmove"), 1)
+	require.Less(t, time.Since(startTime), time.Second, "the engine budgets its time by Blue's clock")
+}
@@ -0,0 +1,30 @@
+package play
+
+import (
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/filesystem"
+)
+
+// WithUI makes the server serve the UI build, e.g. the embedded one (see package ui), at /.
+func WithUI(build fs.FS) func(*Server) {
+	return func(s *Server) {
+		s.ui = build
+	}
+}
+
+// serveUI serves the files of the UI build. Paths without a file get index.html, so that
+// the UI can route them on the client side; /ws and /api are left to their handlers.
+func (s *Server) serveUI() {
+	s.app.Use("/", filesystem.New(filesystem.Config{
+		Next: func(c *fiber.Ctx) bool {
+			return c.Path() == "/ws" || c.Path() == "/api" || strings.HasPrefix(c.Path(), "/api/")
+		},
+		Root:         http.FS(s.ui),
+		Index:        "index.html",
+		NotFoundFile: "index.html",
+	}))
+}
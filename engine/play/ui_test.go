@@ -0,0 +1,51 @@
+package play_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vpoliakov01/2v2ChessAI/engine/play"
+)
+
+func TestServeUI(t *testing.T) {
+	build := fstest.MapFS{
+		"index.html":     {Data: []byte("<html>index</html>")},
+		"static/app.js":  {Data: []byte("console.log('app')")},
+		"manifest.json":  {Data: []byte("{}")},
+		"static/app.css": {Data: []byte("body {}")},
+	}
+	server := play.NewServer(defaultTestConfig(), play.WithUI(build))
+
+	get := func(path string) (int, string) {
+		res, err := server.App().Test(httptest.NewRequest(http.MethodGet, path, nil), -1)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(body)
+	}
+
+	status, body := get("/")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "<html>index</html>", body)
+
+	status, body = get("/static/app.js")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "console.log('app')", body)
+
+	status, body = get("/rooms/friday")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "<html>index</html>", body, "the UI routes the paths without a file")
+
+	status, body = get("/api/nothing")
+	require.Equal(t, http.StatusNotFound, status)
+	require.Contains(t, body, `"code":"notFound"`, "the API answers its own paths")
+
+	status, _ = get("/api/games")
+	require.Equal(t, http.StatusOK, status)
+}
@@ -0,0 +1,3 @@
+// Package ui embeds the production build of the React UI (`npm run build` in this directory)
+// into binaries built with the embedui tag, so that the server can serve it without Node.
+package ui
@@ -0,0 +1,22 @@
+//go:build embedui
+
+package ui
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:build
+var build embed.FS
+
+// Build is the production build of the UI.
+var Build fs.FS = mustSub(build, "build")
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
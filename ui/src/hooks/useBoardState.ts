@@ -2,12 +2,15 @@ import { useCallback, useReducer, useState } from 'react';
 import { Move, movesEqual, PGNMove, Position } from '../common';
 import {
 	BestMoveResponse,
+	EngineQueuedResponse,
+	ErrorResponse,
 	GameEndedResponse,
 	LoadGameResponse,
 	Message,
 	MessageType,
 	playSound,
 	SaveGameResponse,
+	SearchInfoResponse,
 	Sound,
 } from '../utils';
 import { gameReducer, loadInitialState } from './gameReducer';
@@ -53,6 +56,27 @@ export function useBoardState() {
 			case MessageType.StoppedProcessing:
 				console.log('Stopped thinking');
 				break;
+			case MessageType.EngineQueued: {
+				const queued = message.data as EngineQueuedResponse;
+				if (queued.position > 0) {
+					console.log(`Waiting for the engine (${queued.request}): position ${queued.position} in the queue`);
+				}
+				break;
+			}
+			case MessageType.SearchInfo: {
+				const info = message.data as SearchInfoResponse;
+				console.log(
+					`depth ${info.depth}  score ${info.score}  evals ${info.evaluations}  nps ${info.nps}  ${info.time}s`,
+					info.continuation.join(' '),
+				);
+				dispatch({ type: 'setScore', score: info.score });
+				break;
+			}
+			case MessageType.Error: {
+				const error = message.data as ErrorResponse;
+				console.error(`${error.request ?? 'request'} failed (${error.code}): ${error.error}`);
+				break;
+			}
 			default:
 				console.log('unknown message', message);
 				break;
@@ -1,5 +1,25 @@
 import { useCallback, useEffect, useRef } from 'react';
-import { GameSyncService, Message } from '../utils';
+import {
+	GameSyncService,
+	Message,
+	MessageType,
+	PROTOCOL_VERSION,
+	SessionResponse,
+	VersionResponse,
+} from '../utils';
+
+// The session survives page reloads, so that the server can hand back its game instead of replaying it.
+const sessionStorageKey = 'sessionId';
+
+// serverUrl is the websocket of the server. The development server (npm start) runs next to it;
+// the production build is served by the server itself.
+function serverUrl() {
+	if (process.env.NODE_ENV === 'development') {
+		return 'ws://localhost:8080/ws';
+	}
+	const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+	return `${protocol}//${window.location.host}/ws`;
+}
 
 export function useGameSocket(onMessage: (message: Message) => void) {
 	const wsRef = useRef<WebSocket | null>(null);
@@ -24,17 +44,30 @@ export function useGameSocket(onMessage: (message: Message) => void) {
 	}, []);
 
 	useEffect(() => {
-		const ws = new WebSocket('ws://localhost:8080/ws');
+		const sessionId = sessionStorage.getItem(sessionStorageKey);
+		const ws = new WebSocket(`${serverUrl()}${sessionId ? `?session=${sessionId}` : ''}`);
 
 		ws.onopen = () => {
 			wsRef.current = ws;
 			console.log('WS connected');
-			GameSyncService.syncWithEngine(ws);
+			ws.send(new Message(MessageType.Version, { protocolVersion: PROTOCOL_VERSION }).json());
 		};
 
 		ws.onmessage = event => {
 			const message = JSON.parse(event.data) as Message;
 			console.debug(`Received   ${message.type}`.padEnd(30), message);
+
+			if (message.type === MessageType.VersionResponse && !(message.data as VersionResponse).compatible) {
+				alert('The server speaks another protocol version. Please reload the page.');
+			}
+			if (message.type === MessageType.Session) {
+				const session = message.data as SessionResponse;
+				sessionStorage.setItem(sessionStorageKey, session.sessionId);
+				// A resumed session comes with its game; a new one is set up from the local state.
+				if (!session.resumed) {
+					GameSyncService.syncWithEngine(ws);
+				}
+			}
 			handlerRef.current(message);
 		};
 
@@ -19,6 +19,7 @@ export class GameSyncService {
 			spreadDrop: settings.spreadDrop,
 			humanPlayers: settings.humanPlayers,
 			evalLimit: settings.evalLimit,
+			multiPV: settings.multiPV,
 		};
 
 		ws.send(JSON.stringify({ type: MessageType.SetSettings, data: engineSettings }));
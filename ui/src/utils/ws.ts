@@ -1,7 +1,12 @@
 import { PGNMove } from '../common';
 
+// PROTOCOL_VERSION is the version of the websocket protocol this UI speaks (see engine/play/protocol.go).
+// The message types and data below mirror the server's; TestProtocolUI checks that they don't drift.
+export const PROTOCOL_VERSION = 3;
+
 export enum MessageType {
 	SetSettings = 'setSettings',
+	SetSettingsResponse = 'setSettingsResponse',
 	GetAvailableMoves = 'getAvailableMoves',
 	AvailableMoves = 'availableMoves',
 	PlayerMove = 'playerMove',
@@ -16,14 +21,69 @@ export enum MessageType {
 	GameEnded = 'gameEnded',
 	Processing = 'processing',
 	StoppedProcessing = 'stoppedProcessing',
+	SearchInfo = 'searchInfo',
+	MovePlayed = 'movePlayed',
+	JoinRoom = 'joinRoom',
+	RoomState = 'roomState',
+	ListRooms = 'listRooms',
+	RoomList = 'roomList',
+	Analyze = 'analyze',
+	StopAnalysis = 'stopAnalysis',
+	AnalysisInfo = 'analysisInfo',
+	Hint = 'hint',
+	HintResponse = 'hintResponse',
+	Session = 'session',
+	Resume = 'resume',
+	Resign = 'resign',
+	OfferDraw = 'offerDraw',
+	AcceptDraw = 'acceptDraw',
+	DeclineDraw = 'declineDraw',
+	DrawOffer = 'drawOffer',
+	DrawDeclined = 'drawDeclined',
+	RequestTakeback = 'requestTakeback',
+	AcceptTakeback = 'acceptTakeback',
+	DeclineTakeback = 'declineTakeback',
+	TakebackRequest = 'takebackRequest',
+	TakebackDeclined = 'takebackDeclined',
+	Error = 'error',
+	Version = 'version',
+	VersionResponse = 'versionResponse',
+	EngineQueued = 'engineQueued',
+}
+
+export interface PGNLine {
+	continuation: PGNMove[];
+	score: number;
 }
 
 export interface BestMoveResponse {
 	continuation: PGNMove[];
 	score: number;
+	lines: PGNLine[];
 	time: number;
 	evaluations: number;
 	moveNumber: number;
+	clock?: ClockResponse;
+}
+
+export interface ClockResponse {
+	timeControl: string;
+	remaining: number[]; // Milliseconds each player has left, as of the message.
+	activePlayer: number;
+	running: boolean;
+	flagged: boolean;
+}
+
+export interface SearchInfoResponse {
+	moveNumber: number;
+	depth: number;
+	continuation: PGNMove[];
+	score: number;
+	lines: PGNLine[];
+	evaluations: number;
+	nps: number;
+	time: number;
+	final: boolean;
 }
 
 export interface SaveGameResponse {
@@ -33,6 +93,7 @@ export interface SaveGameResponse {
 export interface LoadGameResponse {
 	pastMoves: PGNMove[];
 	currentMove: number;
+	clock?: ClockResponse;
 }
 
 export interface GameSettings {
@@ -41,31 +102,138 @@ export interface GameSettings {
 	spread: number;
 	spreadDrop: number;
 	evalLimit: number;
+	multiPV?: number;
+	timeControl?: string; // E.g. "300+2": base time + increment in seconds.
+	algorithm?: string; // negamax (default), paranoid, maxn or brs.
+	pruning?: string; // selective (default) or spread; of the negamax engine.
 }
 
 export interface GameEndedResponse {
-	king: string;
-	winner: string;
+	king: string; // Empty for a draw.
+	winner: string; // Empty for a draw.
+	reason: 'king' | 'time' | 'resignation' | 'agreement';
+	result: '1-0' | '0-1' | '1/2-1/2';
+}
+
+// A resignation, or an offer, acceptance or refusal of a draw or takeback for one of your seats.
+export interface NegotiationRequest {
+	player: number;
+}
+
+export interface NegotiationResponse {
+	player: number; // Who offered, accepted or declined.
+	agreed: number[]; // Seats that agreed so far.
+}
+
+export interface MovePlayedResponse {
+	moveNumber: number;
+	player: number;
+	move: PGNMove;
+	clock?: ClockResponse;
+}
+
+export interface JoinRoomRequest {
+	roomId: string;
+	seats: number[];
+	spectate?: boolean;
+}
+
+export interface SeatState {
+	player: number;
+	claimed: boolean;
+	yours: boolean;
+}
+
+export interface RoomStateResponse {
+	roomId: string;
+	participants: number;
+	spectators: number;
+	spectating: boolean;
+	engineGame: boolean;
+	seats: SeatState[];
+}
+
+export interface RoomSummary {
+	roomId: string;
+	participants: number;
+	spectators: number;
+	humanPlayers: number[];
+	moveNumber: number;
+	engineGame: boolean;
+	ended: boolean;
+}
+
+export interface AnalyzeRequest {
+	depth?: number;
+	moveTime?: number; // Milliseconds.
+	multiPV?: number;
+}
+
+export interface HintResponse {
+	moveNumber: number;
+	move: PGNMove;
+	score: number;
+}
+
+export interface EngineQueuedResponse {
+	request: MessageType; // engineMove, analyze or hint.
+	position: number; // In the queue of the server's engines, from 1; 0 once the search runs.
+}
+
+export interface SessionResponse {
+	sessionId: string;
+	resumed: boolean; // Whether the connection resumed an existing session.
+}
+
+export interface VersionRequest {
+	protocolVersion: number;
+}
+
+export interface VersionResponse {
+	protocolVersion: number;
+	compatible: boolean;
+}
+
+export interface ErrorResponse {
+	code: string; // E.g. invalidMessage, forbidden, invalidMove (see engine/play/errors.go).
+	error: string;
+	request?: MessageType; // The type of the failed message.
 }
 
 type MessageData =
 	| PGNMove
 	| PGNMove[]
 	| BestMoveResponse
+	| SearchInfoResponse
 	| SaveGameResponse
 	| LoadGameResponse
 	| GameSettings
 	| GameEndedResponse
+	| MovePlayedResponse
+	| JoinRoomRequest
+	| RoomStateResponse
+	| RoomSummary[]
+	| AnalyzeRequest
+	| HintResponse
+	| EngineQueuedResponse
+	| SessionResponse
+	| NegotiationRequest
+	| NegotiationResponse
+	| ErrorResponse
+	| VersionRequest
+	| VersionResponse
 	| string
 	| number
 	| null;
 
 export class Message {
-	constructor(public type: MessageType, public data: MessageData) {}
+	// id is echoed by the error message if the request fails.
+	constructor(public type: MessageType, public data: MessageData, public id?: string) {}
 
 	json() {
 		return JSON.stringify({
 			type: this.type,
+			id: this.id,
 			data: this.data,
 		});
 	}
@@ -0,0 +1,8 @@
+//go:build !embedui
+
+package ui
+
+import "io/fs"
+
+// Build is the production build of the UI, or nil unless the binary is built with the embedui tag.
+var Build fs.FS